@@ -0,0 +1,371 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrAccessRequestNotFound is returned by an AccessRequestStore for unknown ids
+var ErrAccessRequestNotFound = errors.New("auth: access request not found")
+
+// AccessRequestStatus is where an AccessRequest stands
+type AccessRequestStatus string
+
+// Every AccessRequestStatus
+const (
+	RequestPending  AccessRequestStatus = "pending"
+	RequestApproved AccessRequestStatus = "approved"
+	RequestRejected AccessRequestStatus = "rejected"
+)
+
+// AccessRequest is a denied user asking to be let in
+type AccessRequest struct {
+	ID        string              `json:"id"`
+	Login     string              `json:"login"`
+	Name      string              `json:"name,omitempty"`
+	Reason    Reason              `json:"reason,omitempty"` // why they were denied
+	Message   string              `json:"message,omitempty"`
+	Status    AccessRequestStatus `json:"status"`
+	Created   time.Time           `json:"created"`
+	Decided   time.Time           `json:"decided,omitempty"`
+	DecidedBy string              `json:"decided_by,omitempty"`
+}
+
+// AccessRequestStore persists access requests
+type AccessRequestStore interface {
+	Get(ctx context.Context, id string) (*AccessRequest, error)
+	Put(ctx context.Context, req *AccessRequest) error
+	List(ctx context.Context) ([]*AccessRequest, error)
+}
+
+// MemoryAccessRequests is an in memory AccessRequestStore
+type MemoryAccessRequests struct {
+	mu       sync.Mutex
+	requests map[string]*AccessRequest
+}
+
+// Get implements AccessRequestStore
+func (m *MemoryAccessRequests) Get(ctx context.Context, id string) (*AccessRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	req, ok := m.requests[id]
+	if !ok {
+		return nil, ErrAccessRequestNotFound
+	}
+	c := *req
+	return &c, nil
+}
+
+// Put implements AccessRequestStore
+func (m *MemoryAccessRequests) Put(ctx context.Context, req *AccessRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.requests == nil {
+		m.requests = make(map[string]*AccessRequest)
+	}
+	c := *req
+	m.requests[req.ID] = &c
+	return nil
+}
+
+// List implements AccessRequestStore
+func (m *MemoryAccessRequests) List(ctx context.Context) ([]*AccessRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]*AccessRequest, 0, len(m.requests))
+	for _, req := range m.requests {
+		c := *req
+		list = append(list, &c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	return list, nil
+}
+
+// AccessRequests turns denials into an onboarding path: denied users can
+// ask to be let in, team maintainers get notified and decide through the
+// admin API
+type AccessRequests struct {
+	Store AccessRequestStore
+
+	// Notify, if set, is called for every new request, e.g. with
+	// WebhookNotifier() or a func sending an email to the maintainers
+	Notify func(ctx context.Context, req *AccessRequest) error
+
+	// OnDecide, if set, is called when a request is approved or rejected,
+	// e.g. to add the user to the team
+	OnDecide func(ctx context.Context, req *AccessRequest) error
+}
+
+// Request records that user, denied for reason, asks for access. A user
+// has only one pending request at a time, asking again returns it
+func (a *AccessRequests) Request(ctx context.Context, user *User, reason Reason, message string) (*AccessRequest, error) {
+	list, err := a.Store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, req := range list {
+		if req.Status == RequestPending && strings.EqualFold(req.Login, user.Login) {
+			return req, nil
+		}
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return nil, err
+	}
+	req := &AccessRequest{
+		ID:      id,
+		Login:   user.Login,
+		Name:    user.Name,
+		Reason:  reason,
+		Message: message,
+		Status:  RequestPending,
+		Created: time.Now(),
+	}
+	if err := a.Store.Put(ctx, req); err != nil {
+		return nil, err
+	}
+	if a.Notify != nil {
+		if err := a.Notify(ctx, req); err != nil {
+			return req, err
+		}
+	}
+	return req, nil
+}
+
+// Decide approves or rejects the request id on behalf of by
+func (a *AccessRequests) Decide(ctx context.Context, id string, approve bool, by string) (*AccessRequest, error) {
+	req, err := a.Store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	req.Status = RequestRejected
+	if approve {
+		req.Status = RequestApproved
+	}
+	req.Decided = time.Now()
+	req.DecidedBy = by
+	if err := a.Store.Put(ctx, req); err != nil {
+		return nil, err
+	}
+	if a.OnDecide != nil {
+		if err := a.OnDecide(ctx, req); err != nil {
+			return req, err
+		}
+	}
+	return req, nil
+}
+
+// Handler lets the denied user in the request context, see WithUser(), ask
+// for access with a POST of an optional "message" form value. The Reason is
+// taken from the Decision in the context, if any. It answers with the
+// request as JSON, or redirects to the "next" form value when set
+func (a *AccessRequests) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		decision, _ := DecisionFromContext(r.Context())
+
+		req, err := a.Request(r.Context(), user, decision.Reason, r.FormValue("message"))
+		if req == nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// a failed notification still recorded the request, maintainers
+		// will find it in the admin view
+
+		if next := localPath(r.FormValue("next")); next != "" {
+			http.Redirect(w, r, next, http.StatusSeeOther)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(req)
+	})
+}
+
+// AdminHandler serves the access request admin API, mount it with
+// http.StripPrefix:
+//
+//	GET  /             list requests, ?status=pending to filter
+//	POST /{id}/approve approve a request
+//	POST /{id}/reject  reject a request
+//
+// allow gates access like in Config.InfoHandler(), nil rejects everybody.
+// The deciding admin is the User in the request context, if any
+func (a *AccessRequests) AdminHandler(allow func(r *http.Request) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if allow == nil || !allow(r) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		var body interface{}
+		var err error
+		switch {
+		case parts[0] == "" && r.Method == "GET":
+			var list []*AccessRequest
+			list, err = a.Store.List(r.Context())
+			if status := r.URL.Query().Get("status"); status != "" {
+				filtered := list[:0]
+				for _, req := range list {
+					if string(req.Status) == status {
+						filtered = append(filtered, req)
+					}
+				}
+				list = filtered
+			}
+			body = list
+		case len(parts) == 2 && r.Method == "POST" && (parts[1] == "approve" || parts[1] == "reject"):
+			by := ""
+			if admin, ok := UserFromContext(r.Context()); ok {
+				by = admin.Login
+			}
+			body, err = a.Decide(r.Context(), parts[0], parts[1] == "approve", by)
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		if err == ErrAccessRequestNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	})
+}
+
+// requestClaims is the payload of request tokens
+type requestClaims struct {
+	ID      int64  `json:"id"`
+	Login   string `json:"login"`
+	Name    string `json:"name,omitempty"`
+	Reason  Reason `json:"reason"`
+	Expires int64  `json:"exp"`
+}
+
+// requestToken returns a token proving user was denied for reason, valid
+// as long as a login state, for the denial page to post to
+// RequestAccessURL since denied users have no session
+func (c *Config) requestToken(user *User, reason Reason) (string, error) {
+	b, err := json.Marshal(requestClaims{
+		ID:      user.ID,
+		Login:   user.Login,
+		Name:    user.Name,
+		Reason:  reason,
+		Expires: time.Now().Add(stateTTL).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(b)
+	return encoded + "." + c.signWith("request:", encoded), nil
+}
+
+// requestUser returns the user and reason of a token made by
+// requestToken(), ErrStateMismatch if invalid or expired
+func (c *Config) requestUser(token string) (*User, Reason, error) {
+	i := strings.LastIndex(token, ".")
+	if i < 0 || !hmac.Equal([]byte(token[i+1:]), []byte(c.signWith("request:", token[:i]))) {
+		return nil, "", ErrStateMismatch
+	}
+	b, err := base64.RawURLEncoding.DecodeString(token[:i])
+	if err != nil {
+		return nil, "", ErrStateMismatch
+	}
+	var claims requestClaims
+	if err := json.Unmarshal(b, &claims); err != nil || time.Now().Unix() > claims.Expires {
+		return nil, "", ErrStateMismatch
+	}
+	return &User{ID: claims.ID, Login: claims.Login, Name: claims.Name}, claims.Reason, nil
+}
+
+// AccessRequestHandler is a.Handler() for the denial page of c.UI, mount it
+// at RequestAccessURL. Denied users have no session, the page posts a
+// signed "token" naming them instead. With a UI they get a confirmation
+// page rather than JSON
+func (c *Config) AccessRequestHandler(a *AccessRequests) http.Handler {
+	h := a.Handler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		user, reason, err := c.requestUser(r.FormValue("token"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		ctx := WithDecision(WithUser(r.Context(), user), Decision{Reason: reason})
+		if c.UI == nil || r.FormValue("next") != "" {
+			h.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		// a failed notification still recorded the request, like in
+		// Handler()
+
+		if req, err := a.Request(ctx, user, reason, r.FormValue("message")); req == nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data, err := c.UI.catalog().PageData(r, RequestSentMessage, c.pageData(user))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		c.UI.RenderInterstitial(w, r, data.Message, "", data)
+	})
+}
+
+// WebhookNotifier returns a func for AccessRequests.Notify posting new
+// requests as JSON to url, e.g. a Slack workflow or an internal service
+// emailing the team maintainers. client may be nil
+func WebhookNotifier(url string, client *http.Client) func(ctx context.Context, req *AccessRequest) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(ctx context.Context, req *AccessRequest) error {
+		b, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		hreq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(b))
+		if err != nil {
+			return err
+		}
+		hreq.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(hreq)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("auth: access request webhook: %s", resp.Status)
+		}
+		return nil
+	}
+}
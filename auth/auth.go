@@ -3,122 +3,414 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/github"
+	"golang.org/x/sync/singleflight"
 )
 
 // Config describes the required Github Organization and Team users are required
 // to belong to in order to authenticate. And also has some required OAuth2 stuff.
+//
+// Leave Team empty, with no other teams, to allow the whole Organization.
+// Once set up a Config is safe for concurrent use, don't change or copy it
+// after the first request
 type Config struct {
-	Organization string // Organization name
-	Team         string // Team inside Organization
-	ClientID     string // OAuth2 application client id
-	ClientSecret string // OAuth2 application client secret
+	Organization string   // Organization name
+	Team         string   // Team inside Organization by slug or name, or a glob like eng-*
+	AllowedTeams []string // More teams besides Team, any of them is enough
+	RequireAll   bool     // require membership in Team and all AllowedTeams instead
+	TeamIDs      []int64  // teams by numeric github id, immune to renames
+	ClientID     string   // OAuth2 application client id
+	ClientSecret string   // OAuth2 application client secret
+	PublicClient bool     // no ClientSecret, for desktop or mobile apps using AuthCodeURLWithPKCE()
+	RedirectURL  string   // callback url, the one registered in github if empty
+	RedirectURLs []string // callback urls per domain, see AuthCodeURLForRequest()
+
+	// RequirePublicMembership makes only active and publicly visible
+	// Organization memberships satisfy the check
+	RequirePublicMembership bool
+
+	// Repository, given as owner/name, admits users with MinPermission on
+	// it regardless of their teams, see Verifier
+	Repository    string
+	MinPermission string
+
+	// RepoScope requests the repo scope, which github needs to show a
+	// private Repository. Beware it grants read and write access to every
+	// private repository of the user, only set it when Repository is
+	// private. Public repositories don't need it
+	RepoScope bool
+
+	// RequireTwoFactor denies users without two-factor authentication
+	// with TwoFactorDisabled. Unless github says so in the user profile it
+	// takes a ServerToken of an Organization owner
+	RequireTwoFactor bool
+
+	// AllowedEmailDomains, like example.com, deny users without a verified
+	// email in one of them with EmailNotAllowed, see Verifier
+	AllowedEmailDomains []string
+
+	// Members optionally keeps the team members in memory, so Verify()
+	// doesn't ask github about the teams of users it lists
+	Members *TeamMembers
+
+	// ServerToken is a personal access token with read:org, or an app's
+	// installation tokens from GitHubAppConfig.TokenSource(), used by
+	// CheckMembership()
+	ServerToken oauth2.TokenSource
+
+	// IncludeChildTeams lets members of nested teams in, like platform/infra
+	// for Team platform, see Verifier
+	IncludeChildTeams bool
+
+	// AllowOrgAdmins admits owners of Organization without any team
+	AllowOrgAdmins bool
+
+	// RequireMaintainer only admits maintainers of the teams, for admin
+	// areas. Decision.Team.Role always tells which one the user is
+	RequireMaintainer bool
+
+	// TeamRegexps are acceptable team slugs in addition to Team. Compile
+	// them with regexp.MustCompile so mistakes show up at startup
+	TeamRegexps []*regexp.Regexp
+
+	// SlugOnly matches teams by slug only, not by display name too
+	SlugOnly bool
+
+	// CaseSensitive turns off the case insensitive comparison of
+	// Organization and Team names
+	CaseSensitive bool
+
+	// DecodeUser is an optional hook to get more out of github user data,
+	// see DecodeUserFunc
+	DecodeUser DecodeUserFunc
+
+	// Claims, when set, builds the payload kept in sessions, which then
+	// only keep the login and id of the User and the Decision without
+	// Teams. Read it from Session.Claims
+	Claims ClaimsFunc
+
+	// Roles optionally maps the teams of allowed users to application roles
+	Roles RoleMapper
+
+	// Authorizer, when set, replaces the team rule, see Authorizer
+	Authorizer Authorizer
+
+	// AllowUsers and DenyUsers are github logins allowed or denied
+	// regardless of their teams, see Verifier
+	AllowUsers []string
+	DenyUsers  []string
+
+	// Authorize is an optional final step of the decision, see AuthorizeFunc
+	Authorize AuthorizeFunc
+
+	// Snapshots and MaxStaleness enable falling back to recent decisions
+	// during github outages, see Verifier
+	Snapshots    SnapshotStore
+	MaxStaleness time.Duration
+
+	// DirectMembership checks the membership in each configured team
+	// instead of listing every team of the user, see Verifier
+	DirectMembership bool
+
+	// GraphQL checks the membership with a single GraphQL query, see
+	// Verifier
+	GraphQL bool
+
+	// IdPGroups exposes the identity provider groups linked to the matched
+	// team, see Verifier
+	IdPGroups bool
+
+	// Events optionally receives login, denied and error Events from
+	// Verify(), making an audit trail together with FilePublisher or
+	// WebhookPublisher(). OnEventError, if set, is called when publishing
+	// fails
+	Events       Publisher
+	OnEventError func(error)
+
+	// JIT optionally adds members matching its rule to a team on their
+	// first login, see TeamProvisioner
+	JIT *TeamProvisioner
+
+	// Accounts optionally links allowed users to application accounts,
+	// see AccountLinker. When it returns ErrLinkRequired Handler() saves a
+	// pending session and sends the user to LinkURL with ?next=, where the
+	// application calls CompleteLink(). They get a 403 without LinkURL
+	Accounts AccountLinker
+	LinkURL  string
+
+	// Sessions keeps the sessions started by Handler() and checked by
+	// Middleware(), in memory if nil. SessionTTL is how long they last,
+	// 12 hours if zero
+	Sessions   SessionStore
+	SessionTTL time.Duration
+
+	// KeepToken stores the github token of users in their session, so
+	// handlers behind Middleware() can call github on their behalf, see
+	// TokenFromContext(). Keep such sessions server side or encrypted
+	KeepToken bool
+
+	// RevokeOnLogout deletes the github token kept with KeepToken when the
+	// user logs out, see RevokeToken()
+	RevokeOnLogout bool
+
+	// Cache optionally remembers memberships by login so Middleware() can
+	// check them against github again every CacheTTL, 5 minutes if zero,
+	// without sending users through the OAuth2 flow. Users losing access
+	// are signed out. Cached entries include the github token
+	Cache    Cache
+	CacheTTL time.Duration
+
+	// ReverifyEvery, without a Cache, makes Middleware() check sessions
+	// against github again once they are that old, with the token kept by
+	// KeepToken or else ServerToken. Users losing access are signed out
+	ReverifyEvery time.Duration
+
+	// Reverifier, when set, checks the sessions started by Handler() in the
+	// background, Middleware() signs out the users it revoked. Run it, e.g.
+	// with Service.Go(), and set its Verify to c.Verify
+	Reverifier *Reverifier
+
+	// Offline asks github for offline access, and Tokens, when set, keeps
+	// the token of every user signing in through Handler(), see
+	// TokenSource()
+	Offline bool
+	Tokens  TokenStore
+
+	// LoginURL is where Middleware() sends users without a session, the
+	// /login of Handler(). "/login" if empty
+	LoginURL string
+
+	// UI, when set, makes Handler() show a "Sign in with GitHub" page at
+	// /login, and a friendly page to denied users instead of a bare 403
+	UI *UI
+
+	// RequestAccessURL, when set, makes the denial page of UI offer to
+	// request access, posting there. Mount AccessRequestHandler() on it
+	RequestAccessURL string
+
+	// Cookie describes the cookies set by Handler()
+	Cookie CookieOptions
+
+	// RateLimit, when set, limits the hits of each client to /login and
+	// /callback of Handler(), and callbacks per github login
+	RateLimit *RateLimiter
+
+	// HTTPClient, when set, is used for the token exchange and every github
+	// api call made for users, e.g. to go through a proxy or log requests.
+	// Its Transport is wrapped to add the tokens
+	HTTPClient *http.Client
+
+	// Logger, when set, records every verification, with the login, the
+	// decision and how long it took, and every github api call, with its
+	// status and latency, at debug level. Tokens are never logged
+	Logger *slog.Logger
+
+	// Metrics, when set, instruments the code exchange, verifications and
+	// github api calls
+	Metrics Metrics
+
+	// Timeout bounds the token exchange and each github api request, 10
+	// seconds if zero, none if negative. Context deadlines are honored too,
+	// both give ErrTimeout
+	Timeout time.Duration
+
+	// Retries is how many times github api GETs are retried on 502, 503,
+	// 504 and secondary rate limits, see RetryTransport. 2 if zero,
+	// negative disables retries
+	Retries int
+
+	// RateLimitFloor, when set, delays github requests while the remaining
+	// rate limit budget is below it, until the reset or the request
+	// Timeout. See RateLimitStatus()
+	RateLimitFloor int
+
+	// RedirectHosts are other hosts, like app.example.com, users may be sent
+	// back to after login or logout. Otherwise only paths on this site are
+	// accepted as next, so it can't be an open redirect
+	RedirectHosts []string
+
+	// ClientPoolSize is how many github clients of user tokens are kept
+	// for reuse by Verify() and Client(), 1000 if zero. Negative disables
+	// the pool
+	ClientPoolSize int
+
+	// StateKey signs the states made by NewState(). When empty a random key
+	// is used, which only works when the callback reaches the same process
+	StateKey []byte
+
+	cfgOnce      sync.Once
 	cfg          *oauth2.Config
+	sessionsOnce sync.Once
+	flights      singleflight.Group // re-verifications by lowercase login
+	limits       RateLimits
+	clients      clientPool
+	slugs        teamSlugs
+	twoFactorOff twoFactorList
 }
 
 // User returned by CheckPermission()
 type User struct {
+	ID     int64  `json:"id"`         // github user id, never changes unlike Login
 	Login  string `json:"login"`      // github login
 	Name   string `json:"name"`       // github full name
+	Email  string `json:"email"`      // primary verified email, empty without the user:email scope
 	Avatar string `json:"avatar_url"` // github profile image
+
+	// HTMLURL is the github profile page, Company the company in the
+	// profile. TwoFactorEnabled is nil when github doesn't tell
+	HTMLURL          string `json:"html_url"`
+	Company          string `json:"company"`
+	TwoFactorEnabled *bool  `json:"two_factor_authentication,omitempty"`
+
+	// AccountID is the application account linked by Config.Accounts
+	AccountID string `json:"account_id,omitempty"`
+
+	// Extra holds whatever a DecodeUserFunc wants to keep about the user
+	Extra interface{} `json:"-"`
+
+	raw    json.RawMessage // /user response body, for DecodeUserFunc
+	emails json.RawMessage // /user/emails response body, when decide() got it
 }
 
 // AuthCodeURL returns the URL to redirect to so users can go to github
 // enter their credentials and allow access
 //
 // They will return to the callback url. You need to create a callback url
-// and call CheckPermission()
+// and call CheckPermission(), or CheckPermissionContext() to pass on the
+// request context. No request is made here, so there's no context variant
 func (c *Config) AuthCodeURL(state string) string {
-	if c.cfg == nil {
+	return c.oauth2Config().AuthCodeURL(state, c.accessType())
+}
+
+// oauth2Config lazily builds the oauth2.Config used for the whole flow
+func (c *Config) oauth2Config() *oauth2.Config {
+	c.cfgOnce.Do(func() {
 		c.cfg = &oauth2.Config{
 			ClientID:     c.ClientID,
 			ClientSecret: c.ClientSecret,
-			Scopes:       []string{"user:email", "read:org"},
+			Scopes:       c.scopes(),
 			Endpoint:     github.Endpoint,
+			RedirectURL:  c.RedirectURL,
 		}
+	})
+	return c.cfg
+}
+
+// scopes returns the OAuth2 scopes to ask for, repo too with RepoScope
+// since private repositories can't be seen otherwise
+func (c *Config) scopes() []string {
+	if c.RepoScope {
+		return []string{"user:email", "read:org", "repo"}
 	}
+	return []string{"user:email", "read:org"}
+}
 
-	return c.cfg.AuthCodeURL(state, oauth2.AccessTypeOnline)
+// withHTTPClient returns ctx making oauth2 use client, if not nil, for its
+// requests and as base of the clients it returns
+func withHTTPClient(ctx context.Context, client *http.Client) context.Context {
+	if client == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, oauth2.HTTPClient, client)
 }
 
 // team holds all information we need from each team a user belongs
 // to in order to verify if they belong to the Team/Organization we
 // want
 type team struct {
+	ID           int64  `json:"id"`
 	Name         string `json:"name"`
+	Slug         string `json:"slug"`
 	Organization struct {
 		Login string `json:"login"`
 	} `json:"organization"`
+	Parent *struct {
+		Slug string `json:"slug"`
+	} `json:"parent"`
+}
+
+// team converts t to a Team of org, github leaves the organization out of
+// single team responses
+func (t *team) team(org string) Team {
+	if t.Organization.Login != "" {
+		org = t.Organization.Login
+	}
+	own := Team{ID: t.ID, Name: t.Name, Slug: t.Slug, Organization: org}
+	if t.Parent != nil {
+		own.Parent = t.Parent.Slug
+	}
+	return own
 }
 
+// ErrUnauthorized is returned by CheckPermission and UserInfo when github
+// rejects the access token. Every ErrGitHubAPI with a 401 status matches
+// it too with errors.Is()
+var ErrUnauthorized = errors.New("auth: github rejected the access token")
+
+// ErrRateLimited matches, with errors.Is(), ErrGitHubAPI errors caused by
+// the github rate limit
+var ErrRateLimited = errors.New("auth: github rate limit exceeded")
+
 // CheckPermission must be called by your callback url with the OAuth2 authorization
 // code given as GET parameter
 //
-// On success ok will be true and User will have some basic user details
+// On success ok will be true and User will have some basic user details.
 //
 // If the user doesn't belong to the desired Orgazation/Team, return false, user
 // will still be a valid object and err will be nil
 //
 // If an error happens and we can't verify, ok will be false, user will be nil
 // and err will be set
+//
+// Use CheckDecision() if you need to know why the user was denied
 func (c *Config) CheckPermission(code string) (ok bool, user *User, err error) {
-	if c.cfg == nil {
-		c.cfg = &oauth2.Config{
-			ClientID:     c.ClientID,
-			ClientSecret: c.ClientSecret,
-			Scopes:       []string{"user:email", "read:org"},
-			Endpoint:     github.Endpoint,
-		}
-	}
-
-	// exchange oauth2 authorization code (retrieved from the callback url)
-	// by an access token
+	return c.CheckPermissionContext(context.Background(), code)
+}
 
-	token, err := c.cfg.Exchange(oauth2.NoContext, code)
+// CheckPermissionContext is CheckPermission() using ctx for the token
+// exchange and every github request, so callers can apply request deadlines
+// and cancel in-flight calls. It's a wrapper of AuthenticateCode()
+func (c *Config) CheckPermissionContext(ctx context.Context, code string) (ok bool, user *User, err error) {
+	result, err := c.AuthenticateCode(ctx, code)
 	if err != nil {
 		return false, nil, err
 	}
-
-	// create a http client authorized to make requests to github api
-	// using an access token
-
-	client := c.cfg.Client(oauth2.NoContext, token)
-
-	// get a list of all teams the current user belongs to
-
-	var teams []team
-	resp, err := client.Get("https://api.github.com/user/teams")
-	if err != nil {
-		return false, nil, err
+	if result.DeniedReason == TokenInvalid {
+		return false, nil, ErrUnauthorized
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&teams); err != nil {
-		return false, nil, err
-	}
-	resp.Body.Close()
 
-	// get user details
+	return result.Allowed, result.User, nil
+}
+
+// CheckPermissionWithToken works like CheckPermission() but for flows where
+// the token exchange already happened somewhere else (mobile backends, device
+// flow, stored tokens). Only the user and membership verification is done.
+//
+// A raw access token string can be used as &oauth2.Token{AccessToken: s}
+func (c *Config) CheckPermissionWithToken(token *oauth2.Token) (ok bool, user *User, err error) {
+	return c.CheckPermissionWithTokenContext(context.Background(), token)
+}
 
-	user = new(User)
-	resp, err = client.Get("https://api.github.com/user")
+// CheckPermissionWithTokenContext is CheckPermissionWithToken() using ctx
+// for every github request
+func (c *Config) CheckPermissionWithTokenContext(ctx context.Context, token *oauth2.Token) (ok bool, user *User, err error) {
+	decision, user, err := c.Verify(ctx, token)
 	if err != nil {
 		return false, nil, err
 	}
-	if err := json.NewDecoder(resp.Body).Decode(user); err != nil {
-		return false, nil, err
+	if decision.Reason == TokenInvalid {
+		return false, nil, ErrUnauthorized
 	}
-	resp.Body.Close()
-
-	// check if user belongs to team
-
-	for _, t := range teams {
-		if t.Name == c.Team && t.Organization.Login == c.Organization {
-			return true, user, nil
-		}
-	}
-
-	return false, user, nil
 
+	return decision.Allowed, user, nil
 }
@@ -0,0 +1,53 @@
+package auth
+
+import "context"
+
+// Authorizer replaces the built-in team rule. It's given every team of the
+// user in Organization, nil without read:org or in DirectMembership mode,
+// and decides whether they get in: role in a team, repository
+// collaborator, time of day... TeamAuthorizer() is the built-in rule, for
+// Authorizers building on it
+type Authorizer interface {
+	Authorize(ctx context.Context, user *User, teams []Team) (bool, error)
+}
+
+// AuthorizerFunc adapts a function to an Authorizer
+type AuthorizerFunc func(ctx context.Context, user *User, teams []Team) (bool, error)
+
+// Authorize implements Authorizer
+func (f AuthorizerFunc) Authorize(ctx context.Context, user *User, teams []Team) (bool, error) {
+	return f(ctx, user, teams)
+}
+
+// TeamAuthorizer returns the built-in rule: membership in Team, AllowedTeams,
+// TeamIDs or TeamRegexps, honoring RequireAll. Organization-wide access can't
+// be told from the teams, it denies everybody when there's no team rule
+func (c *Config) TeamAuthorizer() Authorizer {
+	return c.verifier().TeamAuthorizer()
+}
+
+// TeamAuthorizer is Config.TeamAuthorizer() for v
+func (v *Verifier) TeamAuthorizer() Authorizer {
+	return AuthorizerFunc(func(ctx context.Context, user *User, teams []Team) (bool, error) {
+		return v.matchTeams(teams) != nil, nil
+	})
+}
+
+// authorizer asks v.Authorizer, if any, about user instead of the team rule.
+// Users it denies get DeniedByPolicy, unless they were denied already
+func (v *Verifier) authorizer(ctx context.Context, user *User, decision Decision) (Decision, error) {
+	if v.Authorizer == nil || decision.Reason == TokenInvalid {
+		return decision, nil
+	}
+	ok, err := v.Authorizer.Authorize(ctx, user, decision.Teams)
+	if err != nil {
+		return Decision{}, err
+	}
+	switch {
+	case ok && !decision.Allowed:
+		return Decision{Allowed: true, Teams: decision.Teams}, nil
+	case !ok && decision.Allowed:
+		return Decision{Reason: DeniedByPolicy, Teams: decision.Teams}, nil
+	}
+	return decision, nil
+}
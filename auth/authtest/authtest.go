@@ -0,0 +1,289 @@
+// Package authtest is a fake github, OAuth2 and api, for testing apps using
+// auth without hand-rolling httptest servers:
+//
+//	gh := authtest.NewServer()
+//	defer gh.Close()
+//	gh.AddUser("token", authtest.User{Login: "alice", Teams: []authtest.Team{{Organization: "myorg", Slug: "eng"}}})
+//	cfg := &auth.Config{Organization: "myorg", Team: "eng", ClientID: "id", ClientSecret: "secret"}
+//	gh.Configure(cfg)
+//	ok, user, err := cfg.CheckPermission("token")
+//
+// Authorization codes are exchanged for the token with the same value
+package authtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RealGeeks/github-org-auth/auth"
+)
+
+// User is a github user known to the Server
+type User struct {
+	ID     int64
+	Login  string
+	Name   string
+	Email  string // primary verified email
+	Avatar string
+	Teams  []Team
+
+	// Orgs are the organizations the user belongs to besides those of
+	// Teams, mapped to the membership state, active or pending
+	Orgs map[string]string
+
+	// Public are the organizations the user is a public member of
+	Public []string
+
+	// Scopes granted to the token, "user:email, read:org" if empty
+	Scopes string
+}
+
+// Team is a team of a User
+type Team struct {
+	ID           int64
+	Name         string // Slug if empty
+	Slug         string
+	Organization string
+	Role         string // member if empty
+}
+
+// Server is a fake github, safe for concurrent use
+type Server struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	users  map[string]*User // by token
+	fails  map[string]int   // path -> status
+	limits bool
+}
+
+// NewServer starts a Server, Close it when done
+func NewServer() *Server {
+	s := &Server{users: make(map[string]*User), fails: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// AddUser makes token, and the authorization code with the same value,
+// belong to u
+func (s *Server) AddUser(token string, u User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[token] = &u
+}
+
+// Fail makes every request to path, like /user/teams, answer status.
+// A zero status stops failing
+func (s *Server) Fail(path string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if status == 0 {
+		delete(s.fails, path)
+		return
+	}
+	s.fails[path] = status
+}
+
+// RateLimit makes every api request fail with github rate limit response
+// while on is true
+func (s *Server) RateLimit(on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limits = on
+}
+
+// Client returns an http.Client sending every request for github.com and
+// api.github.com to the Server
+func (s *Server) Client() *http.Client {
+	u, _ := url.Parse(s.URL)
+	return &http.Client{Transport: &rewriter{target: u, base: http.DefaultTransport}}
+}
+
+// Configure points c at the Server
+func (s *Server) Configure(c *auth.Config) {
+	c.HTTPClient = s.Client()
+}
+
+// ConfigureVerifier points v at the Server
+func (s *Server) ConfigureVerifier(v *auth.Verifier) {
+	v.HTTPClient = s.Client()
+}
+
+// rewriter sends github requests to target, keeping the path
+type rewriter struct {
+	target *url.URL
+	base   http.RoundTripper
+}
+
+func (t *rewriter) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Host != "github.com" && r.URL.Host != "api.github.com" {
+		return t.base.RoundTrip(r)
+	}
+	r2 := r.Clone(r.Context())
+	r2.URL.Scheme = t.target.Scheme
+	r2.URL.Host = t.target.Host
+	r2.Host = t.target.Host
+
+	// keep the api and the web flow apart, both serve /user paths
+
+	if r.URL.Host == "github.com" {
+		r2.URL.Path = "/web" + r.URL.Path
+	}
+	return t.base.RoundTrip(r2)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.URL.Path == "/web/login/oauth/access_token" {
+		s.exchange(w, r)
+		return
+	}
+	if status, ok := s.fails[r.URL.Path]; ok {
+		http.Error(w, `{"message":"scripted failure"}`, status)
+		return
+	}
+	if s.limits {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+		http.Error(w, `{"message":"API rate limit exceeded"}`, http.StatusForbidden)
+		return
+	}
+
+	u, ok := s.users[bearer(r)]
+	if !ok {
+		http.Error(w, `{"message":"Bad credentials"}`, http.StatusUnauthorized)
+		return
+	}
+	scopes := u.Scopes
+	if scopes == "" {
+		scopes = "user:email, read:org"
+	}
+	w.Header().Set("X-OAuth-Scopes", scopes)
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/user":
+		writeJSON(w, map[string]interface{}{"id": u.ID, "login": u.Login, "name": u.Name, "avatar_url": u.Avatar})
+	case r.URL.Path == "/user/emails":
+		var emails []map[string]interface{}
+		if u.Email != "" {
+			emails = append(emails, map[string]interface{}{"email": u.Email, "primary": true, "verified": true})
+		}
+		writeJSON(w, emails)
+	case r.URL.Path == "/user/teams":
+		var teams []map[string]interface{}
+		for _, t := range u.Teams {
+			teams = append(teams, map[string]interface{}{
+				"id":           t.ID,
+				"name":         t.name(),
+				"slug":         t.Slug,
+				"organization": map[string]string{"login": t.Organization},
+			})
+		}
+		writeJSON(w, teams)
+	case len(parts) == 4 && parts[0] == "user" && parts[1] == "memberships" && parts[2] == "orgs":
+		state := u.orgState(parts[3])
+		if state == "" {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, map[string]string{"state": state, "role": "member"})
+	case len(parts) == 2 && parts[0] == "orgs":
+		writeJSON(w, map[string]string{"login": parts[1]})
+	case len(parts) == 4 && parts[0] == "orgs" && parts[2] == "public_members":
+		for _, org := range u.Public {
+			if strings.EqualFold(org, parts[1]) && strings.EqualFold(parts[3], u.Login) {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	case len(parts) == 6 && parts[0] == "orgs" && parts[2] == "teams" && parts[4] == "memberships":
+		if t := u.team(parts[1], parts[3]); t != nil && strings.EqualFold(parts[5], u.Login) {
+			writeJSON(w, map[string]string{"state": "active", "role": t.role()})
+			return
+		}
+		http.NotFound(w, r)
+	case len(parts) == 4 && parts[0] == "orgs" && parts[2] == "teams":
+		if t := u.team(parts[1], parts[3]); t != nil {
+			writeJSON(w, map[string]interface{}{"id": t.ID, "name": t.name(), "slug": t.Slug})
+			return
+		}
+		http.NotFound(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// exchange trades an authorization code for the token of the same value
+func (s *Server) exchange(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	code := r.FormValue("code")
+	if _, ok := s.users[code]; !ok {
+		writeJSON(w, map[string]string{"error": "bad_verification_code"})
+		return
+	}
+	writeJSON(w, map[string]string{"access_token": code, "token_type": "bearer", "scope": "user:email,read:org"})
+}
+
+// orgState returns the membership state of u in org, empty if none
+func (u *User) orgState(org string) string {
+	for o, state := range u.Orgs {
+		if strings.EqualFold(o, org) {
+			return state
+		}
+	}
+	for _, t := range u.Teams {
+		if strings.EqualFold(t.Organization, org) {
+			return "active"
+		}
+	}
+	return ""
+}
+
+// team returns the team of u with slug in org, nil if none
+func (u *User) team(org, slug string) *Team {
+	for i, t := range u.Teams {
+		if strings.EqualFold(t.Organization, org) && strings.EqualFold(t.Slug, slug) {
+			return &u.Teams[i]
+		}
+	}
+	return nil
+}
+
+func (t Team) name() string {
+	if t.Name == "" {
+		return t.Slug
+	}
+	return t.Name
+}
+
+func (t Team) role() string {
+	if t.Role == "" {
+		return "member"
+	}
+	return t.Role
+}
+
+// bearer returns the token of the Authorization header of r, which oauth2
+// and auth send as Bearer or token
+func bearer(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if i := strings.IndexByte(h, ' '); i >= 0 {
+		return strings.TrimSpace(h[i+1:])
+	}
+	return ""
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
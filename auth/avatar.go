@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// validLogin matches github logins, so we never proxy arbitrary urls
+var validLogin = regexp.MustCompile(`^[A-Za-z0-9](?:[A-Za-z0-9-]{0,38})$`)
+
+// AvatarProxy is an optional http.Handler that proxies and caches github
+// avatars, so internal tools behind strict egress policies or CSPs can show
+// them without loading them from githubusercontent.com
+//
+// Mount it with http.StripPrefix so the remaining path is the github login,
+// and ask for a size variant with the s parameter:
+//
+//	http.Handle("/avatars/", http.StripPrefix("/avatars/", &auth.AvatarProxy{}))
+//	<img src="/avatars/octocat?s=64">
+type AvatarProxy struct {
+	Client     *http.Client  // client used to fetch avatars, http.DefaultClient if nil
+	TTL        time.Duration // how long avatars are cached, 1 hour if zero
+	MaxEntries int           // cached avatars limit, 1000 if zero
+	MaxSize    int           // biggest size variant allowed, 460 if zero
+
+	mu    sync.Mutex
+	cache map[string]*avatar
+}
+
+// avatar is a cached image
+type avatar struct {
+	body        []byte
+	contentType string
+	expires     time.Time
+}
+
+// maxAvatarBytes protects us from huge responses
+const maxAvatarBytes = 1 << 20
+
+func (p *AvatarProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	login := strings.Trim(r.URL.Path, "/")
+	if !validLogin.MatchString(login) {
+		http.NotFound(w, r)
+		return
+	}
+
+	size := 0
+	if s := r.URL.Query().Get("s"); s != "" {
+		var err error
+		size, err = strconv.Atoi(s)
+		if err != nil || size < 1 || size > p.maxSize() {
+			http.Error(w, "invalid avatar size", http.StatusBadRequest)
+			return
+		}
+	}
+
+	a, err := p.get(login, size)
+	if err != nil {
+		http.Error(w, "avatar unavailable", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", a.contentType)
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(p.ttl().Seconds())))
+	w.Write(a.body)
+}
+
+// get returns the avatar of login at size from cache, fetching it from
+// github when missing or expired
+func (p *AvatarProxy) get(login string, size int) (*avatar, error) {
+	key := strings.ToLower(login) + "@" + strconv.Itoa(size)
+
+	p.mu.Lock()
+	a, ok := p.cache[key]
+	p.mu.Unlock()
+	if ok && time.Now().Before(a.expires) {
+		return a, nil
+	}
+
+	url := "https://github.com/" + login + ".png"
+	if size > 0 {
+		url += "?size=" + strconv.Itoa(size)
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxAvatarBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	a = &avatar{
+		body:        body,
+		contentType: resp.Header.Get("Content-Type"),
+		expires:     time.Now().Add(p.ttl()),
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cache == nil {
+		p.cache = make(map[string]*avatar)
+	}
+	if len(p.cache) >= p.maxEntries() {
+		p.evict()
+	}
+	p.cache[key] = a
+	return a, nil
+}
+
+// evict drops expired avatars, or everything if none expired. Must be called
+// with p.mu held
+func (p *AvatarProxy) evict() {
+	now := time.Now()
+	for k, a := range p.cache {
+		if now.After(a.expires) {
+			delete(p.cache, k)
+		}
+	}
+	if len(p.cache) >= p.maxEntries() {
+		p.cache = make(map[string]*avatar)
+	}
+}
+
+func (p *AvatarProxy) ttl() time.Duration {
+	if p.TTL == 0 {
+		return time.Hour
+	}
+	return p.TTL
+}
+
+func (p *AvatarProxy) maxEntries() int {
+	if p.MaxEntries == 0 {
+		return 1000
+	}
+	return p.MaxEntries
+}
+
+func (p *AvatarProxy) maxSize() int {
+	if p.MaxSize == 0 {
+		return 460
+	}
+	return p.MaxSize
+}
@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimit is the github rate limit budget of one token for one resource,
+// as of the last response
+type RateLimit struct {
+	Token     string    `json:"token"`    // start of the token hash, never the token itself
+	Resource  string    `json:"resource"` // core, graphql...
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+}
+
+// RateLimits tracks the rate limits github reports in its responses. The
+// budget belongs to the token of each request, so it's kept per token:
+// every user has their own, requests made with a ServerToken or an app
+// installation share theirs. Budgets are forgotten once they reset
+type RateLimits struct {
+	mu     sync.Mutex
+	limits map[string]RateLimit // by token hash and resource
+}
+
+// Status returns the last budget seen for every token and resource which
+// didn't reset yet
+func (l *RateLimits) Status() []RateLimit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	list := make([]RateLimit, 0, len(l.limits))
+	for _, limit := range l.limits {
+		if now.Before(limit.Reset) {
+			list = append(list, limit)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Token != list[j].Token {
+			return list[i].Token < list[j].Token
+		}
+		return list[i].Resource < list[j].Resource
+	})
+	return list
+}
+
+// budgetKey identifies the token of r in RateLimits
+func budgetKey(r *http.Request) string {
+	return hashKey(r.Header.Get("Authorization"))[:12]
+}
+
+// observe records the rate limit headers of resp, for token
+func (l *RateLimits) observe(token string, resp *http.Response) {
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	limit, _ := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+	reset, _ := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	resource := resp.Header.Get("X-RateLimit-Resource")
+	if resource == "" {
+		resource = "core"
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limits == nil {
+		l.limits = make(map[string]RateLimit)
+	}
+	if len(l.limits) > 10000 {
+		now := time.Now()
+		for k, old := range l.limits {
+			if !now.Before(old.Reset) {
+				delete(l.limits, k)
+			}
+		}
+	}
+	l.limits[token+" "+resource] = RateLimit{Token: token, Resource: resource, Limit: limit, Remaining: remaining, Reset: time.Unix(reset, 0)}
+}
+
+// wait blocks until the reset of resource for token while its remaining
+// budget is below floor, or until ctx is done
+func (l *RateLimits) wait(ctx context.Context, token, resource string, floor int) error {
+	l.mu.Lock()
+	limit, ok := l.limits[token+" "+resource]
+	l.mu.Unlock()
+	if !ok || limit.Remaining >= floor || !time.Now().Before(limit.Reset) {
+		return nil
+	}
+	t := time.NewTimer(time.Until(limit.Reset))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RateLimitStatus returns the github rate limit budgets as last seen by c,
+// per token and resource
+func (c *Config) RateLimitStatus() []RateLimit {
+	return c.limits.Status()
+}
+
+// rateLimitClient returns a copy of base recording the rate limits of every
+// response in limits, and delaying requests while the budget is below
+// floor. base itself if limits is nil
+func rateLimitClient(base *http.Client, limits *RateLimits, floor int) *http.Client {
+	if limits == nil {
+		return base
+	}
+	if base == nil {
+		base = http.DefaultClient
+	}
+	c := *base
+	c.Transport = &rateLimitTransport{base: base.Transport, limits: limits, floor: floor}
+	return &c
+}
+
+// rateLimitTransport feeds a RateLimits
+type rateLimitTransport struct {
+	base   http.RoundTripper
+	limits *RateLimits
+	floor  int
+}
+
+func (t *rateLimitTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	token := budgetKey(r)
+	if t.floor > 0 {
+		resource := "core"
+		if r.URL.Path == "/graphql" {
+			resource = "graphql"
+		}
+		if err := t.limits.wait(r.Context(), token, resource, t.floor); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := base.RoundTrip(r)
+	if err == nil {
+		t.limits.observe(token, resp)
+	}
+	return resp, err
+}
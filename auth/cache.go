@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrNotCached is returned by ReverifyMembership() for users without a
+// cached membership
+var ErrNotCached = errors.New("auth: membership not cached")
+
+// Membership is a verified decision cached by user login, together with the
+// token needed to check it again without sending the user through github
+type Membership struct {
+	Decision Decision      `json:"decision"`
+	User     *User         `json:"user"`
+	Token    *oauth2.Token `json:"token"`
+	Checked  time.Time     `json:"checked"` // when github last confirmed the decision
+}
+
+// Cache keeps Memberships by lowercase login. Entries may be dropped after
+// ttl, see Config.Cache. Implementations must be safe for concurrent use
+type Cache interface {
+	Get(ctx context.Context, login string) (Membership, bool, error)
+	Set(ctx context.Context, login string, m Membership, ttl time.Duration) error
+	Delete(ctx context.Context, login string) error
+}
+
+// Remember caches the membership of user, Handler() does it after every
+// login. It's a no-op without Config.Cache. Stale decisions weren't
+// confirmed by github, they keep the check time of the cached entry, if
+// any, so they are checked again once it's older than CacheTTL
+func (c *Config) Remember(ctx context.Context, user *User, decision Decision, token *oauth2.Token) error {
+	if c.Cache == nil || user == nil {
+		return nil
+	}
+	login := strings.ToLower(user.Login)
+	checked := time.Now()
+	if decision.Stale {
+		old, ok, err := c.Cache.Get(ctx, login)
+		if err != nil {
+			return err
+		}
+		checked = time.Time{}
+		if ok {
+			checked = old.Checked
+		}
+	}
+	m := Membership{Decision: decision, User: user, Token: token, Checked: checked}
+	return c.Cache.Set(ctx, login, m, c.sessionTTL())
+}
+
+// ReverifyMembership returns the cached decision for login, checking it
+// against github again when older than CacheTTL, using the remembered token
+// instead of a full OAuth2 round trip. Users never remembered get
+// ErrNotCached
+func (c *Config) ReverifyMembership(ctx context.Context, login string) (Decision, error) {
+	if c.Cache == nil {
+		return Decision{}, ErrNotCached
+	}
+	m, ok, err := c.Cache.Get(ctx, strings.ToLower(login))
+	if err != nil {
+		return Decision{}, err
+	}
+	if !ok {
+		return Decision{}, ErrNotCached
+	}
+	if time.Since(m.Checked) < c.cacheTTL() {
+		return m.Decision, nil
+	}
+
+	// parallel requests of a user share one check
+
+	return c.shared(ctx, login, func(ctx context.Context) (Decision, error) {
+		decision, user, err := c.Verify(ctx, m.Token)
+		if err != nil && err != ErrLinkRequired {
+			return Decision{}, err
+		}
+		if user == nil || !decision.Allowed {
+			return decision, c.Cache.Delete(ctx, strings.ToLower(login))
+		}
+		return decision, c.Remember(ctx, user, decision, m.Token)
+	})
+}
+
+// shared runs check for login unless a check of theirs is already running,
+// then its outcome is returned instead. check gets ctx without its
+// cancelation, bounded by Timeout, so the request which started it going
+// away doesn't fail the others. Callers still stop waiting when ctx is done
+func (c *Config) shared(ctx context.Context, login string, check func(ctx context.Context) (Decision, error)) (Decision, error) {
+	ch := c.flights.DoChan(strings.ToLower(login), func() (interface{}, error) {
+		ctx := context.WithoutCancel(ctx)
+		if t := c.timeout(); t > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, t)
+			defer cancel()
+		}
+		return check(ctx)
+	})
+	select {
+	case res := <-ch:
+		decision, _ := res.Val.(Decision)
+		return decision, res.Err
+	case <-ctx.Done():
+		return Decision{}, ctx.Err()
+	}
+}
+
+func (c *Config) cacheTTL() time.Duration {
+	if c.CacheTTL == 0 {
+		return 5 * time.Minute
+	}
+	return c.CacheTTL
+}
+
+// MemoryCache is an in memory Cache
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// cacheEntry is a Membership kept by MemoryCache
+type cacheEntry struct {
+	membership Membership
+	expires    time.Time
+}
+
+// Get implements Cache
+func (m *MemoryCache) Get(ctx context.Context, login string) (Membership, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[login]
+	if !ok || time.Now().After(e.expires) {
+		return Membership{}, false, nil
+	}
+	return e.membership, true, nil
+}
+
+// Set implements Cache
+func (m *MemoryCache) Set(ctx context.Context, login string, membership Membership, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.entries == nil {
+		m.entries = make(map[string]cacheEntry)
+	}
+	m.entries[login] = cacheEntry{membership: membership, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+// Delete implements Cache
+func (m *MemoryCache) Delete(ctx context.Context, login string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, login)
+	return nil
+}
+
+// Sweep implements Sweeper, dropping expired entries
+func (m *MemoryCache) Sweep(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for k, e := range m.entries {
+		if time.Now().After(e.expires) {
+			delete(m.entries, k)
+			n++
+		}
+	}
+	return n, nil
+}
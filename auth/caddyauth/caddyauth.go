@@ -0,0 +1,171 @@
+// Package caddyauth packages the auth token verification as a Caddy HTTP
+// handler module, so Caddy users can enforce github org/team auth without
+// writing a separate service
+//
+// Tokens are the ones minted by auth.TokenIssuer, e.g. by the
+// github-org-auth session command or by your login service, sent as a bearer
+// token or in a cookie. Caddyfile:
+//
+//	github_org_auth {
+//		key_file   /etc/caddy/auth.key
+//		issuer     auth.example.com
+//		cookie     auth_token
+//		login_url  https://auth.example.com/login
+//		roles      admin viewer
+//	}
+//
+// Authenticated requests get the X-Auth-User and X-Auth-Teams headers, and
+// the {http.vars.github_org_auth.login} placeholder
+package caddyauth
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/RealGeeks/github-org-auth/auth"
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func init() {
+	caddy.RegisterModule(Handler{})
+	httpcaddyfile.RegisterHandlerDirective("github_org_auth", parseCaddyfile)
+}
+
+// Handler only lets requests carrying a valid token through
+type Handler struct {
+	KeyFile  string   `json:"key_file"`            // HMAC key tokens are signed with
+	Issuer   string   `json:"issuer,omitempty"`    // required iss claim, if set
+	Cookie   string   `json:"cookie,omitempty"`    // cookie holding the token, besides the Authorization header
+	LoginURL string   `json:"login_url,omitempty"` // where browsers without a token go, 401 if empty
+	Roles    []string `json:"roles,omitempty"`     // if set, users need any of these roles
+
+	issuer *auth.TokenIssuer
+}
+
+// CaddyModule returns the Caddy module information
+func (Handler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.github_org_auth",
+		New: func() caddy.Module { return new(Handler) },
+	}
+}
+
+// Provision reads the signing key
+func (h *Handler) Provision(ctx caddy.Context) error {
+	key, err := os.ReadFile(h.KeyFile)
+	if err != nil {
+		return err
+	}
+	h.issuer = &auth.TokenIssuer{Keys: [][]byte{bytes.TrimSpace(key)}, Issuer: h.Issuer}
+	return nil
+}
+
+// Validate makes sure the configuration makes sense
+func (h *Handler) Validate() error {
+	if h.KeyFile == "" {
+		return errMissingKeyFile
+	}
+	return nil
+}
+
+// ServeHTTP implements caddyhttp.MiddlewareHandler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	claims, err := h.issuer.Verify(h.token(r))
+	if err != nil {
+		if h.LoginURL != "" && r.Method == "GET" {
+			http.Redirect(w, r, h.LoginURL+"?rd="+url.QueryEscape(r.URL.String()), http.StatusFound)
+			return nil
+		}
+		return caddyhttp.Error(http.StatusUnauthorized, err)
+	}
+	if !h.hasRole(claims) {
+		return caddyhttp.Error(http.StatusForbidden, auth.ErrNotAllowed)
+	}
+
+	r.Header.Set("X-Auth-User", claims.Login)
+	r.Header.Set("X-Auth-Teams", strings.Join(claims.Teams, ","))
+	caddyhttp.SetVar(r.Context(), "github_org_auth.login", claims.Login)
+	return next.ServeHTTP(w, r)
+}
+
+// token finds the token in the Authorization header or the cookie
+func (h *Handler) token(r *http.Request) string {
+	if a := r.Header.Get("Authorization"); strings.HasPrefix(a, "Bearer ") {
+		return strings.TrimPrefix(a, "Bearer ")
+	}
+	if h.Cookie != "" {
+		if c, err := r.Cookie(h.Cookie); err == nil {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+// hasRole reports whether claims has any of the required Roles
+func (h *Handler) hasRole(claims *auth.Claims) bool {
+	if len(h.Roles) == 0 {
+		return true
+	}
+	for _, want := range h.Roles {
+		for _, have := range claims.Roles {
+			if want == have {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// UnmarshalCaddyfile sets up the handler from Caddyfile tokens
+func (h *Handler) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		for d.NextBlock(0) {
+			var target *string
+			switch d.Val() {
+			case "key_file":
+				target = &h.KeyFile
+			case "issuer":
+				target = &h.Issuer
+			case "cookie":
+				target = &h.Cookie
+			case "login_url":
+				target = &h.LoginURL
+			case "roles":
+				h.Roles = append(h.Roles, d.RemainingArgs()...)
+				continue
+			default:
+				return d.Errf("unknown subdirective %q", d.Val())
+			}
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			*target = d.Val()
+		}
+	}
+	return nil
+}
+
+// parseCaddyfile builds the handler for the github_org_auth directive
+func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	m := new(Handler)
+	err := m.UnmarshalCaddyfile(h.Dispenser)
+	return m, err
+}
+
+// errMissingKeyFile is returned by Validate without a key_file
+var errMissingKeyFile = errors.New("caddyauth: key_file is required")
+
+// Interface guards
+var (
+	_ caddy.Provisioner           = (*Handler)(nil)
+	_ caddy.Validator             = (*Handler)(nil)
+	_ caddyhttp.MiddlewareHandler = (*Handler)(nil)
+	_ caddyfile.Unmarshaler       = (*Handler)(nil)
+)
@@ -0,0 +1,36 @@
+// Package chiauth adapts auth to chi, which uses plain net/http handlers
+//
+//	r := chi.NewRouter()
+//	r.Route("/auth", chiauth.Routes(cfg))
+//	r.Group(func(r chi.Router) {
+//		r.Use(chiauth.Middleware(cfg))
+//		...
+//	})
+//
+// with cfg.LoginURL set to "/auth/login". Handlers get the user with
+// auth.UserFromContext()
+package chiauth
+
+import (
+	"net/http"
+
+	"github.com/RealGeeks/github-org-auth/auth"
+	"github.com/go-chi/chi/v5"
+)
+
+// Routes returns a chi.Router.Route() callback serving the login, callback
+// and logout endpoints of cfg.Handler()
+func Routes(cfg *auth.Config) func(r chi.Router) {
+	return func(r chi.Router) {
+		h := cfg.Handler()
+		r.Get("/login", h.ServeHTTP)
+		r.Get("/callback", h.ServeHTTP)
+		r.Get("/logout", h.ServeHTTP)
+		r.Post("/logout", h.ServeHTTP)
+	}
+}
+
+// Middleware returns cfg.Middleware() as chi middleware
+func Middleware(cfg *auth.Config) func(next http.Handler) http.Handler {
+	return cfg.Middleware
+}
@@ -0,0 +1,51 @@
+package auth
+
+// Claims is what gets embedded about the user in issued tokens and sessions,
+// so downstream services can make authorization decisions without calling
+// back to github or to us
+type Claims struct {
+	Login string   `json:"login"`           // github login
+	ID    int64    `json:"uid,omitempty"`   // github user id
+	Name  string   `json:"name,omitempty"`  // github full name
+	Email string   `json:"email,omitempty"` // primary verified email
+	Teams []string `json:"teams,omitempty"` // matched teams as org/slug
+	Roles []string `json:"roles,omitempty"` // application roles mapped from the teams
+
+	// IdPGroups are the names of the identity provider groups linked to
+	// the matched team, see Config.IdPGroups
+	IdPGroups []string `json:"idp_groups,omitempty"`
+
+	// AccountID is the application account linked to the github user
+	AccountID string `json:"account_id,omitempty"`
+
+	// registered JWT claims, set by TokenIssuer
+	Issuer    string `json:"iss,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+// ClaimsFunc builds the payload stored about an allowed user instead of the
+// default one, so apps decide what, and how much, ends up in sessions and
+// tokens. teams are the teams of the user in Organization. The result must
+// marshal to json
+type ClaimsFunc func(user *User, teams []Team) (map[string]interface{}, error)
+
+// NewClaims builds the Claims for an allowed user
+func NewClaims(user *User, decision Decision) Claims {
+	claims := Claims{
+		Login: user.Login,
+		ID:    user.ID,
+		Name:  user.Name,
+		Email: user.Email,
+		Roles: decision.Roles,
+
+		AccountID: user.AccountID,
+	}
+	if decision.Team != nil {
+		claims.Teams = []string{decision.Team.Organization + "/" + decision.Team.Slug}
+		for _, g := range decision.Team.IdPGroups {
+			claims.IdPGroups = append(claims.IdPGroups, g.Name)
+		}
+	}
+	return claims
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// clientPool keeps the github clients of recently seen tokens, so requests
+// re-verified by Middleware don't build a client each time and refreshed
+// tokens are reused instead of refreshed again. It's an LRU bounded by size
+type clientPool struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   list.List // most recently used first, of *pooledClient
+}
+
+// pooledClient is a clientPool entry
+type pooledClient struct {
+	key    string
+	client *http.Client
+}
+
+// get returns the client for key, calling create when it isn't pooled and
+// evicting the least recently used clients beyond size
+func (p *clientPool) get(key string, size int, create func() *http.Client) *http.Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e, ok := p.entries[key]; ok {
+		p.order.MoveToFront(e)
+		return e.Value.(*pooledClient).client
+	}
+	if p.entries == nil {
+		p.entries = make(map[string]*list.Element)
+	}
+	client := create()
+	p.entries[key] = p.order.PushFront(&pooledClient{key: key, client: client})
+	for p.order.Len() > size {
+		oldest := p.order.Back()
+		p.order.Remove(oldest)
+		delete(p.entries, oldest.Value.(*pooledClient).key)
+	}
+	return client
+}
+
+// userClient returns the client making requests on behalf of the user
+// owning token, from the pool unless ClientPoolSize is negative. Pooled
+// clients refresh expired tokens once and keep the result
+func (c *Config) userClient(ctx context.Context, token *oauth2.Token) *http.Client {
+	if c.ClientPoolSize < 0 || token.AccessToken == "" {
+		return c.oauth2Config().Client(withHTTPClient(ctx, c.httpClient()), token)
+	}
+	size := c.ClientPoolSize
+	if size == 0 {
+		size = 1000
+	}
+	return c.clients.get(hashKey(token.AccessToken), size, func() *http.Client {
+		// the pooled client outlives ctx, refreshes aren't tied to it
+
+		ctx := withHTTPClient(context.Background(), c.httpClient())
+		return oauth2.NewClient(ctx, oauth2.ReuseTokenSource(token, c.oauth2Config().TokenSource(ctx, token)))
+	})
+}
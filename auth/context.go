@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"context"
+
+	"golang.org/x/oauth2"
+)
+
+// contextKey is unexported so no other package can collide with our keys
+type contextKey int
+
+const (
+	userKey contextKey = iota
+	decisionKey
+	machineKey
+	serviceTokenKey
+	oauthTokenKey
+	claimsKey
+	clientIPKey
+)
+
+// WithUser returns a copy of ctx carrying the authenticated user. Every
+// adapter and handler should use it, together with UserFromContext(), instead
+// of inventing their own key
+func WithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, userKey, user)
+}
+
+// UserFromContext returns the user stored by WithUser(), ok is false if there
+// isn't one
+func UserFromContext(ctx context.Context) (user *User, ok bool) {
+	user, ok = ctx.Value(userKey).(*User)
+	return user, ok && user != nil
+}
+
+// WithDecision returns a copy of ctx carrying the Decision made for the user
+func WithDecision(ctx context.Context, decision Decision) context.Context {
+	return context.WithValue(ctx, decisionKey, decision)
+}
+
+// DecisionFromContext returns the Decision stored by WithDecision(), ok is
+// false if there isn't one
+func DecisionFromContext(ctx context.Context) (decision Decision, ok bool) {
+	decision, ok = ctx.Value(decisionKey).(Decision)
+	return decision, ok
+}
+
+// WithMachine returns a copy of ctx carrying the authenticated Machine
+func WithMachine(ctx context.Context, m *Machine) context.Context {
+	return context.WithValue(ctx, machineKey, m)
+}
+
+// MachineFromContext returns the Machine stored by WithMachine(), ok is
+// false if there isn't one
+func MachineFromContext(ctx context.Context) (m *Machine, ok bool) {
+	m, ok = ctx.Value(machineKey).(*Machine)
+	return m, ok && m != nil
+}
+
+// WithServiceToken returns a copy of ctx carrying the ServiceToken the
+// request authenticated with
+func WithServiceToken(ctx context.Context, t *ServiceToken) context.Context {
+	return context.WithValue(ctx, serviceTokenKey, t)
+}
+
+// ServiceTokenFromContext returns the ServiceToken stored by
+// WithServiceToken(), ok is false if there isn't one
+func ServiceTokenFromContext(ctx context.Context) (t *ServiceToken, ok bool) {
+	t, ok = ctx.Value(serviceTokenKey).(*ServiceToken)
+	return t, ok && t != nil
+}
+
+// WithToken returns a copy of ctx carrying the github token of the user
+func WithToken(ctx context.Context, token *oauth2.Token) context.Context {
+	return context.WithValue(ctx, oauthTokenKey, token)
+}
+
+// TokenFromContext returns the token stored by WithToken(), ok is false if
+// there isn't one. Config.Middleware() only stores it with KeepToken set
+func TokenFromContext(ctx context.Context) (token *oauth2.Token, ok bool) {
+	token, ok = ctx.Value(oauthTokenKey).(*oauth2.Token)
+	return token, ok && token != nil
+}
+
+// WithClaims returns a copy of ctx carrying the Claims of a verified token
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey, claims)
+}
+
+// ClaimsFromContext returns the Claims stored by WithClaims(), ok is false
+// if there aren't any
+func ClaimsFromContext(ctx context.Context) (claims *Claims, ok bool) {
+	claims, ok = ctx.Value(claimsKey).(*Claims)
+	return claims, ok && claims != nil
+}
+
+// WithClientIP returns a copy of ctx carrying the address of the client,
+// recorded in Events. Handler() and Middleware() use ClientIP(), set it
+// yourself behind a reverse proxy or in custom callbacks
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey, ip)
+}
+
+// ClientIPFromContext returns the client address stored by WithClientIP()
+func ClientIPFromContext(ctx context.Context) (ip string, ok bool) {
+	ip, ok = ctx.Value(clientIPKey).(string)
+	return ip, ok
+}
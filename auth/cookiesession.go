@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// maxCookieSize is the largest cookie browsers reliably keep
+const maxCookieSize = 4096
+
+// errSessionTooLarge is returned when a session doesn't fit in a cookie,
+// usually because of a large Token. Use ServerSessions then
+var errSessionTooLarge = errors.New("auth: session too large for a cookie")
+
+// CookieSessions is a SessionStore keeping the whole session in an
+// encrypted and authenticated cookie (AES-GCM), so no server side storage
+// is needed. Sessions can't be revoked before they expire, use
+// ServerSessions with a Redis or memcached SessionBackend for that
+type CookieSessions struct {
+	// Keys are secrets of any length. The first one encrypts, all of them
+	// decrypt, so keys can be rotated by prepending a new one
+	Keys [][]byte
+
+	Cookie CookieOptions
+}
+
+// Load implements SessionStore
+func (s *CookieSessions) Load(r *http.Request) (*Session, error) {
+	c, err := r.Cookie(s.Cookie.name())
+	if err != nil {
+		return nil, ErrNoSession
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(c.Value)
+	if err != nil {
+		return nil, ErrNoSession
+	}
+	for _, key := range s.Keys {
+		aead, err := sessionCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if len(sealed) < aead.NonceSize() {
+			return nil, ErrNoSession
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		data, err := aead.Open(nil, nonce, ciphertext, []byte(s.Cookie.name()))
+		if err != nil {
+			continue
+		}
+
+		session := new(Session)
+		if err := json.Unmarshal(data, session); err != nil {
+			return nil, ErrNoSession
+		}
+		if time.Now().After(session.Expires) {
+			return nil, ErrNoSession
+		}
+		return session, nil
+	}
+	return nil, ErrNoSession
+}
+
+// Save implements SessionStore
+func (s *CookieSessions) Save(w http.ResponseWriter, r *http.Request, session *Session) error {
+	if len(s.Keys) == 0 {
+		return errNoKeys
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	aead, err := sessionCipher(s.Keys[0])
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	// the cookie name is authenticated too, so a session can't be moved
+	// to another cookie
+
+	sealed := aead.Seal(nonce, nonce, data, []byte(s.Cookie.name()))
+	value := base64.RawURLEncoding.EncodeToString(sealed)
+	if len(value) > maxCookieSize-len(s.Cookie.name())-100 {
+		return errSessionTooLarge
+	}
+	http.SetCookie(w, s.Cookie.cookie(value, session.Expires))
+	return nil
+}
+
+// Delete implements SessionStore
+func (s *CookieSessions) Delete(w http.ResponseWriter, r *http.Request) error {
+	http.SetCookie(w, s.Cookie.cookie("", time.Time{}))
+	return nil
+}
+
+// sessionCipher returns the AES-256-GCM cipher for key
+func sessionCipher(key []byte) (cipher.AEAD, error) {
+	k := sha256.Sum256(key)
+	block, err := aes.NewCipher(k[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
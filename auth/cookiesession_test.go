@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCookieSessions(t *testing.T) {
+	session := &Session{
+		ID:       "s1",
+		User:     &User{ID: 1, Login: "alice"},
+		Decision: Decision{Allowed: true},
+		Expires:  time.Now().Add(time.Hour),
+	}
+	expired := *session
+	expired.Expires = time.Now().Add(-time.Minute)
+	huge := *session
+	huge.Claims = map[string]interface{}{"blob": strings.Repeat("x", maxCookieSize)}
+
+	tests := []struct {
+		name    string
+		saver   *CookieSessions
+		loader  *CookieSessions
+		session *Session
+		saveErr error
+		loadErr error
+	}{
+		{"saved", &CookieSessions{Keys: [][]byte{[]byte("k1")}}, &CookieSessions{Keys: [][]byte{[]byte("k1")}}, session, nil, nil},
+		{"rotated", &CookieSessions{Keys: [][]byte{[]byte("k1")}}, &CookieSessions{Keys: [][]byte{[]byte("k2"), []byte("k1")}}, session, nil, nil},
+		{"wrong key", &CookieSessions{Keys: [][]byte{[]byte("k1")}}, &CookieSessions{Keys: [][]byte{[]byte("k2")}}, session, nil, ErrNoSession},
+		{"expired", &CookieSessions{Keys: [][]byte{[]byte("k1")}}, &CookieSessions{Keys: [][]byte{[]byte("k1")}}, &expired, nil, ErrNoSession},
+		{"no keys", &CookieSessions{}, nil, session, errNoKeys, nil},
+		{"too large", &CookieSessions{Keys: [][]byte{[]byte("k1")}}, nil, &huge, errSessionTooLarge, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			if err := tt.saver.Save(w, httptest.NewRequest("GET", "/", nil), tt.session); err != tt.saveErr {
+				t.Fatalf("Save() error = %v, want %v", err, tt.saveErr)
+			}
+			if tt.loader == nil {
+				return
+			}
+			r := httptest.NewRequest("GET", "/", nil)
+			for _, c := range w.Result().Cookies() {
+				r.AddCookie(c)
+			}
+			got, err := tt.loader.Load(r)
+			if err != tt.loadErr {
+				t.Fatalf("Load() error = %v, want %v", err, tt.loadErr)
+			}
+			if err == nil && (got.ID != "s1" || got.User.Login != "alice" || !got.Decision.Allowed) {
+				t.Errorf("Load() = %+v", got)
+			}
+		})
+	}
+}
+
+func TestCookieSessionsTampered(t *testing.T) {
+	s := &CookieSessions{Keys: [][]byte{[]byte("k1")}}
+	w := httptest.NewRecorder()
+	session := &Session{User: &User{Login: "alice"}, Decision: Decision{Allowed: true}, Expires: time.Now().Add(time.Hour)}
+	if err := s.Save(w, httptest.NewRequest("GET", "/", nil), session); err != nil {
+		t.Fatal(err)
+	}
+	cookie := w.Result().Cookies()[0]
+	flipped := []byte(cookie.Value)
+	flipped[len(flipped)/2] ^= 1
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+	}{
+		{"none", nil},
+		{"not base64", &http.Cookie{Name: cookie.Name, Value: "!!!"}},
+		{"short", &http.Cookie{Name: cookie.Name, Value: "AAAA"}},
+		{"flipped bit", &http.Cookie{Name: cookie.Name, Value: string(flipped)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.cookie != nil {
+				r.AddCookie(tt.cookie)
+			}
+			if _, err := s.Load(r); err != ErrNoSession {
+				t.Errorf("Load() error = %v, want ErrNoSession", err)
+			}
+		})
+	}
+
+	// the cookie name is authenticated, a session can't be moved to
+	// another cookie
+
+	other := &CookieSessions{Keys: s.Keys, Cookie: CookieOptions{Name: "other"}}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "other", Value: cookie.Value})
+	if _, err := other.Load(r); err != ErrNoSession {
+		t.Errorf("Load() of a moved cookie error = %v, want ErrNoSession", err)
+	}
+}
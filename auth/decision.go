@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Reason is a machine readable explanation of why a Decision denied access,
+// so apps can show users something better than a generic message
+type Reason string
+
+// Reasons returned in Decision.Reason
+const (
+	NotInOrganization   Reason = "not_in_organization"  // user isn't a member of Organization
+	NotInTeam           Reason = "not_in_team"          // user is in Organization but not in Team
+	PendingInvite       Reason = "pending_invite"       // user was invited to Organization but didn't accept yet
+	MissingScope        Reason = "missing_scope"        // token wasn't granted the read:org scope
+	MembershipConcealed Reason = "membership_concealed" // user membership isn't public, see RequirePublicMembership
+	TokenInvalid        Reason = "token_invalid"        // github rejected the access token
+	DeniedByPolicy      Reason = "denied_by_policy"     // an explicit override denied the user
+	NotCollaborator     Reason = "not_collaborator"     // user lacks MinPermission on Repository
+	TwoFactorDisabled   Reason = "two_factor_disabled"  // user has no two-factor authentication, see RequireTwoFactor
+	EmailNotAllowed     Reason = "email_not_allowed"    // user has no verified email in AllowedEmailDomains
+	SSORequired         Reason = "sso_required"         // user didn't authorize SAML SSO, see ReasonOf()
+)
+
+// Decision is the outcome of CheckDecision()
+type Decision struct {
+	Allowed bool     // true if the user belongs to Organization/Team
+	Reason  Reason   // why access was denied, empty when Allowed is true
+	Team    *Team    // team that admitted the user, including their Role. nil when denied or no team is configured
+	Roles   []string // application roles resolved by the RoleMapper, if any
+	Stale   bool     // github was unreachable and this is a remembered decision
+	OrgRole string   // admin or member in Organization, when github was asked about it
+
+	// Teams are all the teams of the user in Organization, so apps can make
+	// finer-grained decisions without asking github again. Empty with
+	// DirectMembership, which doesn't list them
+	Teams []Team
+}
+
+// CheckDecision works like CheckPermission() but instead of a plain ok it
+// returns a Decision explaining why the user was denied
+//
+// user will be nil when the Reason is TokenInvalid, since we can't fetch
+// user details with a token github rejects
+//
+// If an error happens and we can't verify, err will be set
+func (c *Config) CheckDecision(code string) (Decision, *User, error) {
+	return c.CheckDecisionContext(context.Background(), code)
+}
+
+// CheckDecisionContext is CheckDecision() using ctx for the token exchange
+// and every github request
+func (c *Config) CheckDecisionContext(ctx context.Context, code string) (Decision, *User, error) {
+	token, err := c.Exchange(ctx, code)
+	if err != nil {
+		return Decision{}, nil, err
+	}
+
+	return c.Verify(ctx, token)
+}
+
+// CheckDecisionWithToken is CheckDecision() for an already obtained token,
+// see CheckPermissionWithToken()
+func (c *Config) CheckDecisionWithToken(token *oauth2.Token) (Decision, *User, error) {
+	return c.Verify(context.Background(), token)
+}
+
+// Exchange trades the OAuth2 authorization code given to your callback url
+// for an access token. It's the first half of CheckPermission(), use it when
+// you want to persist the token or compose the steps with your own logic
+func (c *Config) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
+	return c.exchange(ctx, code)
+}
+
+// Verify is the second half of CheckPermission(): it fetches the user details
+// and checks the Organization/Team membership using token. It can be retried
+// independently of Exchange()
+//
+// user will be nil when the Reason is TokenInvalid. If an error happens and we
+// can't verify, err will be set. With Config.Accounts set, err can also be
+// ErrLinkRequired together with the decision and user
+func (c *Config) Verify(ctx context.Context, token *oauth2.Token) (Decision, *User, error) {
+	start := time.Now()
+	decision, user, err := c.verify(ctx, token)
+	c.logVerify(ctx, time.Since(start), decision, user, err)
+	if c.Metrics != nil {
+		c.Metrics.ObserveVerify(decision, err, time.Since(start))
+	}
+	return decision, user, err
+}
+
+// verify is Verify() without logging
+func (c *Config) verify(ctx context.Context, token *oauth2.Token) (Decision, *User, error) {
+	// create a http client authorized to make requests to github api
+	// using an access token
+
+	client := c.userClient(ctx, token)
+
+	decision, user, err := c.verifier().verifyWithFallback(ctx, client, token)
+	if err == nil {
+		decision, err = c.twoFactor(ctx, user, decision)
+	}
+	if err != nil {
+		c.publishError(ctx, err)
+		return Decision{}, nil, err
+	}
+	c.publish(ctx, user, decision)
+
+	err = c.link(ctx, user, decision)
+	if err != nil && err != ErrLinkRequired {
+		return Decision{}, nil, err
+	}
+	return decision, user, err
+}
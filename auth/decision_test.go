@@ -0,0 +1,138 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/RealGeeks/github-org-auth/auth"
+	"github.com/RealGeeks/github-org-auth/auth/authtest"
+	"golang.org/x/oauth2"
+)
+
+func TestVerify(t *testing.T) {
+	gh := authtest.NewServer()
+	defer gh.Close()
+	gh.AddUser("member", authtest.User{ID: 1, Login: "alice", Teams: []authtest.Team{{Organization: "acme", Slug: "eng"}}})
+	gh.AddUser("ops", authtest.User{ID: 2, Login: "bob", Teams: []authtest.Team{{Organization: "acme", Slug: "ops", Name: "Ops Team"}}})
+	gh.AddUser("both", authtest.User{ID: 3, Login: "carol", Teams: []authtest.Team{{Organization: "acme", Slug: "eng"}, {Organization: "acme", Slug: "ops"}}})
+	gh.AddUser("org", authtest.User{ID: 4, Login: "dave", Orgs: map[string]string{"acme": "active"}})
+	gh.AddUser("invited", authtest.User{ID: 5, Login: "erin", Orgs: map[string]string{"acme": "pending"}})
+	gh.AddUser("outsider", authtest.User{ID: 6, Login: "frank", Teams: []authtest.Team{{Organization: "other", Slug: "eng"}}})
+	gh.AddUser("noscope", authtest.User{ID: 7, Login: "grace", Scopes: "user:email", Teams: []authtest.Team{{Organization: "acme", Slug: "eng"}}})
+
+	tests := []struct {
+		name   string
+		config *auth.Config
+		token  string
+		allow  bool
+		reason auth.Reason
+		team   string
+	}{
+		{"team member", &auth.Config{Team: "eng"}, "member", true, "", "eng"},
+		{"other team", &auth.Config{Team: "eng"}, "ops", false, auth.NotInTeam, ""},
+		{"org member without teams", &auth.Config{Team: "eng"}, "org", false, auth.NotInTeam, ""},
+		{"pending invite", &auth.Config{Team: "eng"}, "invited", false, auth.PendingInvite, ""},
+		{"same slug in another org", &auth.Config{Team: "eng"}, "outsider", false, auth.NotInOrganization, ""},
+		{"missing scope", &auth.Config{Team: "eng"}, "noscope", false, auth.MissingScope, ""},
+		{"bad token", &auth.Config{Team: "eng"}, "nope", false, auth.TokenInvalid, ""},
+		{"allowed teams", &auth.Config{Team: "eng", AllowedTeams: []string{"ops"}}, "ops", true, "", "ops"},
+		{"display name", &auth.Config{Team: "Ops Team"}, "ops", true, "", "ops"},
+		{"display name with SlugOnly", &auth.Config{Team: "Ops Team", SlugOnly: true}, "ops", false, auth.NotInTeam, ""},
+		{"glob", &auth.Config{Team: "o*"}, "ops", true, "", "ops"},
+		{"require all, one missing", &auth.Config{Team: "eng", AllowedTeams: []string{"ops"}, RequireAll: true}, "member", false, auth.NotInTeam, ""},
+		{"require all", &auth.Config{Team: "eng", AllowedTeams: []string{"ops"}, RequireAll: true}, "both", true, "", "eng"},
+		{"organization only", &auth.Config{}, "org", true, "", ""},
+		{"organization only, outsider", &auth.Config{}, "outsider", false, auth.NotInOrganization, ""},
+		{"deny users", &auth.Config{Team: "eng", DenyUsers: []string{"ALICE"}}, "member", false, auth.DeniedByPolicy, ""},
+		{"allow users", &auth.Config{Team: "eng", AllowUsers: []string{"frank"}}, "outsider", true, "", ""},
+		{"allow users keep token checks", &auth.Config{Team: "eng", AllowUsers: []string{"frank"}}, "nope", false, auth.TokenInvalid, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.config
+			c.Organization = "acme"
+			c.ClientID, c.ClientSecret = "id", "secret"
+			c.Retries = -1
+			gh.Configure(c)
+
+			decision, user, err := c.Verify(context.Background(), &oauth2.Token{AccessToken: tt.token})
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if decision.Allowed != tt.allow || decision.Reason != tt.reason {
+				t.Fatalf("Verify() = %v %q, want %v %q", decision.Allowed, decision.Reason, tt.allow, tt.reason)
+			}
+			if tt.allow && user == nil {
+				t.Fatal("Verify() allowed without a user")
+			}
+			if tt.team != "" && (decision.Team == nil || decision.Team.Slug != tt.team) {
+				t.Errorf("Verify() team = %+v, want %s", decision.Team, tt.team)
+			}
+		})
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	gh := authtest.NewServer()
+	defer gh.Close()
+	gh.AddUser("member", authtest.User{ID: 1, Login: "alice", Teams: []authtest.Team{{Organization: "acme", Slug: "eng"}}})
+
+	tests := []struct {
+		name  string
+		setup func()
+	}{
+		{"teams failing", func() { gh.Fail("/user/teams", http.StatusInternalServerError) }},
+		{"rate limited", func() { gh.RateLimit(true) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer gh.RateLimit(false)
+			defer gh.Fail("/user/teams", 0)
+			tt.setup()
+
+			c := &auth.Config{Organization: "acme", Team: "eng", ClientID: "id", ClientSecret: "secret", Retries: -1}
+			gh.Configure(c)
+			decision, _, err := c.Verify(context.Background(), &oauth2.Token{AccessToken: "member"})
+			if err == nil {
+				t.Fatalf("Verify() = %+v, want an error", decision)
+			}
+			if decision.Allowed {
+				t.Error("Verify() allowed on error")
+			}
+		})
+	}
+}
+
+func TestRuntimePolicyKeepsDecision(t *testing.T) {
+	gh := authtest.NewServer()
+	defer gh.Close()
+	gh.AddUser("member", authtest.User{ID: 1, Login: "alice", Teams: []authtest.Team{{Organization: "acme", Slug: "eng"}}})
+	gh.AddUser("ops", authtest.User{ID: 2, Login: "bob", Teams: []authtest.Team{{Organization: "acme", Slug: "ops"}}})
+
+	policy, err := auth.NewRuntimePolicy(context.Background(), policyState{AllowedTeams: []string{"acme/ops"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &auth.Config{Organization: "acme", Team: "eng", ClientID: "id", ClientSecret: "secret", Retries: -1, Authorize: policy.Authorize}
+	gh.Configure(c)
+
+	decision, _, err := c.Verify(context.Background(), &oauth2.Token{AccessToken: "ops"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decision.Allowed || len(decision.Teams) != 1 || decision.Teams[0].Slug != "ops" {
+		t.Errorf("Verify() = %+v, want allowed keeping the teams", decision)
+	}
+}
+
+// policyState is a PolicyStore always loading the same state
+type policyState auth.PolicyState
+
+func (s policyState) Load(ctx context.Context) (auth.PolicyState, error) {
+	return auth.PolicyState(s), nil
+}
+
+func (s policyState) Save(ctx context.Context, state auth.PolicyState) error {
+	return nil
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"golang.org/x/oauth2"
+)
+
+// DeviceToken runs github's device authorization grant, for CLI tools
+// where a redirect url isn't available. prompt is called with the url the
+// user must open and the code to enter there, nil prints them to stderr.
+// It polls github until the user approves, denies, the code expires or ctx
+// is done. Enable the device flow in the OAuth app settings first
+func (c *Config) DeviceToken(ctx context.Context, prompt func(verificationURI, userCode string)) (*oauth2.Token, error) {
+	code, err := c.oauth2Config().DeviceAuth(withHTTPClient(ctx, c.httpClient()))
+	if err != nil {
+		return nil, err
+	}
+	if prompt == nil {
+		fmt.Fprintf(os.Stderr, "open %s and enter the code %s\n", code.VerificationURI, code.UserCode)
+	} else {
+		prompt(code.VerificationURI, code.UserCode)
+	}
+	return c.oauth2Config().DeviceAccessToken(withHTTPClient(ctx, c.httpClient()), code)
+}
+
+// DeviceFlow signs the user in with DeviceToken() and runs the same
+// membership check as the web flow, see Verify()
+func (c *Config) DeviceFlow(ctx context.Context, prompt func(verificationURI, userCode string)) (Decision, *User, error) {
+	token, err := c.DeviceToken(ctx, prompt)
+	if err != nil {
+		return Decision{}, nil, err
+	}
+	return c.Verify(ctx, token)
+}
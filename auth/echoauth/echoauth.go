@@ -0,0 +1,59 @@
+// Package echoauth adapts auth to echo
+//
+//	e := echo.New()
+//	echoauth.Routes(e.Group("/auth"), cfg)
+//	private := e.Group("", echoauth.Middleware(cfg))
+//
+// with cfg.LoginURL set to "/auth/login"
+package echoauth
+
+import (
+	"net/http"
+
+	"github.com/RealGeeks/github-org-auth/auth"
+	"github.com/labstack/echo/v4"
+)
+
+// UserKey is the echo context key holding the *auth.User
+const UserKey = "github_org_auth_user"
+
+// Routes serves the login, callback and logout endpoints of cfg.Handler()
+// on g
+func Routes(g *echo.Group, cfg *auth.Config) {
+	h := echo.WrapHandler(cfg.Handler())
+	g.GET("/login", h)
+	g.GET("/callback", h)
+	g.GET("/logout", h)
+	g.POST("/logout", h)
+}
+
+// Middleware only lets requests with a session through, like
+// cfg.Middleware(). The user is stored under UserKey and in the request
+// context. Failures are returned as *echo.HTTPError for the app error
+// handler
+func Middleware(cfg *auth.Config) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			r, err := cfg.Authenticate(c.Response(), c.Request())
+			switch {
+			case err == nil:
+				c.SetRequest(r)
+				user, _ := auth.UserFromContext(r.Context())
+				c.Set(UserKey, user)
+				return next(c)
+			case err != auth.ErrNoSession:
+				return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+			case c.Request().Method == "GET":
+				return c.Redirect(http.StatusFound, cfg.LoginRedirect(c.Request()))
+			default:
+				return echo.NewHTTPError(http.StatusUnauthorized)
+			}
+		}
+	}
+}
+
+// User returns the user stored by Middleware()
+func User(c echo.Context) (*auth.User, bool) {
+	user, _ := c.Get(UserKey).(*auth.User)
+	return user, user != nil
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// emailDomain denies allowed users without a verified email in one of
+// AllowedEmailDomains. The addresses decide() got are reused, the GraphQL
+// and Members paths don't get them so github is asked again
+func (v *Verifier) emailDomain(ctx context.Context, client *http.Client, user *User, decision Decision) (Decision, error) {
+	if len(v.AllowedEmailDomains) == 0 || !decision.Allowed {
+		return decision, nil
+	}
+	ok, err := verifiedEmailIn(ctx, client, user, v.AllowedEmailDomains)
+	if err != nil {
+		return Decision{}, err
+	}
+	if !ok {
+		return Decision{Reason: EmailNotAllowed, Teams: decision.Teams, OrgRole: decision.OrgRole}, nil
+	}
+	return decision, nil
+}
+
+// verifiedEmailIn reports whether user has a verified email in one of
+// domains, like example.com. Subdomains aren't, list them too. The
+// addresses are fetched with client unless decide() already did
+func verifiedEmailIn(ctx context.Context, client *http.Client, user *User, domains []string) (bool, error) {
+	raw := user.emails
+	if raw == nil {
+		var err error
+		if raw, err = fetchEmails(ctx, client); err != nil {
+			return false, err
+		}
+	}
+	var emails []email
+	json.Unmarshal(raw, &emails)
+	for _, e := range emails {
+		at := strings.LastIndexByte(e.Email, '@')
+		if !e.Verified || at < 0 {
+			continue
+		}
+		for _, domain := range domains {
+			if strings.EqualFold(e.Email[at+1:], strings.TrimPrefix(domain, "@")) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// EventType is the kind of an authentication Event
+type EventType string
+
+// Every EventType, these values are part of the event schema and won't change
+const (
+	EventLogin   EventType = "login"   // user verified and allowed
+	EventDenied  EventType = "denied"  // user verified and denied
+	EventLogout  EventType = "logout"  // session ended by the user
+	EventRevoked EventType = "revoked" // session invalidated, e.g. by Reverifier
+	EventError   EventType = "error"   // the user couldn't be verified, see Event.Error
+)
+
+// EventVersion is the version of the Event schema. Fields may be added
+// without changing it, but never renamed or removed
+const EventVersion = 1
+
+// Event describes authentication activity for other systems to react to,
+// like provisioning, analytics or security tooling
+type Event struct {
+	Version      int       `json:"version"`
+	Type         EventType `json:"type"`
+	Time         time.Time `json:"time"`
+	Organization string    `json:"organization"`
+	Login        string    `json:"login,omitempty"`
+	Reason       Reason    `json:"reason,omitempty"`
+	Roles        []string  `json:"roles,omitempty"`
+	Session      string    `json:"session,omitempty"` // session id, when there is one
+	IP           string    `json:"ip,omitempty"`      // client address, see WithClientIP()
+	Teams        []string  `json:"teams,omitempty"`   // slugs of the user teams in Organization
+	Error        string    `json:"error,omitempty"`   // what failed, for error Events
+}
+
+// Publisher sends Events somewhere, e.g. Kafka or NATS, wrap their clients
+// with PublisherFunc. Publish is called synchronously on the request path,
+// so buffer if the transport can be slow. Errors are reported by the caller
+// but never change the outcome of authentication
+type Publisher interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+// PublisherFunc is a func implementing Publisher
+type PublisherFunc func(ctx context.Context, e Event) error
+
+// Publish implements Publisher
+func (f PublisherFunc) Publish(ctx context.Context, e Event) error {
+	return f(ctx, e)
+}
+
+// Publishers fans Events out to all of them, returning the first error
+type Publishers []Publisher
+
+// Publish implements Publisher
+func (p Publishers) Publish(ctx context.Context, e Event) error {
+	var first error
+	for _, publisher := range p {
+		if err := publisher.Publish(ctx, e); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// JSONPublisher writes Events to W as JSON lines, for log shippers or
+// piping into another tool
+type JSONPublisher struct {
+	W io.Writer
+
+	mu sync.Mutex
+}
+
+// Publish implements Publisher
+func (p *JSONPublisher) Publish(ctx context.Context, e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err = p.W.Write(append(b, '\n'))
+	return err
+}
+
+// NewEvent returns an Event of type t about user, filling in the schema
+// version and time. user and decision may be nil
+func NewEvent(t EventType, organization string, user *User, decision *Decision) Event {
+	e := Event{
+		Version:      EventVersion,
+		Type:         t,
+		Time:         time.Now().UTC(),
+		Organization: organization,
+	}
+	if user != nil {
+		e.Login = user.Login
+	}
+	if decision != nil {
+		e.Reason = decision.Reason
+		e.Roles = decision.Roles
+		for _, t := range decision.Teams {
+			e.Teams = append(e.Teams, t.Slug)
+		}
+	}
+	return e
+}
+
+// publish sends a login or denied Event for decision to c.Events
+func (c *Config) publish(ctx context.Context, user *User, decision Decision) {
+	if c.Events == nil {
+		return
+	}
+	t := EventDenied
+	if decision.Allowed {
+		t = EventLogin
+	}
+	c.publishEvent(ctx, NewEvent(t, c.Organization, user, &decision))
+}
+
+// publishError sends an error Event for verr to c.Events
+func (c *Config) publishError(ctx context.Context, verr error) {
+	if c.Events == nil {
+		return
+	}
+	e := NewEvent(EventError, c.Organization, nil, nil)
+	e.Error = verr.Error()
+	c.publishEvent(ctx, e)
+}
+
+// publishEvent sends e, with the client address in ctx, to c.Events
+func (c *Config) publishEvent(ctx context.Context, e Event) {
+	e.IP, _ = ClientIPFromContext(ctx)
+	err := c.Events.Publish(ctx, e)
+	if err != nil && c.OnEventError != nil {
+		c.OnEventError(err)
+	}
+}
+
+// FilePublisher appends Events as JSON lines to the file at Path, created
+// if missing, for audit trails. Close it on shutdown
+type FilePublisher struct {
+	Path string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// Publish implements Publisher
+func (p *FilePublisher) Publish(ctx context.Context, e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.f == nil {
+		if p.f, err = os.OpenFile(p.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600); err != nil {
+			return err
+		}
+	}
+	_, err = p.f.Write(append(b, '\n'))
+	return err
+}
+
+// Close closes the file, the next Publish opens it again
+func (p *FilePublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.f == nil {
+		return nil
+	}
+	err := p.f.Close()
+	p.f = nil
+	return err
+}
+
+// WebhookPublisher returns a Publisher posting every Event as JSON to url,
+// e.g. a SIEM collector. client may be nil
+func WebhookPublisher(url string, client *http.Client) PublisherFunc {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(ctx context.Context, e Event) error {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(b))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("auth: event webhook: %s", resp.Status)
+		}
+		return nil
+	}
+}
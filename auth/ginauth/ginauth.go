@@ -0,0 +1,58 @@
+// Package ginauth adapts auth to gin
+//
+//	r := gin.Default()
+//	ginauth.Routes(r.Group("/auth"), cfg)
+//	private := r.Group("/", ginauth.Middleware(cfg))
+//
+// with cfg.LoginURL set to "/auth/login"
+package ginauth
+
+import (
+	"net/http"
+
+	"github.com/RealGeeks/github-org-auth/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// UserKey is the gin context key holding the *auth.User
+const UserKey = "github_org_auth_user"
+
+// Routes serves the login, callback and logout endpoints of cfg.Handler()
+// on g
+func Routes(g gin.IRoutes, cfg *auth.Config) {
+	h := gin.WrapH(cfg.Handler())
+	g.GET("/login", h)
+	g.GET("/callback", h)
+	g.GET("/logout", h)
+	g.POST("/logout", h)
+}
+
+// Middleware only lets requests with a session through, like
+// cfg.Middleware(). The user is stored under UserKey and in the request
+// context. Denied requests are aborted, errors are attached to the context
+func Middleware(cfg *auth.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r, err := cfg.Authenticate(c.Writer, c.Request)
+		switch {
+		case err == nil:
+			c.Request = r
+			user, _ := auth.UserFromContext(r.Context())
+			c.Set(UserKey, user)
+			c.Next()
+		case err != auth.ErrNoSession:
+			c.AbortWithError(http.StatusInternalServerError, err)
+		case c.Request.Method == "GET":
+			c.Redirect(http.StatusFound, cfg.LoginRedirect(c.Request))
+			c.Abort()
+		default:
+			c.AbortWithStatus(http.StatusUnauthorized)
+		}
+	}
+}
+
+// User returns the user stored by Middleware()
+func User(c *gin.Context) (*auth.User, bool) {
+	v, ok := c.Get(UserKey)
+	user, _ := v.(*auth.User)
+	return user, ok && user != nil
+}
@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// get makes a GET request to url using client and decodes the json body into
+// v, if not nil, when github answers 200. The body is always closed, the
+// response is returned so callers can look at the status code and headers
+func get(ctx context.Context, client *http.Client, url string, v interface{}) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// keep the start of unexpected bodies around for statusError(), since
+	// the real body is closed when we return
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		resp.Body = io.NopCloser(bytes.NewReader(b))
+		return resp, ssoRequired(resp)
+	}
+	if v == nil {
+		return resp, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// pageWorkers is how many pages getPages fetches at the same time
+const pageWorkers = 4
+
+// getPages GETs url and every following page linked from the Link header,
+// giving each page body to decode in order. When github tells us the last
+// page, the remaining ones are fetched concurrently so latency stays flat
+// for users in hundreds of teams
+func getPages(ctx context.Context, client *http.Client, url string, decode func(page json.RawMessage) error) error {
+	for url != "" {
+		page, resp, err := getPage(ctx, client, url)
+		if err != nil {
+			return err
+		}
+		if err := decode(page); err != nil {
+			return err
+		}
+
+		link := resp.Header.Get("Link")
+		if urls := remainingPages(linkRel(link, "next"), linkRel(link, "last")); urls != nil {
+			return getParallel(ctx, client, urls, decode)
+		}
+		url = linkRel(link, "next")
+	}
+	return nil
+}
+
+// getPage GETs a single page
+func getPage(ctx context.Context, client *http.Client, url string) (json.RawMessage, *http.Response, error) {
+	var page json.RawMessage
+	resp, err := get(ctx, client, url, &page)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, statusError(resp)
+	}
+	return page, resp, nil
+}
+
+// getParallel GETs urls with pageWorkers at a time, decoding them in order
+func getParallel(ctx context.Context, client *http.Client, urls []string, decode func(page json.RawMessage) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pages := make([]json.RawMessage, len(urls))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var first error
+	for w := 0; w < pageWorkers && w < len(urls); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				var err error
+				if pages[i], _, err = getPage(ctx, client, urls[i]); err != nil {
+					// the first error is the real one, the others are
+					// caused by the cancellation
+
+					once.Do(func() { first = err })
+					cancel()
+				}
+			}
+		}()
+	}
+	for i := range urls {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	if first != nil {
+		return first
+	}
+
+	for _, page := range pages {
+		if err := decode(page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remainingPages returns the urls of pages next to last, or nil if they
+// can't be worked out from the page query parameter
+func remainingPages(next, last string) []string {
+	if next == "" || last == "" {
+		return nil
+	}
+	u, err := url.Parse(next)
+	if err != nil {
+		return nil
+	}
+	l, err := url.Parse(last)
+	if err != nil {
+		return nil
+	}
+	from, err1 := strconv.Atoi(u.Query().Get("page"))
+	to, err2 := strconv.Atoi(l.Query().Get("page"))
+	if err1 != nil || err2 != nil || from > to {
+		return nil
+	}
+
+	urls := make([]string, 0, to-from+1)
+	for page := from; page <= to; page++ {
+		q := u.Query()
+		q.Set("page", strconv.Itoa(page))
+		u.RawQuery = q.Encode()
+		urls = append(urls, u.String())
+	}
+	return urls
+}
+
+// linkRel returns the url with relation rel, like next or last, of a Link
+// header, empty if there's none
+func linkRel(link, rel string) string {
+	for _, part := range strings.Split(link, ",") {
+		segments := strings.Split(part, ";")
+		if len(segments) < 2 {
+			continue
+		}
+		for _, s := range segments[1:] {
+			if strings.TrimSpace(s) == `rel="`+rel+`"` {
+				return strings.Trim(strings.TrimSpace(segments[0]), "<>")
+			}
+		}
+	}
+	return ""
+}
+
+// maxErrorBody is how much of an unexpected response body ErrGitHubAPI keeps
+const maxErrorBody = 4096
+
+// ErrGitHubAPI is an unexpected github response. Use errors.Is() with
+// ErrUnauthorized and ErrRateLimited to tell the common cases apart
+type ErrGitHubAPI struct {
+	URL    string
+	Status int    // http status code
+	Body   string // start of the response body, github explains errors there
+
+	rateLimited bool
+}
+
+func (e *ErrGitHubAPI) Error() string {
+	return fmt.Sprintf("auth: unexpected response from %s: %d %s", e.URL, e.Status, http.StatusText(e.Status))
+}
+
+// Is makes errors.Is() match ErrUnauthorized and ErrRateLimited
+func (e *ErrGitHubAPI) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.Status == http.StatusUnauthorized
+	case ErrRateLimited:
+		return e.rateLimited
+	}
+	return false
+}
+
+// statusError builds an error for an unexpected github response
+func statusError(resp *http.Response) error {
+	if err := ssoRequired(resp); err != nil {
+		return err
+	}
+	e := &ErrGitHubAPI{URL: resp.Request.URL.String(), Status: resp.StatusCode}
+	if b, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody)); err == nil {
+		e.Body = string(b)
+	}
+
+	e.rateLimited = rateLimited(resp)
+	return e
+}
+
+// rateLimited reports whether resp is github refusing to answer because of
+// its rate limits. It answers 403 for exhausted primary limits and 403 or
+// 429 for secondary ones, so a 403 alone doesn't mean access was denied
+func rateLimited(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusForbidden:
+		return resp.Header.Get("X-RateLimit-Remaining") == "0" || resp.Header.Get("Retry-After") != ""
+	}
+	return false
+}
+
+// isOutage reports whether err means github is unreachable or failing, as
+// opposed to github telling us something about the user
+func isOutage(err error) bool {
+	var ae *ErrGitHubAPI
+	if errors.As(err, &ae) {
+		return ae.Status >= 500 || ae.rateLimited
+	}
+	var ue *url.Error
+	return errors.As(err, &ue) && !errors.Is(err, context.Canceled)
+}
@@ -0,0 +1,300 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+	"golang.org/x/sync/singleflight"
+)
+
+// errPrivateKey is returned for GitHubAppConfig.PrivateKey values which
+// aren't a PEM encoded RSA key
+var errPrivateKey = errors.New("auth: github app private key must be a PEM encoded RSA key")
+
+// GitHubAppConfig authenticates users through a GitHub App instead of an
+// OAuth App, as github recommends: they have better rate limits and scoped
+// permissions. Users go through the same login flow with the app's client
+// id and secret, and their user-to-server token carries the app
+// permissions instead of scopes
+//
+// With AppID and PrivateKey set, team membership is checked server side
+// with an installation token of the app on Organization, which needs the
+// "Members" organization permission. Users then grant nothing beyond their
+// identity. Teams must be given by slug in that mode
+type GitHubAppConfig struct {
+	Organization string
+	Team         string   // slug, or a glob when checking with the user's token
+	AllowedTeams []string // more teams, any of them is enough unless RequireAll
+	RequireAll   bool
+	AllowUsers   []string // see Config.AllowUsers
+	DenyUsers    []string // see Config.DenyUsers
+
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+
+	AppID          int64
+	PrivateKey     []byte // PEM encoded RSA key of the app
+	InstallationID int64  // installation on Organization, looked up if zero
+
+	// HTTPClient and Timeout work like in Config
+	HTTPClient *http.Client
+	Timeout    time.Duration
+
+	cfgOnce sync.Once
+	cfg     *oauth2.Config
+	flight  singleflight.Group // installation token refreshes
+	slugs   teamSlugs
+
+	mu      sync.Mutex
+	key     *rsa.PrivateKey
+	token   string
+	expires time.Time
+}
+
+// AuthCodeURL returns the URL to send users to for signing in
+func (a *GitHubAppConfig) AuthCodeURL(state string) string {
+	return a.oauth2Config().AuthCodeURL(state)
+}
+
+// Exchange trades the code given to the callback url for the user's
+// user-to-server token
+func (a *GitHubAppConfig) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
+	return a.oauth2Config().Exchange(withHTTPClient(ctx, a.verifier().httpClient()), code)
+}
+
+// Verify checks the membership of the user owning token, see Config.Verify()
+func (a *GitHubAppConfig) Verify(ctx context.Context, token *oauth2.Token) (Decision, *User, error) {
+	v := a.verifier()
+	client := a.oauth2Config().Client(withHTTPClient(ctx, v.httpClient()), token)
+	if a.PrivateKey == nil {
+		return v.Verify(ctx, client)
+	}
+
+	user, _, err := fetchUser(ctx, client)
+	if err == ErrUnauthorized {
+		return Decision{Reason: TokenInvalid}, nil, nil
+	}
+	if err != nil {
+		return Decision{}, nil, err
+	}
+	installation, err := a.installationClient(ctx)
+	if err != nil {
+		return Decision{}, nil, err
+	}
+
+	// the user just signed in, so the rules needing their own token don't
+	// deny them, like for Config.CheckMembership() on sessions
+
+	decision, err := v.checkUser(ctx, installation, user, true)
+	if err != nil {
+		return Decision{}, nil, err
+	}
+	return decision, user, nil
+}
+
+// verifier checks membership with the user's own token, or with the
+// installation one. User-to-server tokens carry no scopes, the app
+// permissions apply instead
+func (a *GitHubAppConfig) verifier() *Verifier {
+	timeout := a.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	return &Verifier{
+		Organization: a.Organization,
+		Team:         a.Team,
+		AllowedTeams: a.AllowedTeams,
+		RequireAll:   a.RequireAll,
+		AllowUsers:   a.AllowUsers,
+		DenyUsers:    a.DenyUsers,
+		HTTPClient:   a.HTTPClient,
+		Timeout:      timeout,
+
+		appToken: true,
+		slugs:    &a.slugs,
+	}
+}
+
+// TokenSource returns installation tokens of the app on Organization, for
+// Config.ServerToken. It needs AppID and PrivateKey
+func (a *GitHubAppConfig) TokenSource() oauth2.TokenSource {
+	return appTokenSource{a}
+}
+
+// appTokenSource is GitHubAppConfig.TokenSource()
+type appTokenSource struct {
+	app *GitHubAppConfig
+}
+
+// Token implements oauth2.TokenSource
+func (s appTokenSource) Token() (*oauth2.Token, error) {
+	token, expires, err := s.app.installationToken(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{AccessToken: token, Expiry: expires}, nil
+}
+
+// installationClient returns a client authorized as the app installation
+// on Organization
+func (a *GitHubAppConfig) installationClient(ctx context.Context) (*http.Client, error) {
+	token, _, err := a.installationToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return bearerClient(a.verifier().httpClient(), token), nil
+}
+
+// appToken is an installation token and its expiry
+type appToken struct {
+	token   string
+	expires time.Time
+}
+
+// installationToken returns a token of the app installation on
+// Organization, refreshing it when it's about to expire. Concurrent
+// callers share one refresh, which doesn't hold a.mu
+func (a *GitHubAppConfig) installationToken(ctx context.Context) (string, time.Time, error) {
+	a.mu.Lock()
+	token, expires := a.token, a.expires
+	a.mu.Unlock()
+	if token != "" && time.Until(expires) > time.Minute {
+		return token, expires, nil
+	}
+
+	v, err, _ := a.flight.Do("token", func() (interface{}, error) {
+		return a.refreshToken(context.WithoutCancel(ctx))
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	t := v.(appToken)
+	return t.token, t.expires, nil
+}
+
+// refreshToken asks github for a new installation token, through the
+// client chain of verifier() so Timeout bounds every request
+func (a *GitHubAppConfig) refreshToken(ctx context.Context) (appToken, error) {
+	jwt, err := a.appJWT()
+	if err != nil {
+		return appToken{}, err
+	}
+	app := bearerClient(a.verifier().httpClient(), jwt)
+
+	a.mu.Lock()
+	id := a.InstallationID
+	a.mu.Unlock()
+	if id == 0 {
+		var installation struct {
+			ID int64 `json:"id"`
+		}
+		resp, err := get(ctx, app, "https://api.github.com/orgs/"+url.PathEscape(a.Organization)+"/installation", &installation)
+		if err != nil {
+			return appToken{}, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return appToken{}, statusError(resp)
+		}
+		id = installation.ID
+	}
+
+	u := fmt.Sprintf("https://api.github.com/app/installations/%d/access_tokens", id)
+	req, err := http.NewRequestWithContext(ctx, "POST", u, nil)
+	if err != nil {
+		return appToken{}, err
+	}
+	resp, err := app.Do(req)
+	if err != nil {
+		return appToken{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return appToken{}, statusError(resp)
+	}
+	var body struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return appToken{}, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.InstallationID = id
+	a.token, a.expires = body.Token, body.ExpiresAt
+	return appToken{token: body.Token, expires: body.ExpiresAt}, nil
+}
+
+// appJWT signs the short-lived JWT authenticating as the app itself
+func (a *GitHubAppConfig) appJWT() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.key == nil {
+		block, _ := pem.Decode(a.PrivateKey)
+		if block == nil {
+			return "", errPrivateKey
+		}
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return "", errPrivateKey
+			}
+			var ok bool
+			if key, ok = parsed.(*rsa.PrivateKey); !ok {
+				return "", errPrivateKey
+			}
+		}
+		a.key = key
+	}
+
+	// iat is set in the past to allow for clock drift, github rejects
+	// tokens living longer than 10 minutes
+
+	now := time.Now()
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": fmt.Sprint(a.AppID),
+	})
+	if err != nil {
+		return "", err
+	}
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	signed := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func (a *GitHubAppConfig) oauth2Config() *oauth2.Config {
+	a.cfgOnce.Do(func() {
+		a.cfg = &oauth2.Config{
+			ClientID:     a.ClientID,
+			ClientSecret: a.ClientSecret,
+			Endpoint:     github.Endpoint,
+			RedirectURL:  a.RedirectURL,
+		}
+	})
+	return a.cfg
+}
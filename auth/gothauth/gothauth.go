@@ -0,0 +1,151 @@
+// Package gothauth adapts auth to goth, so github organization sign in can
+// sit next to other goth providers
+//
+//	goth.UseProviders(gothauth.New(cfg), google.New(...))
+//
+// FetchUser only returns users cfg allows, others get a *DeniedError
+package gothauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/RealGeeks/github-org-auth/auth"
+	"github.com/markbates/goth"
+	"golang.org/x/oauth2"
+)
+
+// errNoToken is returned by FetchUser for sessions which weren't authorized
+var errNoToken = errors.New("gothauth: session has no access token")
+
+// DeniedError is returned by FetchUser for users cfg doesn't allow
+type DeniedError struct {
+	Decision auth.Decision
+	User     *auth.User // nil when the Reason is TokenInvalid
+}
+
+func (e *DeniedError) Error() string {
+	return "gothauth: access denied: " + string(e.Decision.Reason)
+}
+
+// Provider is a goth.Provider signing users in with a Config
+type Provider struct {
+	Config *auth.Config
+	name   string
+}
+
+// New returns a Provider named github for cfg
+func New(cfg *auth.Config) *Provider {
+	return &Provider{Config: cfg, name: "github"}
+}
+
+// Name implements goth.Provider
+func (p *Provider) Name() string {
+	return p.name
+}
+
+// SetName implements goth.Provider, for several organizations side by side
+func (p *Provider) SetName(name string) {
+	p.name = name
+}
+
+// Debug implements goth.Provider, use Config.Logger instead
+func (p *Provider) Debug(bool) {}
+
+// BeginAuth implements goth.Provider
+func (p *Provider) BeginAuth(state string) (goth.Session, error) {
+	return &Session{AuthURL: p.Config.AuthCodeURL(state)}, nil
+}
+
+// UnmarshalSession implements goth.Provider
+func (p *Provider) UnmarshalSession(data string) (goth.Session, error) {
+	s := new(Session)
+	err := json.Unmarshal([]byte(data), s)
+	return s, err
+}
+
+// FetchUser implements goth.Provider, checking the membership of the user
+// of s
+func (p *Provider) FetchUser(session goth.Session) (goth.User, error) {
+	s := session.(*Session)
+	if s.AccessToken == "" {
+		return goth.User{}, errNoToken
+	}
+	token := &oauth2.Token{AccessToken: s.AccessToken, RefreshToken: s.RefreshToken, Expiry: s.ExpiresAt}
+	decision, user, err := p.Config.Verify(context.Background(), token)
+	if err != nil && err != auth.ErrLinkRequired {
+		return goth.User{}, err
+	}
+	if !decision.Allowed {
+		return goth.User{}, &DeniedError{Decision: decision, User: user}
+	}
+
+	var teams []string
+	for _, t := range decision.Teams {
+		teams = append(teams, t.Slug)
+	}
+	return goth.User{
+		Provider:     p.name,
+		UserID:       strconv.FormatInt(user.ID, 10),
+		NickName:     user.Login,
+		Name:         user.Name,
+		Email:        user.Email,
+		AvatarURL:    user.Avatar,
+		AccessToken:  s.AccessToken,
+		RefreshToken: s.RefreshToken,
+		ExpiresAt:    s.ExpiresAt,
+		RawData: map[string]interface{}{
+			"login": user.Login,
+			"teams": teams,
+			"roles": decision.Roles,
+		},
+	}, nil
+}
+
+// RefreshTokenAvailable implements goth.Provider. OAuth app tokens don't
+// expire, see Config.TokenSource() for github apps
+func (p *Provider) RefreshTokenAvailable() bool {
+	return false
+}
+
+// RefreshToken implements goth.Provider
+func (p *Provider) RefreshToken(refreshToken string) (*oauth2.Token, error) {
+	return nil, errors.New("gothauth: refresh tokens aren't supported")
+}
+
+// Session is the goth.Session of Provider
+type Session struct {
+	AuthURL      string    `json:"auth_url"`
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at,omitempty"`
+}
+
+// GetAuthURL implements goth.Session
+func (s *Session) GetAuthURL() (string, error) {
+	if s.AuthURL == "" {
+		return "", errors.New(goth.NoAuthUrlErrorMessage)
+	}
+	return s.AuthURL, nil
+}
+
+// Marshal implements goth.Session
+func (s *Session) Marshal() string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// Authorize implements goth.Session, exchanging the code github gave the
+// callback
+func (s *Session) Authorize(provider goth.Provider, params goth.Params) (string, error) {
+	p := provider.(*Provider)
+	token, err := p.Config.Exchange(context.Background(), params.Get("code"))
+	if err != nil {
+		return "", err
+	}
+	s.AccessToken, s.RefreshToken, s.ExpiresAt = token.AccessToken, token.RefreshToken, token.Expiry
+	return token.AccessToken, nil
+}
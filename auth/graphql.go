@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// graphQLURL is github GraphQL api endpoint
+const graphQLURL = "https://api.github.com/graphql"
+
+// graphQLTeam is a team as returned by the membership query
+type graphQLTeam struct {
+	DatabaseID int64  `json:"databaseId"`
+	Name       string `json:"name"`
+	Slug       string `json:"slug"`
+	Members    struct {
+		Edges []struct {
+			Role string `json:"role"` // MEMBER or MAINTAINER
+			Node struct {
+				Login string `json:"login"`
+			} `json:"node"`
+		} `json:"edges"`
+		PageInfo struct {
+			HasNextPage bool `json:"hasNextPage"`
+		} `json:"pageInfo"`
+	} `json:"members"`
+}
+
+// role returns the team role of login, empty if they aren't in the members
+// we got
+func (t *graphQLTeam) role(login string) string {
+	for _, e := range t.Members.Edges {
+		if strings.EqualFold(e.Node.Login, login) {
+			return strings.ToLower(e.Role)
+		}
+	}
+	return ""
+}
+
+// graphQL POSTs query with vars to github and decodes the data of the
+// response into v. Errors github reports for missing teams are ignored,
+// those fields are simply null
+func graphQL(ctx context.Context, client *http.Client, query string, vars map[string]interface{}, v interface{}) (*http.Response, error) {
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": vars})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", graphQLURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		return resp, ErrUnauthorized
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp, statusError(resp)
+	}
+
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	for _, e := range result.Errors {
+		if e.Type != "NOT_FOUND" {
+			return nil, fmt.Errorf("auth: github graphql: %s", e.Message)
+		}
+	}
+	return resp, json.Unmarshal(result.Data, v)
+}
+
+// decideGraphQL is decide() with a single GraphQL query getting the user,
+// the Organization membership and the first members of each of slugs.
+// Users in big teams, or denied, may need one more request
+func (v *Verifier) decideGraphQL(ctx context.Context, client *http.Client, slugs []string) (Decision, *User, []Team, error) {
+	// each team gets an alias and a variable, so slugs never end up in the
+	// query text
+
+	vars := map[string]interface{}{"org": v.Organization}
+	var fields, params strings.Builder
+	for i, slug := range slugs {
+		vars[fmt.Sprintf("t%d", i)] = slug
+		fmt.Fprintf(&params, ", $t%d: String!", i)
+		fmt.Fprintf(&fields, " t%d: team(slug: $t%d) { ...team }", i, i)
+	}
+	query := `query($org: String!` + params.String() + `) {
+  viewer { databaseId login name email avatarUrl url company }
+  organization(login: $org) { viewerIsAMember` + fields.String() + ` }
+}
+fragment team on Team {
+  databaseId name slug
+  members(first: 100) { edges { role node { login } } pageInfo { hasNextPage } }
+}`
+
+	var data struct {
+		Viewer struct {
+			DatabaseID int64  `json:"databaseId"`
+			Login      string `json:"login"`
+			Name       string `json:"name"`
+			Email      string `json:"email"`
+			AvatarURL  string `json:"avatarUrl"`
+			URL        string `json:"url"`
+			Company    string `json:"company"`
+		} `json:"viewer"`
+		Organization map[string]json.RawMessage `json:"organization"`
+	}
+	resp, err := graphQL(ctx, client, query, vars, &data)
+	if err == ErrUnauthorized {
+		return Decision{Reason: TokenInvalid}, nil, nil, nil
+	}
+	if err != nil {
+		return Decision{}, nil, nil, err
+	}
+	user := &User{
+		ID:      data.Viewer.DatabaseID,
+		Login:   data.Viewer.Login,
+		Name:    data.Viewer.Name,
+		Email:   data.Viewer.Email,
+		Avatar:  data.Viewer.AvatarURL,
+		HTMLURL: data.Viewer.URL,
+		Company: data.Viewer.Company,
+	}
+	if !v.appToken && !hasOrgScope(resp.Header.Get("X-OAuth-Scopes")) {
+		return Decision{Reason: MissingScope}, user, nil, nil
+	}
+
+	var member bool
+	json.Unmarshal(data.Organization["viewerIsAMember"], &member)
+	if !member {
+		return v.orgDecision(ctx, client, user, nil)
+	}
+	if len(slugs) == 0 {
+		return v.decideOrg(ctx, client, user, nil)
+	}
+
+	// check the teams like decideDirect() does
+
+	var admitted *Team
+	for i := range slugs {
+		var gt *graphQLTeam
+		json.Unmarshal(data.Organization[fmt.Sprintf("t%d", i)], &gt)
+		role := ""
+		if gt != nil {
+			role = gt.role(user.Login)
+		}
+		if gt != nil && role == "" && gt.Members.PageInfo.HasNextPage {
+			if role, err = v.graphQLRole(ctx, client, gt.Slug, user.Login); err != nil {
+				return Decision{}, nil, nil, err
+			}
+		}
+
+		active := role != "" && (!v.RequireMaintainer || role == "maintainer")
+		if active && admitted == nil {
+			admitted = &Team{ID: gt.DatabaseID, Name: gt.Name, Slug: gt.Slug, Organization: v.Organization, Role: role}
+		}
+		if active && !v.RequireAll {
+			break
+		}
+		if !active && v.RequireAll {
+			admitted = nil
+			break
+		}
+	}
+	if admitted == nil {
+		return Decision{Reason: NotInTeam}, user, nil, nil
+	}
+	return v.admit(ctx, client, user, admitted, nil)
+}
+
+// graphQLRole looks login up among the members of a team too big for the
+// first page, returning their role or empty
+func (v *Verifier) graphQLRole(ctx context.Context, client *http.Client, slug, login string) (string, error) {
+	const query = `query($org: String!, $slug: String!, $login: String!) {
+  organization(login: $org) { team(slug: $slug) {
+    databaseId name slug
+    members(first: 100, query: $login) { edges { role node { login } } pageInfo { hasNextPage } }
+  } }
+}`
+	var data struct {
+		Organization struct {
+			Team *graphQLTeam `json:"team"`
+		} `json:"organization"`
+	}
+	vars := map[string]interface{}{"org": v.Organization, "slug": slug, "login": login}
+	if _, err := graphQL(ctx, client, query, vars, &data); err != nil {
+		return "", err
+	}
+	if data.Organization.Team == nil {
+		return "", nil
+	}
+	return data.Organization.Team.role(login), nil
+}
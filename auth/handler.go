@@ -0,0 +1,374 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// stateCookie keeps the OAuth2 state between /login and /callback
+const stateCookie = "auth_state"
+
+// Handler serves the login flow, mount it where RedirectURL points to:
+//
+//	/login    sends the user to github, ?next=/path to come back there
+//	/callback verifies the user and starts their session
+//	/logout   ends the session, then goes to ?next= or /
+//
+// Any path ending in those works, so it can be mounted under a prefix
+// without http.StripPrefix. Denied users get a 403 explaining why
+func (c *Config) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/login"):
+			if c.RateLimit.limit(w, r, EndpointLogin) {
+				return
+			}
+			c.login(w, r)
+		case strings.HasSuffix(r.URL.Path, "/callback"):
+			if c.RateLimit.limit(w, r, EndpointCallback) {
+				return
+			}
+			c.callback(w, r)
+		case strings.HasSuffix(r.URL.Path, "/logout"):
+			if err := c.Logout(w, r); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			next := c.nextURL(r.FormValue("next"))
+			if next == "" {
+				next = "/"
+			}
+			http.Redirect(w, r, next, http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// Middleware only lets requests with a session through to next, storing
+// the User and Decision in the request context, see UserFromContext().
+// Other GET requests are sent to LoginURL to sign in, the rest get a 401
+func (c *Config) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r2, err := c.Authenticate(w, r)
+		if err == nil {
+			next.ServeHTTP(w, r2)
+			return
+		}
+		if ssoRedirect(w, r, err) {
+			return
+		}
+		if err == ErrLinkRequired && c.LinkURL != "" && r.Method == "GET" {
+			http.Redirect(w, r, c.LinkURL+"?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+			return
+		}
+		if err == ErrLinkRequired {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err != ErrNoSession {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if r.Method != "GET" {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, c.LoginRedirect(r), http.StatusFound)
+	})
+}
+
+// Authenticate is the check of Middleware() for framework adapters: it
+// returns r with the User, Decision and token of its session in the
+// context, ErrNoSession when the user has to sign in or ErrLinkRequired
+// when their session waits for CompleteLink()
+func (c *Config) Authenticate(w http.ResponseWriter, r *http.Request) (*http.Request, error) {
+	r = r.WithContext(WithClientIP(r.Context(), ClientIP(r)))
+	s, err := c.sessions().Load(r)
+	if err == nil && c.Reverifier != nil && c.Reverifier.Revoked(s.ID) {
+		c.Reverifier.Forget(s.ID)
+		if err := c.sessions().Delete(w, r); err != nil {
+			return nil, err
+		}
+		return nil, ErrNoSession
+	}
+	if err == nil && s.User != nil && s.Decision.Allowed && c.Cache != nil {
+		s.Decision, err = c.reverify(w, r, s)
+	} else if err == nil && s.User != nil && s.Decision.Allowed && c.ReverifyEvery > 0 {
+		s.Decision, err = c.recheck(w, r, s)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.User == nil || !s.Decision.Allowed {
+		return nil, ErrNoSession
+	}
+	if s.Pending {
+		return nil, ErrLinkRequired
+	}
+	ctx := WithDecision(WithUser(r.Context(), s.User), s.Decision)
+	if s.Token != nil {
+		ctx = WithToken(ctx, s.Token)
+	}
+	return r.WithContext(ctx), nil
+}
+
+// LoginRedirect returns the LoginURL bringing users back to r once signed in
+func (c *Config) LoginRedirect(r *http.Request) string {
+	return c.loginURL() + "?next=" + url.QueryEscape(r.URL.RequestURI())
+}
+
+// login sends the user to github with a signed state, also kept in a
+// cookie to be checked by callback. With a UI users see the sign in page
+// first, its button comes back here with start set
+func (c *Config) login(w http.ResponseWriter, r *http.Request) {
+	if c.UI != nil && r.FormValue("start") == "" {
+		u := r.URL.Path + "?start=1&next=" + url.QueryEscape(c.nextURL(r.FormValue("next")))
+		c.UI.RenderLogin(w, r, u, c.pageData(nil))
+		return
+	}
+	state, err := c.NewState(r.FormValue("next"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	cookie := c.Cookie.cookie(state, time.Now().Add(stateTTL))
+	cookie.Name = stateCookie
+	http.SetCookie(w, cookie)
+	http.Redirect(w, r, c.AuthCodeURLForRequest(r, state), http.StatusFound)
+}
+
+// callback checks the state, verifies the user and saves their session
+func (c *Config) callback(w http.ResponseWriter, r *http.Request) {
+	r = r.WithContext(WithClientIP(r.Context(), ClientIP(r)))
+	cookie, err := r.Cookie(stateCookie)
+	if err != nil {
+		http.Error(w, "auth: missing login state", http.StatusBadRequest)
+		return
+	}
+
+	// states are single use, the cookie goes away whatever happens next
+
+	expired := c.Cookie.cookie("", time.Time{})
+	expired.Name = stateCookie
+	http.SetCookie(w, expired)
+
+	state := r.FormValue("state")
+	if subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		http.Error(w, ErrStateMismatch.Error(), http.StatusBadRequest)
+		return
+	}
+	next, err := c.ValidateState(state)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if e := r.FormValue("error"); e != "" {
+		http.Error(w, "auth: github: "+e, http.StatusForbidden)
+		return
+	}
+
+	token, err := c.ExchangeForRequest(r.Context(), r, r.FormValue("code"))
+	if err != nil {
+		http.Error(w, err.Error(), gatewayStatus(err))
+		return
+	}
+	decision, user, err := c.Verify(r.Context(), token)
+	if ssoRedirect(w, r, err) {
+		return
+	}
+
+	// users to link get a pending session, finished by CompleteLink()
+
+	pending := err == ErrLinkRequired
+	if pending && c.LinkURL == "" {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if pending {
+		err = nil
+	}
+	if user != nil && c.RateLimit.limitKey(w, r, EndpointCallback+"|login:"+strings.ToLower(user.Login)) {
+		return
+	}
+	if reason, ok := ReasonOf(err); ok {
+		decision, err = Decision{Reason: reason}, nil
+	}
+	if err != nil {
+		http.Error(w, err.Error(), gatewayStatus(err))
+		return
+	}
+	if !decision.Allowed && c.UI != nil {
+		data := c.pageData(user)
+		if c.RequestAccessURL != "" && user != nil {
+			data.RequestAccessURL = c.RequestAccessURL
+			if data.RequestToken, err = c.requestToken(user, decision.Reason); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		c.UI.RenderDenied(w, r, decision.Reason, c.loginURL(), data)
+		return
+	}
+	if !decision.Allowed {
+		http.Error(w, "auth: access denied: "+string(decision.Reason), http.StatusForbidden)
+		return
+	}
+
+	var keep *oauth2.Token
+	if c.KeepToken {
+		keep = token
+	}
+	s, err := c.saveSession(w, r, user, decision, keep, pending)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if c.Reverifier != nil {
+		c.Reverifier.Track(s.ID, token)
+	}
+	if err := c.Remember(r.Context(), user, decision, token); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := c.saveToken(r.Context(), user, token); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if next == "" {
+		next = "/"
+	}
+	if pending {
+		next = c.LinkURL + "?next=" + url.QueryEscape(next)
+	}
+	http.Redirect(w, r, next, http.StatusFound)
+}
+
+// reverify returns the cached decision for the user of s, ending the
+// session when they lost access. Sessions from before the cache was set up
+// keep their decision
+func (c *Config) reverify(w http.ResponseWriter, r *http.Request, s *Session) (Decision, error) {
+	decision, err := c.ReverifyMembership(r.Context(), s.User.Login)
+	if err == ErrNotCached {
+		return s.Decision, nil
+	}
+	if err != nil {
+		return Decision{}, err
+	}
+	if !decision.Allowed {
+		return decision, c.sessions().Delete(w, r)
+	}
+	return decision, nil
+}
+
+// recheck verifies the user of s again when ReverifyEvery passed since the
+// last check, ending the session when they lost access. Sessions without a
+// token keep their decision unless there's a ServerToken
+func (c *Config) recheck(w http.ResponseWriter, r *http.Request, s *Session) (Decision, error) {
+	checked := s.Checked
+	if checked.IsZero() {
+		checked = s.Created
+	}
+	if time.Since(checked) < c.ReverifyEvery {
+		return s.Decision, nil
+	}
+
+	if s.Token == nil && c.ServerToken == nil {
+		return s.Decision, nil
+	}
+	decision, err := c.shared(r.Context(), s.User.Login, func(ctx context.Context) (Decision, error) {
+		if s.Token == nil {
+			return c.checkUser(ctx, s.User, true)
+		}
+		decision, _, err := c.Verify(ctx, s.Token)
+		if err == ErrLinkRequired {
+			err = nil
+		}
+		return decision, err
+	})
+	if err != nil {
+		return Decision{}, err
+	}
+	if !decision.Allowed {
+		return decision, c.sessions().Delete(w, r)
+	}
+	s.Decision, s.Checked = decision, time.Now()
+	return decision, c.updateSession(w, r, s)
+}
+
+// pageData returns the PageData of the UI pages for user, nil if unknown
+func (c *Config) pageData(user *User) PageData {
+	return PageData{
+		Organization: c.Organization,
+		Team:         c.Team,
+		User:         user,
+		EmailDomains: strings.Join(c.AllowedEmailDomains, ", "),
+	}
+}
+
+// gatewayStatus is the status answered when talking to github failed
+func gatewayStatus(err error) int {
+	if errors.Is(err, ErrTimeout) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+// sessions returns c.Sessions, an in memory store if not set. Use
+// CookieSessions when running several instances without shared storage
+func (c *Config) sessions() SessionStore {
+	c.sessionsOnce.Do(func() {
+		if c.Sessions == nil {
+			c.Sessions = &ServerSessions{Backend: &MemoryBackend{}, Cookie: c.Cookie}
+		}
+	})
+	return c.Sessions
+}
+
+func (c *Config) sessionTTL() time.Duration {
+	if c.SessionTTL == 0 {
+		return 12 * time.Hour
+	}
+	return c.SessionTTL
+}
+
+func (c *Config) loginURL() string {
+	if c.LoginURL == "" {
+		return "/login"
+	}
+	return c.LoginURL
+}
+
+// nextURL returns next if it's a path on this site or an http(s) url on
+// one of RedirectHosts, empty otherwise
+func (c *Config) nextURL(next string) string {
+	if p := localPath(next); p != "" {
+		return p
+	}
+	u, err := url.Parse(next)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.User != nil {
+		return ""
+	}
+	for _, host := range c.RedirectHosts {
+		if strings.EqualFold(u.Host, host) {
+			return next
+		}
+	}
+	return ""
+}
+
+// localPath returns p if it's a path on this site, empty otherwise, so
+// ?next= can't redirect users elsewhere
+func localPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return ""
+	}
+	return p
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// identityHeader is the default header of HeaderSigner
+const identityHeader = "X-Auth-User"
+
+// HeaderSigner propagates the identity of signed in users to internal
+// services. The frontend signs a header carrying the user Claims with
+// Forward() or Sign(), services behind it trust the header with Middleware()
+// instead of calling github
+type HeaderSigner struct {
+	// Keys are HMAC keys. The first one signs, all of them verify, so keys
+	// can be rotated by prepending a new one
+	Keys [][]byte
+
+	TTL    time.Duration // header lifetime, 1 minute if zero
+	Header string        // "X-Auth-User" if empty
+}
+
+func (s *HeaderSigner) header() string {
+	if s.Header == "" {
+		return identityHeader
+	}
+	return s.Header
+}
+
+// Sign returns the header value for an allowed user, the base64 Claims and
+// their signature separated by a dot
+func (s *HeaderSigner) Sign(user *User, decision Decision) (string, error) {
+	if user == nil || !decision.Allowed {
+		return "", ErrNotAllowed
+	}
+	if len(s.Keys) == 0 {
+		return "", errNoKeys
+	}
+
+	ttl := s.TTL
+	if ttl == 0 {
+		ttl = time.Minute
+	}
+	claims := NewClaims(user, decision)
+	claims.ExpiresAt = time.Now().Add(ttl).Unix()
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + jwtSign(s.Keys[0], signed), nil
+}
+
+// Verify checks value was signed with one of the Keys and hasn't expired,
+// returning its Claims
+func (s *HeaderSigner) Verify(value string) (*Claims, error) {
+	i := strings.IndexByte(value, '.')
+	if i < 0 {
+		return nil, ErrTokenRejected
+	}
+	signed, sig := value[:i], value[i+1:]
+	valid := false
+	for _, key := range s.Keys {
+		valid = valid || hmac.Equal([]byte(sig), []byte(jwtSign(key, signed)))
+	}
+	if !valid {
+		return nil, ErrTokenRejected
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(signed)
+	if err != nil {
+		return nil, ErrTokenRejected
+	}
+	claims := new(Claims)
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, ErrTokenRejected
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenRejected
+	}
+	return claims, nil
+}
+
+// Forward signs the header for the user in the request context before
+// handing r to next, usually an httputil.ReverseProxy behind
+// Config.Middleware(). Headers sent by the client are always dropped, so
+// they can't be forged
+func (s *HeaderSigner) Forward(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del(s.header())
+		user, ok := UserFromContext(r.Context())
+		decision, _ := DecisionFromContext(r.Context())
+		if ok && decision.Allowed {
+			value, err := s.Sign(user, decision)
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			r.Header.Set(s.header(), value)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Middleware only lets requests with a valid header through to next,
+// storing its Claims in the request context, see ClaimsFromContext()
+func (s *HeaderSigner) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := s.Verify(r.Header.Get(s.header()))
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), claims)))
+	})
+}
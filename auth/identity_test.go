@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHeaderSigner(t *testing.T) {
+	user := &User{ID: 1, Login: "alice"}
+	decision := Decision{Allowed: true}
+	tests := []struct {
+		name    string
+		signer  *HeaderSigner
+		checker *HeaderSigner
+		change  func(string) string
+		ok      bool
+	}{
+		{"signed", &HeaderSigner{Keys: [][]byte{[]byte("k1")}}, &HeaderSigner{Keys: [][]byte{[]byte("k1")}}, nil, true},
+		{"rotated", &HeaderSigner{Keys: [][]byte{[]byte("k1")}}, &HeaderSigner{Keys: [][]byte{[]byte("k2"), []byte("k1")}}, nil, true},
+		{"wrong key", &HeaderSigner{Keys: [][]byte{[]byte("k1")}}, &HeaderSigner{Keys: [][]byte{[]byte("k2")}}, nil, false},
+		{"expired", &HeaderSigner{Keys: [][]byte{[]byte("k1")}, TTL: -time.Minute}, &HeaderSigner{Keys: [][]byte{[]byte("k1")}}, nil, false},
+		{"no signature", &HeaderSigner{Keys: [][]byte{[]byte("k1")}}, &HeaderSigner{Keys: [][]byte{[]byte("k1")}}, func(v string) string { return v[:len(v)-44] }, false},
+		{"changed payload", &HeaderSigner{Keys: [][]byte{[]byte("k1")}}, &HeaderSigner{Keys: [][]byte{[]byte("k1")}}, func(v string) string { return "e30" + v[3:] }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := tt.signer.Sign(user, decision)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.change != nil {
+				value = tt.change(value)
+			}
+			claims, err := tt.checker.Verify(value)
+			if !tt.ok {
+				if err != ErrTokenRejected {
+					t.Errorf("Verify() error = %v, want ErrTokenRejected", err)
+				}
+				return
+			}
+			if err != nil || claims.Login != "alice" {
+				t.Errorf("Verify() = %+v, %v", claims, err)
+			}
+		})
+	}
+
+	if _, err := (&HeaderSigner{}).Sign(user, decision); err != errNoKeys {
+		t.Errorf("Sign() without keys error = %v, want errNoKeys", err)
+	}
+}
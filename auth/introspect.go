@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/oauth2/github"
+)
+
+// redacted replaces secrets in ConfigInfo
+const redacted = "[REDACTED]"
+
+// ConfigInfo is the effective configuration of a Config with secrets
+// redacted, so operators can confirm what a running instance enforces
+type ConfigInfo struct {
+	Organization            string   `json:"organization"`
+	Team                    string   `json:"team,omitempty"`
+	AllowedTeams            []string `json:"allowed_teams,omitempty"`
+	TeamIDs                 []int64  `json:"team_ids,omitempty"`
+	TeamRegexps             []string `json:"team_regexps,omitempty"`
+	RequireAll              bool     `json:"require_all"`
+	RequirePublicMembership bool     `json:"require_public_membership"`
+	RequireMaintainer       bool     `json:"require_maintainer"`
+	AllowOrgAdmins          bool     `json:"allow_org_admins"`
+	RequireTwoFactor        bool     `json:"require_two_factor"`
+	IncludeChildTeams       bool     `json:"include_child_teams"`
+	Repository              string   `json:"repository,omitempty"`
+	MinPermission           string   `json:"min_permission,omitempty"`
+	AllowedEmailDomains     []string `json:"allowed_email_domains,omitempty"`
+	CaseSensitive           bool     `json:"case_sensitive"`
+	SlugOnly                bool     `json:"slug_only"`
+	IdPGroups               bool     `json:"idp_groups"`
+	DirectMembership        bool     `json:"direct_membership"`
+	AllowUsers              []string `json:"allow_users,omitempty"`
+	DenyUsers               []string `json:"deny_users,omitempty"`
+	GraphQL                 bool     `json:"graphql"`
+	ClientID                string   `json:"client_id"`
+	ClientSecret            string   `json:"client_secret"`
+	PublicClient            bool     `json:"public_client"`
+	RedirectURL             string   `json:"redirect_url,omitempty"`
+	RedirectURLs            []string `json:"redirect_urls,omitempty"`
+	Scopes                  []string `json:"scopes"`
+	AuthURL                 string   `json:"auth_url"`
+	TokenURL                string   `json:"token_url"`
+	MaxStaleness            string   `json:"max_staleness,omitempty"`  // set when falling back to Snapshots
+	CacheTTL                string   `json:"cache_ttl,omitempty"`      // set when memberships are cached
+	ReverifyEvery           string   `json:"reverify_every,omitempty"` // set when sessions are checked again
+	Timeout                 string   `json:"timeout"`                  // bound of github requests, "none" if disabled
+	Hooks                   []string `json:"hooks,omitempty"`          // optional hooks in use
+
+	Session SessionConfigInfo `json:"session"`
+}
+
+// SessionConfigInfo is the part of ConfigInfo about the sessions of Handler()
+type SessionConfigInfo struct {
+	Store          string `json:"store"` // SessionStore type, the in memory default if unset
+	TTL            string `json:"ttl"`
+	CookieName     string `json:"cookie_name"`
+	CookiePath     string `json:"cookie_path"`
+	CookieDomain   string `json:"cookie_domain,omitempty"`
+	Insecure       bool   `json:"insecure"`
+	KeepToken      bool   `json:"keep_token"`
+	RevokeOnLogout bool   `json:"revoke_on_logout"`
+}
+
+// Info returns the effective configuration of c with secrets redacted.
+// It only reads c, so it's safe to call before c is first used
+func (c *Config) Info() ConfigInfo {
+	info := ConfigInfo{
+		Organization:            c.Organization,
+		Team:                    c.Team,
+		AllowedTeams:            c.AllowedTeams,
+		TeamIDs:                 c.TeamIDs,
+		RequireAll:              c.RequireAll,
+		RequirePublicMembership: c.RequirePublicMembership,
+		RequireMaintainer:       c.RequireMaintainer,
+		AllowOrgAdmins:          c.AllowOrgAdmins,
+		RequireTwoFactor:        c.RequireTwoFactor,
+		IncludeChildTeams:       c.IncludeChildTeams,
+		Repository:              c.Repository,
+		AllowedEmailDomains:     c.AllowedEmailDomains,
+		CaseSensitive:           c.CaseSensitive,
+		SlugOnly:                c.SlugOnly,
+		IdPGroups:               c.IdPGroups,
+		DirectMembership:        c.DirectMembership,
+		AllowUsers:              c.AllowUsers,
+		DenyUsers:               c.DenyUsers,
+		GraphQL:                 c.GraphQL,
+		ClientID:                c.ClientID,
+		PublicClient:            c.PublicClient,
+		RedirectURL:             c.RedirectURL,
+		RedirectURLs:            c.RedirectURLs,
+		Scopes:                  c.scopes(),
+		AuthURL:                 github.Endpoint.AuthURL,
+		TokenURL:                github.Endpoint.TokenURL,
+		Timeout:                 c.timeout().String(),
+		Session: SessionConfigInfo{
+			Store:          "*auth.ServerSessions",
+			TTL:            c.sessionTTL().String(),
+			CookieName:     c.Cookie.name(),
+			CookiePath:     c.Cookie.path(),
+			CookieDomain:   c.Cookie.Domain,
+			Insecure:       c.Cookie.Insecure,
+			KeepToken:      c.KeepToken,
+			RevokeOnLogout: c.RevokeOnLogout,
+		},
+	}
+	if c.Sessions != nil {
+		info.Session.Store = fmt.Sprintf("%T", c.Sessions)
+	}
+	if c.Timeout < 0 {
+		info.Timeout = "none"
+	}
+	if c.ClientSecret != "" {
+		info.ClientSecret = redacted
+	}
+	for _, re := range c.TeamRegexps {
+		info.TeamRegexps = append(info.TeamRegexps, re.String())
+	}
+	if c.Snapshots != nil {
+		info.MaxStaleness = c.MaxStaleness.String()
+	}
+	if c.Repository != "" {
+		info.MinPermission = c.verifier().minPermission()
+	}
+	if c.Cache != nil {
+		info.CacheTTL = c.cacheTTL().String()
+	} else if c.ReverifyEvery > 0 {
+		info.ReverifyEvery = c.ReverifyEvery.String()
+	}
+	if c.DecodeUser != nil {
+		info.Hooks = append(info.Hooks, "DecodeUser")
+	}
+	if c.Roles != nil {
+		info.Hooks = append(info.Hooks, "Roles")
+	}
+	if c.Claims != nil {
+		info.Hooks = append(info.Hooks, "Claims")
+	}
+	if c.Authorizer != nil {
+		info.Hooks = append(info.Hooks, "Authorizer")
+	}
+	if c.Authorize != nil {
+		info.Hooks = append(info.Hooks, "Authorize")
+	}
+	return info
+}
+
+// InfoHandler serves c.Info() as json. allow gates access, for example by
+// checking the request comes from an admin; requests it rejects get a 403.
+// A nil allow rejects everybody, so the handler is never exposed by accident
+func (c *Config) InfoHandler(allow func(r *http.Request) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if allow == nil || !allow(r) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c.Info())
+	})
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Event types published by TeamProvisioner
+const (
+	EventProvisioned     EventType = "provisioned"      // user added to the team
+	EventProvisionFailed EventType = "provision_failed" // adding the user failed
+)
+
+// TeamProvisioner adds Organization members who aren't in the team yet to
+// it on their first login, when they have a verified email on one of
+// EmailDomains. It removes the manual onboarding step for teams everybody
+// in the company should be in. Set it as Config.JIT
+//
+// The new membership then goes through the same checks as any other:
+// RequireAll still needs the other teams, RequireMaintainer is never met
+// since users are added as members, and Repository, AllowedEmailDomains,
+// AllowUsers/DenyUsers, Authorizer, Roles and Authorize all apply
+type TeamProvisioner struct {
+	// Admin is a client authorized as an organization owner or team
+	// maintainer, e.g. through a GitHub App installation token. It's used
+	// to add members, the users' own tokens can't
+	Admin *http.Client
+
+	// Team is the slug of the team members get added to
+	Team string
+
+	// EmailDomains are the domains, like example.com, of which the user
+	// must have a verified email. Required, provisioning is skipped for
+	// everybody when empty
+	EmailDomains []string
+
+	// Events receives a provisioned or provision_failed Event for every
+	// attempt, as an audit trail
+	Events Publisher
+}
+
+// email is an entry of the /user/emails response
+type email struct {
+	Email    string `json:"email"`
+	Verified bool   `json:"verified"`
+	Primary  bool   `json:"primary"`
+}
+
+// jit runs v.JIT when decision denied user only for not being in a team,
+// returning the decision and teams counting the new membership
+func (v *Verifier) jit(ctx context.Context, client *http.Client, user *User, teams []Team, decision Decision) (Decision, []Team, error) {
+	if v.JIT == nil || decision.Allowed || decision.Reason != NotInTeam {
+		return decision, teams, nil
+	}
+	t, denied, err := v.JIT.provision(ctx, client, v.Organization, user)
+	if err != nil || t == nil {
+		return decision, teams, err
+	}
+	if denied != "" {
+		return Decision{Reason: denied, Teams: decision.Teams, OrgRole: decision.OrgRole}, teams, nil
+	}
+	teams = append(teams, *t)
+	if v.RequireMaintainer {
+		return decision, teams, nil
+	}
+	if match := v.matchTeams(v.orgTeams(teams)); match != nil {
+		return Decision{Allowed: true, Team: match, OrgRole: decision.OrgRole}, teams, nil
+	}
+	return decision, teams, nil
+}
+
+// provision adds user to the team if they pass the email rule, returning
+// the team, nil if they weren't added, and PendingInvite as denied when
+// github only invited them
+func (p *TeamProvisioner) provision(ctx context.Context, client *http.Client, org string, user *User) (*Team, Reason, error) {
+	if len(p.EmailDomains) == 0 {
+		return nil, "", nil
+	}
+	ok, err := verifiedEmailIn(ctx, client, user, p.EmailDomains)
+	if err != nil || !ok {
+		return nil, "", err
+	}
+	decision := Decision{Reason: NotInTeam}
+
+	u := fmt.Sprintf("https://api.github.com/orgs/%s/teams/%s/memberships/%s",
+		url.PathEscape(org), url.PathEscape(p.Team), url.PathEscape(user.Login))
+	req, err := http.NewRequestWithContext(ctx, "PUT", u, strings.NewReader(`{"role":"member"}`))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.Admin.Do(req)
+	if err == nil {
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			err = statusError(resp)
+		}
+	}
+	if err != nil {
+		e := NewEvent(EventProvisionFailed, org, user, &decision)
+		p.publish(ctx, e)
+		return nil, "", err
+	}
+
+	var m teamMembership
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		return nil, "", err
+	}
+	t := &Team{Name: p.Team, Slug: p.Team, Organization: org, Role: m.Role}
+	var denied Reason
+	if m.State == "active" {
+		decision = Decision{Allowed: true, Team: t}
+	} else {
+		denied = PendingInvite
+		decision = Decision{Reason: denied}
+	}
+	p.publish(ctx, NewEvent(EventProvisioned, org, user, &decision))
+	return t, denied, nil
+}
+
+func (p *TeamProvisioner) publish(ctx context.Context, e Event) {
+	if p.Events != nil {
+		p.Events.Publish(ctx, e)
+	}
+}
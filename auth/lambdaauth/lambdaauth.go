@@ -0,0 +1,106 @@
+// Package lambdaauth implements the API Gateway Lambda authorizer contract,
+// for both TOKEN and REQUEST authorizers, backed by the auth verification
+// logic so serverless APIs can reuse the same org/team gate
+//
+//	a := &lambdaauth.Authorizer{Tokens: &auth.TokenIssuer{Keys: keys}}
+//	lambda.Start(a.HandleToken)
+package lambdaauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/RealGeeks/github-org-auth/auth"
+	"github.com/aws/aws-lambda-go/events"
+	"golang.org/x/oauth2"
+)
+
+// ErrUnauthorized makes API Gateway answer 401, as its contract requires
+var ErrUnauthorized = errors.New("Unauthorized")
+
+// Authorizer decides whether API Gateway lets a request through. Bearer
+// credentials are tried as tokens minted by Tokens first and then, when
+// Verifier is set, as github access tokens
+type Authorizer struct {
+	Tokens   *auth.TokenIssuer // verifies session tokens, optional
+	Verifier *auth.Verifier    // verifies github access tokens, optional
+	Cookie   string            // cookie holding the token for REQUEST authorizers, optional
+}
+
+// HandleToken handles TOKEN authorizer events
+func (a *Authorizer) HandleToken(ctx context.Context, event events.APIGatewayCustomAuthorizerRequest) (events.APIGatewayCustomAuthorizerResponse, error) {
+	return a.authorize(ctx, strings.TrimPrefix(event.AuthorizationToken, "Bearer "), event.MethodArn)
+}
+
+// HandleRequest handles REQUEST authorizer events, reading the token from
+// the Authorization header or Cookie
+func (a *Authorizer) HandleRequest(ctx context.Context, event events.APIGatewayCustomAuthorizerRequestTypeRequest) (events.APIGatewayCustomAuthorizerResponse, error) {
+	header := http.Header{}
+	for k, v := range event.Headers {
+		header.Set(k, v)
+	}
+	token := strings.TrimPrefix(header.Get("Authorization"), "Bearer ")
+	if token == "" && a.Cookie != "" {
+		r := http.Request{Header: header}
+		if c, err := r.Cookie(a.Cookie); err == nil {
+			token = c.Value
+		}
+	}
+	return a.authorize(ctx, token, event.MethodArn)
+}
+
+// authorize verifies token and builds the policy for methodArn
+func (a *Authorizer) authorize(ctx context.Context, token, methodArn string) (events.APIGatewayCustomAuthorizerResponse, error) {
+	if token == "" {
+		return events.APIGatewayCustomAuthorizerResponse{}, ErrUnauthorized
+	}
+
+	if a.Tokens != nil {
+		if claims, err := a.Tokens.Verify(token); err == nil {
+			return policy(claims.Login, "Allow", methodArn, claims), nil
+		}
+	}
+	if a.Verifier == nil {
+		return events.APIGatewayCustomAuthorizerResponse{}, ErrUnauthorized
+	}
+
+	decision, user, err := a.Verifier.VerifyToken(ctx, &oauth2.Token{AccessToken: token})
+	if err != nil {
+		return events.APIGatewayCustomAuthorizerResponse{}, err
+	}
+	if user == nil {
+		return events.APIGatewayCustomAuthorizerResponse{}, ErrUnauthorized
+	}
+	if !decision.Allowed {
+		return policy(user.Login, "Deny", methodArn, nil), nil
+	}
+	claims := auth.NewClaims(user, decision)
+	return policy(user.Login, "Allow", methodArn, &claims), nil
+}
+
+// policy builds an authorizer response with effect on methodArn. The claims
+// end up in the request context of the integration
+func policy(principal, effect, methodArn string, claims *auth.Claims) events.APIGatewayCustomAuthorizerResponse {
+	resp := events.APIGatewayCustomAuthorizerResponse{
+		PrincipalID: principal,
+		PolicyDocument: events.APIGatewayCustomAuthorizerPolicy{
+			Version: "2012-10-17",
+			Statement: []events.IAMPolicyStatement{{
+				Action:   []string{"execute-api:Invoke"},
+				Effect:   effect,
+				Resource: []string{methodArn},
+			}},
+		},
+	}
+	if claims != nil {
+		resp.Context = map[string]interface{}{
+			"login": claims.Login,
+			"name":  claims.Name,
+			"teams": strings.Join(claims.Teams, ","),
+			"roles": strings.Join(claims.Roles, ","),
+		}
+	}
+	return resp
+}
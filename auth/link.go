@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ErrLinkRequired is returned by an AccountLinker which wants the user to
+// pick or confirm their internal account first. Verify() returns it along
+// with the Decision and User, so the application can show its prompt and
+// link them with its own logic
+var ErrLinkRequired = errors.New("auth: account link required")
+
+// AccountLinker maps github identities to application accounts, keyed by
+// the immutable User.ID since logins can change. Link is called for every
+// allowed user and returns the internal account id, creating the account on
+// first login if it wants to, or ErrLinkRequired
+type AccountLinker interface {
+	Link(ctx context.Context, user *User) (accountID string, err error)
+}
+
+// AccountLinkerFunc is a func implementing AccountLinker
+type AccountLinkerFunc func(ctx context.Context, user *User) (string, error)
+
+// Link implements AccountLinker
+func (f AccountLinkerFunc) Link(ctx context.Context, user *User) (string, error) {
+	return f(ctx, user)
+}
+
+// link sets user.AccountID with c.Accounts, if set, for allowed users
+func (c *Config) link(ctx context.Context, user *User, decision Decision) error {
+	if c.Accounts == nil || !decision.Allowed || user == nil || user.AccountID != "" {
+		return nil
+	}
+	id, err := c.Accounts.Link(ctx, user)
+	if err != nil {
+		return err
+	}
+	user.AccountID = id
+	return nil
+}
+
+// PendingUser returns the user of the pending session of r, the one to
+// link on the LinkURL page. ErrNoSession if r has no pending session
+func (c *Config) PendingUser(r *http.Request) (*User, error) {
+	s, err := c.sessions().Load(r)
+	if err != nil {
+		return nil, err
+	}
+	if !s.Pending || s.User == nil {
+		return nil, ErrNoSession
+	}
+	return s.User, nil
+}
+
+// CompleteLink links the user of the pending session of r to accountID,
+// after which Middleware() lets them through. ErrNoSession if r has no
+// pending session
+func (c *Config) CompleteLink(w http.ResponseWriter, r *http.Request, accountID string) error {
+	s, err := c.sessions().Load(r)
+	if err != nil {
+		return err
+	}
+	if !s.Pending || s.User == nil {
+		return ErrNoSession
+	}
+	s.User.AccountID, s.Pending = accountID, false
+	return c.sessions().Save(w, r, s)
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// logVerify records the outcome of Verify() on c.Logger, if any
+func (c *Config) logVerify(ctx context.Context, took time.Duration, decision Decision, user *User, err error) {
+	if c.Logger == nil {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("organization", c.Organization),
+		slog.Duration("took", took),
+	}
+	if user != nil {
+		attrs = append(attrs, slog.String("login", user.Login))
+	}
+	switch {
+	case err != nil && err != ErrLinkRequired:
+		attrs = append(attrs, slog.String("error", err.Error()))
+		c.Logger.LogAttrs(ctx, slog.LevelError, "auth: verification failed", attrs...)
+	case decision.Allowed:
+		if decision.Team != nil {
+			attrs = append(attrs, slog.String("team", decision.Team.Slug))
+		}
+		if decision.Stale {
+			c.Logger.LogAttrs(ctx, slog.LevelWarn, "auth: github unreachable, user allowed by a remembered decision", attrs...)
+			return
+		}
+		c.Logger.LogAttrs(ctx, slog.LevelInfo, "auth: user allowed", attrs...)
+	default:
+		attrs = append(attrs, slog.String("reason", string(decision.Reason)), slog.String("team", c.Team))
+		c.Logger.LogAttrs(ctx, slog.LevelWarn, "auth: user denied", attrs...)
+	}
+}
+
+// logClient returns a copy of base logging every request on logger, base
+// itself if logger is nil
+func logClient(base *http.Client, logger *slog.Logger) *http.Client {
+	if logger == nil {
+		return base
+	}
+	if base == nil {
+		base = http.DefaultClient
+	}
+	c := *base
+	c.Transport = &logTransport{base: base.Transport, logger: logger}
+	return &c
+}
+
+// logTransport logs the method, url without query, status and latency of
+// requests. Headers, with the tokens, are left out
+type logTransport struct {
+	base   http.RoundTripper
+	logger *slog.Logger
+}
+
+func (t *logTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	start := time.Now()
+	resp, err := base.RoundTrip(r)
+	attrs := []slog.Attr{
+		slog.String("method", r.Method),
+		slog.String("url", r.URL.Scheme+"://"+r.URL.Host+r.URL.Path),
+		slog.Duration("took", time.Since(start)),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+		t.logger.LogAttrs(r.Context(), slog.LevelWarn, "auth: github request failed", attrs...)
+		return resp, err
+	}
+	attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	if remaining := resp.Header.Get("X-RateLimit-Remaining"); remaining != "" {
+		attrs = append(attrs, slog.String("rate_limit_remaining", remaining))
+	}
+	t.logger.LogAttrs(r.Context(), slog.LevelDebug, "auth: github request", attrs...)
+	return resp, nil
+}
@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrMachineDenied is returned by AppVerifier for machine credentials github
+// accepts but which don't belong to an allowed app on Organization
+var ErrMachineDenied = errors.New("auth: github app is not allowed")
+
+// Machine is a service authenticated with GitHub App credentials instead of
+// a human user
+type Machine struct {
+	AppID          int64  // github app id, 0 for installation tokens
+	AppSlug        string // github app slug, empty for installation tokens
+	InstallationID int64  // installation of the app on Organization, if known
+	Organization   string // organization the credentials were verified against
+}
+
+// AppVerifier authenticates internal services calling team-gated APIs with
+// a GitHub App JWT or an installation token, so they don't need to
+// impersonate a human user
+//
+// App JWTs are verified by asking github which app signed them, which must
+// be one of AllowedApps and installed on Organization. Github doesn't tell
+// which app an installation token belongs to, so they are denied unless
+// InstallationTokens is set, trusting every app installed on Organization.
+// They are then verified by making sure they can see its repositories
+type AppVerifier struct {
+	Organization string        // Organization the app must be installed on
+	AllowedApps  []int64       // app ids allowed to authenticate with a JWT
+	Client       *http.Client  // base of the github requests, http.DefaultClient if nil
+	Timeout      time.Duration // bounds each github request, 10 seconds if zero, none if negative
+	Retries      int           // of github GETs, see Config.Retries
+	CacheTTL     time.Duration // how long verified credentials are trusted, 1 minute if zero
+	RateLimit    *RateLimiter  // optional, limits Middleware() as EndpointValidate
+
+	// InstallationTokens accepts the installation token of any app
+	// installed on Organization, only set it when all of them are trusted
+	InstallationTokens bool
+
+	mu    sync.Mutex
+	cache map[string]machineEntry
+}
+
+// machineEntry is a cached verification
+type machineEntry struct {
+	machine *Machine
+	expires time.Time
+}
+
+// VerifyBearer verifies a bearer credential, an app JWT or an installation
+// token
+func (v *AppVerifier) VerifyBearer(ctx context.Context, credential string) (*Machine, error) {
+	key := hashKey(credential)
+	v.mu.Lock()
+	e, ok := v.cache[key]
+	v.mu.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.machine, nil
+	}
+
+	var m *Machine
+	var err error
+	if strings.Count(credential, ".") == 2 {
+		m, err = v.verifyJWT(ctx, credential)
+	} else {
+		m, err = v.verifyInstallationToken(ctx, credential)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := v.CacheTTL
+	if ttl == 0 {
+		ttl = time.Minute
+	}
+	v.mu.Lock()
+	if v.cache == nil {
+		v.cache = make(map[string]machineEntry)
+	}
+	for k, e := range v.cache {
+		if time.Now().After(e.expires) {
+			delete(v.cache, k)
+		}
+	}
+	v.cache[key] = machineEntry{machine: m, expires: time.Now().Add(ttl)}
+	v.mu.Unlock()
+	return m, nil
+}
+
+// Middleware only lets requests with valid machine credentials in the
+// Authorization header through to next, storing the Machine in the request
+// context, see MachineFromContext()
+func (v *AppVerifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v.RateLimit.limit(w, r, EndpointValidate) {
+			return
+		}
+		credential := bearer(r)
+		if credential == "" {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		m, err := v.VerifyBearer(r.Context(), credential)
+		if err == ErrMachineDenied || err == ErrUnauthorized {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithMachine(r.Context(), m)))
+	})
+}
+
+// verifyJWT asks github which app signed jwt and whether it's installed on
+// Organization
+func (v *AppVerifier) verifyJWT(ctx context.Context, jwt string) (*Machine, error) {
+	client := v.bearerClient(jwt)
+
+	var app struct {
+		ID   int64  `json:"id"`
+		Slug string `json:"slug"`
+	}
+	resp, err := get(ctx, client, "https://api.github.com/app", &app)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrUnauthorized
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+	allowed := false
+	for _, id := range v.AllowedApps {
+		allowed = allowed || id == app.ID
+	}
+	if !allowed {
+		return nil, ErrMachineDenied
+	}
+
+	var installation struct {
+		ID int64 `json:"id"`
+	}
+	resp, err = get(ctx, client, "https://api.github.com/orgs/"+url.PathEscape(v.Organization)+"/installation", &installation)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrMachineDenied
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+
+	return &Machine{
+		AppID:          app.ID,
+		AppSlug:        app.Slug,
+		InstallationID: installation.ID,
+		Organization:   v.Organization,
+	}, nil
+}
+
+// verifyInstallationToken makes sure token can see repositories owned by
+// Organization, when InstallationTokens is set. Installations without
+// repositories can't be verified
+func (v *AppVerifier) verifyInstallationToken(ctx context.Context, token string) (*Machine, error) {
+	if !v.InstallationTokens {
+		return nil, ErrMachineDenied
+	}
+	var repos struct {
+		Repositories []struct {
+			Owner struct {
+				Login string `json:"login"`
+			} `json:"owner"`
+		} `json:"repositories"`
+	}
+	resp, err := get(ctx, v.bearerClient(token), "https://api.github.com/installation/repositories?per_page=1", &repos)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrUnauthorized
+	}
+	if resp.StatusCode == http.StatusForbidden && !rateLimited(resp) {
+		return nil, ErrMachineDenied
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+	if len(repos.Repositories) == 0 || !strings.EqualFold(repos.Repositories[0].Owner.Login, v.Organization) {
+		return nil, ErrMachineDenied
+	}
+	return &Machine{Organization: v.Organization}, nil
+}
+
+// bearerClient returns a client sending credential as bearer token, with
+// the timeout and retries of Config.httpClient()
+func (v *AppVerifier) bearerClient(credential string) *http.Client {
+	timeout := v.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	base := (&Verifier{HTTPClient: v.Client, Timeout: timeout, Retries: v.Retries}).httpClient()
+	return bearerClient(base, credential)
+}
+
+// bearerClient returns a copy of base, http.DefaultClient if nil, sending
+// credential as bearer token
+func bearerClient(base *http.Client, credential string) *http.Client {
+	if base == nil {
+		base = http.DefaultClient
+	}
+	transport := base.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	c := *base
+	c.Transport = &bearerTransport{credential: credential, base: transport}
+	return &c
+}
+
+// bearerTransport adds an Authorization header to every request
+type bearerTransport struct {
+	credential string
+	base       http.RoundTripper
+}
+
+func (t *bearerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r2 := r.Clone(r.Context())
+	r2.Header.Set("Authorization", "Bearer "+t.credential)
+	r2.Header.Set("Accept", "application/vnd.github+json")
+	return t.base.RoundTrip(r2)
+}
+
+// bearer returns the bearer token of the Authorization header of r
+func bearer(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return ""
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"path"
+	"strings"
+)
+
+// sameName compares github org or team names the way github does, ignoring
+// case, unless CaseSensitive is set
+func (v *Verifier) sameName(a, b string) bool {
+	if v.CaseSensitive {
+		return a == b
+	}
+	return strings.EqualFold(a, b)
+}
+
+// matchOrg reports whether org is the configured Organization
+func (v *Verifier) matchOrg(org string) bool {
+	return v.sameName(org, v.Organization)
+}
+
+// specs returns Team and AllowedTeams together
+func (v *Verifier) specs() []string {
+	if v.Team == "" {
+		return v.AllowedTeams
+	}
+	return append([]string{v.Team}, v.AllowedTeams...)
+}
+
+// matchTeams returns the team in teams, all from Organization, which admits
+// the user, or nil. When RequireAll is set every spec, TeamIDs entry and
+// regexp must match one of the teams and the first match is returned
+func (v *Verifier) matchTeams(teams []Team) *Team {
+	if !v.RequireAll {
+		for i := range teams {
+			if v.matchTeam(teams[i]) {
+				return &teams[i]
+			}
+		}
+		return nil
+	}
+
+	var first *Team
+	found := func(match func(Team) bool) bool {
+		for i := range teams {
+			if match(teams[i]) {
+				if first == nil {
+					first = &teams[i]
+				}
+				return true
+			}
+		}
+		return false
+	}
+	for _, spec := range v.specs() {
+		if !found(func(t Team) bool { return v.matchSpec(spec, t) }) {
+			return nil
+		}
+	}
+	for _, id := range v.TeamIDs {
+		if !found(func(t Team) bool { return t.ID == id }) {
+			return nil
+		}
+	}
+	for _, re := range v.TeamRegexps {
+		if !found(func(t Team) bool { return re.MatchString(t.Slug) }) {
+			return nil
+		}
+	}
+	return first
+}
+
+// matchTeam reports whether t is any of the configured teams
+func (v *Verifier) matchTeam(t Team) bool {
+	for _, id := range v.TeamIDs {
+		if t.ID == id {
+			return true
+		}
+	}
+	for _, re := range v.TeamRegexps {
+		if re.MatchString(t.Slug) {
+			return true
+		}
+	}
+	for _, spec := range v.specs() {
+		if v.matchSpec(spec, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSpec reports whether t is the team named by spec, which may be a
+// glob. Both the slug and the display name match unless SlugOnly is set
+func (v *Verifier) matchSpec(spec string, t Team) bool {
+	if isGlob(spec) {
+		return v.matchGlob(spec, t.Slug) || !v.SlugOnly && v.matchGlob(spec, t.Name)
+	}
+	return v.sameName(t.Slug, spec) || !v.SlugOnly && v.sameName(t.Name, spec)
+}
+
+// isGlob reports whether a team spec is a glob pattern like eng-* instead
+// of a plain team name
+func isGlob(spec string) bool {
+	return strings.ContainsAny(spec, "*?[")
+}
+
+// matchGlob matches name against the glob pattern, honoring CaseSensitive.
+// Malformed patterns match nothing
+func (v *Verifier) matchGlob(pattern, name string) bool {
+	if !v.CaseSensitive {
+		pattern, name = strings.ToLower(pattern), strings.ToLower(name)
+	}
+	ok, err := path.Match(pattern, name)
+	return err == nil && ok
+}
+
+// userLists applies AllowUsers and DenyUsers to decision. Logins are
+// matched ignoring case, like github does
+func (v *Verifier) userLists(user *User, decision Decision) Decision {
+	for _, login := range v.DenyUsers {
+		if strings.EqualFold(login, user.Login) {
+			return Decision{Reason: DeniedByPolicy, Teams: decision.Teams}
+		}
+	}
+	if decision.Allowed || decision.Reason == TokenInvalid {
+		return decision
+	}
+	for _, login := range v.AllowUsers {
+		if strings.EqualFold(login, user.Login) {
+			return Decision{Allowed: true, Teams: decision.Teams}
+		}
+	}
+	return decision
+}
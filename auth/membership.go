@@ -0,0 +1,471 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrNoServerToken is returned by CheckMembership() without
+// Config.ServerToken
+var ErrNoServerToken = errors.New("auth: no server token configured")
+
+// CheckMembership tells whether login passes the rules of Verify(),
+// without any token of theirs, for background jobs. It asks github with
+// ServerToken, which must be able to see the organization teams and
+// memberships. TokenInvalid means github rejected ServerToken. Hooks get a
+// User with only the Login. The addresses of other users can't be read,
+// so with AllowedEmailDomains everybody is denied with EmailNotAllowed
+func (c *Config) CheckMembership(ctx context.Context, login string) (Decision, error) {
+	return c.checkUser(ctx, &User{Login: login}, false)
+}
+
+// checkUser is CheckMembership() for user. signedIn tells whether they
+// passed the rules needing their own token when signing in, so they are
+// kept instead of denying
+func (c *Config) checkUser(ctx context.Context, user *User, signedIn bool) (Decision, error) {
+	if c.ServerToken == nil {
+		return Decision{}, ErrNoServerToken
+	}
+	client := oauth2.NewClient(withHTTPClient(ctx, c.httpClient()), c.ServerToken)
+	decision, err := c.verifier().checkUser(ctx, client, user, signedIn)
+	if err != nil {
+		return Decision{}, err
+	}
+	return c.twoFactor(ctx, user, decision)
+}
+
+// CheckMembership is Config.CheckMembership() with client authorized by a
+// token that can see the organization teams and memberships
+func (v *Verifier) CheckMembership(ctx context.Context, client *http.Client, login string) (Decision, error) {
+	return v.checkUser(ctx, client, &User{Login: login}, false)
+}
+
+// checkUser is Config.checkUser() with client authorized like for
+// CheckMembership()
+func (v *Verifier) checkUser(ctx context.Context, client *http.Client, user *User, signedIn bool) (Decision, error) {
+	decision, err := v.checkMembership(ctx, client, user.Login)
+	if err == ErrUnauthorized {
+		return Decision{Reason: TokenInvalid}, nil
+	}
+	if err != nil {
+		return Decision{}, err
+	}
+
+	// hooks get every team of the user in Organization, like in Verify()
+
+	teams := decision.Teams
+	if v.Authorizer != nil || v.Roles != nil || v.Authorize != nil {
+		if teams, err = v.loginTeams(ctx, client, user.Login); err != nil {
+			return Decision{}, err
+		}
+	}
+	return v.finishServer(ctx, client, user, teams, decision, signedIn)
+}
+
+// finishServer is finish() for decisions made without the token of user,
+// denying them for the rules which need it unless signedIn
+func (v *Verifier) finishServer(ctx context.Context, client *http.Client, user *User, teams []Team, decision Decision, signedIn bool) (Decision, error) {
+	if !signedIn && len(v.AllowedEmailDomains) > 0 && decision.Allowed {
+		decision = Decision{Reason: EmailNotAllowed, Teams: decision.Teams, OrgRole: decision.OrgRole}
+	}
+	return v.finish(ctx, client, user, teams, decision, false)
+}
+
+// loginTeams lists the teams of login in Organization, like /user/teams
+// does for the owner of a token
+func (v *Verifier) loginTeams(ctx context.Context, client *http.Client, login string) ([]Team, error) {
+	const query = `query($org: String!, $login: String!, $after: String) {
+  organization(login: $org) {
+    teams(first: 100, userLogins: [$login], after: $after) {
+      nodes { databaseId name slug parentTeam { slug } }
+      pageInfo { hasNextPage endCursor }
+    }
+  }
+}`
+	vars := map[string]interface{}{"org": v.Organization, "login": login}
+	var teams []Team
+	for {
+		var data struct {
+			Organization *struct {
+				Teams struct {
+					Nodes []struct {
+						DatabaseID int64  `json:"databaseId"`
+						Name       string `json:"name"`
+						Slug       string `json:"slug"`
+						ParentTeam *struct {
+							Slug string `json:"slug"`
+						} `json:"parentTeam"`
+					} `json:"nodes"`
+					PageInfo struct {
+						HasNextPage bool   `json:"hasNextPage"`
+						EndCursor   string `json:"endCursor"`
+					} `json:"pageInfo"`
+				} `json:"teams"`
+			} `json:"organization"`
+		}
+		if _, err := graphQL(ctx, client, query, vars, &data); err != nil {
+			return nil, err
+		}
+		if data.Organization == nil {
+			return teams, nil
+		}
+		for _, n := range data.Organization.Teams.Nodes {
+			t := Team{ID: n.DatabaseID, Name: n.Name, Slug: n.Slug, Organization: v.Organization}
+			if n.ParentTeam != nil {
+				t.Parent = n.ParentTeam.Slug
+			}
+			teams = append(teams, t)
+		}
+		if !data.Organization.Teams.PageInfo.HasNextPage {
+			return teams, nil
+		}
+		vars["after"] = data.Organization.Teams.PageInfo.EndCursor
+	}
+}
+
+// checkMembership is the team check of CheckMembership()
+func (v *Verifier) checkMembership(ctx context.Context, client *http.Client, login string) (Decision, error) {
+	var candidates []Team
+	if !v.orgOnly() {
+		var err error
+		if candidates, err = v.candidateTeams(ctx, client); err != nil {
+			return Decision{}, err
+		}
+	}
+
+	var active []Team
+	pending := false
+	for _, t := range candidates {
+		var membership teamMembership
+		u := "https://api.github.com/orgs/" + url.PathEscape(v.Organization) + "/teams/" + url.PathEscape(t.Slug) + "/memberships/" + url.PathEscape(login)
+		resp, err := get(ctx, client, u, &membership)
+		if err != nil {
+			return Decision{}, err
+		}
+		switch {
+		case resp.StatusCode == http.StatusOK && membership.State == "active":
+			t.Role = membership.Role
+			ok, err := v.counts(ctx, client, t, login)
+			if err != nil {
+				return Decision{}, err
+			}
+			if ok {
+				active = append(active, t)
+			}
+		case resp.StatusCode == http.StatusOK:
+			pending = true
+		case resp.StatusCode == http.StatusUnauthorized:
+			return Decision{}, ErrUnauthorized
+		case resp.StatusCode != http.StatusNotFound:
+			return Decision{}, statusError(resp)
+		}
+	}
+	if t := v.matchTeams(active); t != nil {
+		return v.concealed(ctx, client, login, Decision{Allowed: true, Team: t, Teams: active})
+	}
+
+	var membership orgMembership
+	resp, err := get(ctx, client, "https://api.github.com/orgs/"+url.PathEscape(v.Organization)+"/memberships/"+url.PathEscape(login), &membership)
+	if err != nil {
+		return Decision{}, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return Decision{}, ErrUnauthorized
+	case resp.StatusCode == http.StatusNotFound:
+		return Decision{Reason: NotInOrganization}, nil
+	case resp.StatusCode != http.StatusOK:
+		return Decision{}, statusError(resp)
+	case membership.State != "active":
+		return Decision{Reason: PendingInvite}, nil
+	case v.orgOnly():
+		return v.concealed(ctx, client, login, Decision{Allowed: true, OrgRole: membership.Role})
+	case v.AllowOrgAdmins && membership.Role == "admin":
+		return Decision{Allowed: true, OrgRole: membership.Role}, nil
+	case pending:
+		return Decision{Reason: PendingInvite, OrgRole: membership.Role, Teams: active}, nil
+	}
+	return Decision{Reason: NotInTeam, OrgRole: membership.Role, Teams: active}, nil
+}
+
+// counts reports whether the active membership of login in t admits them
+// like Verify() would: maintainers only with RequireMaintainer, and only
+// members added to t itself unless child teams count, see
+// countsChildTeams(). github includes child team members in t
+func (v *Verifier) counts(ctx context.Context, client *http.Client, t Team, login string) (bool, error) {
+	if v.RequireMaintainer && t.Role != "maintainer" {
+		return false, nil
+	}
+	if v.countsChildTeams() {
+		return true, nil
+	}
+	direct, err := v.immediateMembers(ctx, client, t.Slug, login, false)
+	return len(direct) > 0, err
+}
+
+// concealed denies allowed decisions with MembershipConcealed when
+// RequirePublicMembership is set and the membership of login isn't public
+func (v *Verifier) concealed(ctx context.Context, client *http.Client, login string, decision Decision) (Decision, error) {
+	if !v.RequirePublicMembership {
+		return decision, nil
+	}
+	reason, err := publicMember(ctx, client, v.Organization, login)
+	if err != nil {
+		return Decision{}, err
+	}
+	if reason != "" {
+		return Decision{Reason: reason, OrgRole: decision.OrgRole, Teams: decision.Teams}, nil
+	}
+	return decision, nil
+}
+
+// candidateTeams returns the Organization teams which may admit users.
+// Plain slugs are taken as is with SlugOnly, otherwise they may be display
+// names and are resolved with the listing, cached for an hour. Globs,
+// TeamIDs and TeamRegexps need the listing every time
+func (v *Verifier) candidateTeams(ctx context.Context, client *http.Client) ([]Team, error) {
+	slugs, ok := v.plainSlugs()
+	if ok && v.SlugOnly {
+		teams := make([]Team, len(slugs))
+		for i, slug := range slugs {
+			teams[i] = Team{Name: slug, Slug: slug, Organization: v.Organization}
+		}
+		return teams, nil
+	}
+	if !ok {
+		return v.matchingTeams(ctx, client)
+	}
+	if teams, ok := v.slugs.get(); ok {
+		return teams, nil
+	}
+	teams, err := v.matchingTeams(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	// a name matching no team would deny its members without a word
+
+	for _, spec := range slugs {
+		found := false
+		for _, t := range teams {
+			found = found || v.matchSpec(spec, t)
+		}
+		if !found {
+			return nil, fmt.Errorf("auth: team %q not found in organization %s", spec, v.Organization)
+		}
+	}
+	v.slugs.set(teams)
+	return teams, nil
+}
+
+// teamSlugs are the resolved teams of candidateTeams(), for an hour
+type teamSlugs struct {
+	mu       sync.Mutex
+	teams    []Team
+	resolved time.Time
+}
+
+// get returns the cached teams, ok is false when there are none or they
+// are too old. s may be nil
+func (s *teamSlugs) get() ([]Team, bool) {
+	if s == nil {
+		return nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.teams == nil || time.Since(s.resolved) > time.Hour {
+		return nil, false
+	}
+	return s.teams, true
+}
+
+func (s *teamSlugs) set(teams []Team) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.teams, s.resolved = teams, time.Now()
+}
+
+// matchingTeams lists the Organization teams matching the configured ones
+func (v *Verifier) matchingTeams(ctx context.Context, client *http.Client) ([]Team, error) {
+	var teams []Team
+	err := getPages(ctx, client, "https://api.github.com/orgs/"+url.PathEscape(v.Organization)+"/teams?per_page=100", func(page json.RawMessage) error {
+		var raw []team
+		if err := json.Unmarshal(page, &raw); err != nil {
+			return err
+		}
+		for _, t := range raw {
+			if own := t.team(v.Organization); v.matchTeam(own) {
+				teams = append(teams, own)
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, ErrUnauthorized) {
+		return nil, ErrUnauthorized
+	}
+	return teams, err
+}
+
+// CheckMemberships is CheckMembership() for many users at once, returning
+// whether each of logins is allowed. It lists the members of the candidate
+// teams instead of asking about every login, so reconciling a user
+// database costs a few requests per team
+func (c *Config) CheckMemberships(ctx context.Context, logins []string) (map[string]bool, error) {
+	if c.ServerToken == nil {
+		return nil, ErrNoServerToken
+	}
+	client := oauth2.NewClient(withHTTPClient(ctx, c.httpClient()), c.ServerToken)
+	return c.verifier().CheckMemberships(ctx, client, logins)
+}
+
+// CheckMemberships is Config.CheckMemberships() with client authorized like
+// for CheckMembership()
+func (v *Verifier) CheckMemberships(ctx context.Context, client *http.Client, logins []string) (map[string]bool, error) {
+	list, err := v.listMemberships(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	allowed := make(map[string]bool, len(logins))
+	for _, login := range logins {
+		decision := list.decision(v, login)
+		decision, err := v.finishServer(ctx, client, &User{Login: login}, decision.Teams, decision, false)
+		if err != nil {
+			return nil, err
+		}
+		allowed[login] = decision.Allowed
+	}
+	return allowed, nil
+}
+
+// memberList are the members of the candidate teams, or of Organization
+// when no team is configured, by lowercase login
+type memberList struct {
+	teams  map[string][]Team
+	admins map[string]bool // Organization owners, with AllowOrgAdmins
+	public map[string]bool // public members, with RequirePublicMembership
+}
+
+// decision returns the Decision for login according to l, without
+// AllowUsers and DenyUsers. Users it doesn't know about get NotInTeam,
+// the list can't tell pending invitations or non members apart
+func (l *memberList) decision(v *Verifier, login string) Decision {
+	login = strings.ToLower(login)
+	teams, ok := l.teams[login]
+	concealed := l.public != nil && !l.public[login]
+	if ok && v.orgOnly() && !concealed {
+		return Decision{Allowed: true}
+	}
+	if t := v.matchTeams(teams); ok && t != nil && !concealed {
+		return Decision{Allowed: true, Team: t, Teams: teams}
+	}
+	if l.admins[login] {
+		return Decision{Allowed: true, OrgRole: "admin", Teams: teams}
+	}
+	return Decision{Reason: NotInTeam, Teams: teams}
+}
+
+// remove forgets the lowercase login, who then gets NotInTeam
+func (l *memberList) remove(login string) {
+	delete(l.teams, login)
+	delete(l.admins, login)
+	delete(l.public, login)
+}
+
+// listMemberships lists the members of every candidate team, a few
+// requests per team
+func (v *Verifier) listMemberships(ctx context.Context, client *http.Client) (*memberList, error) {
+	org := "https://api.github.com/orgs/" + url.PathEscape(v.Organization)
+	list := &memberList{teams: make(map[string][]Team)}
+	if v.orgOnly() {
+		members, err := listMembers(ctx, client, org+"/members?per_page=100")
+		if err != nil {
+			return nil, err
+		}
+		for _, login := range members {
+			list.teams[login] = nil
+		}
+	} else {
+		candidates, err := v.candidateTeams(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		role := "all"
+		if v.RequireMaintainer {
+			role = "maintainer"
+		}
+		for _, t := range candidates {
+			var members []string
+			if v.countsChildTeams() {
+				members, err = listMembers(ctx, client, org+"/teams/"+url.PathEscape(t.Slug)+"/members?per_page=100&role="+role)
+			} else {
+				members, err = v.immediateMembers(ctx, client, t.Slug, "", v.RequireMaintainer)
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			// only maintainers were listed, say so like maintained() does
+
+			if v.RequireMaintainer {
+				t.Role = "maintainer"
+			}
+			for _, login := range members {
+				list.teams[login] = append(list.teams[login], t)
+			}
+		}
+	}
+	if v.RequirePublicMembership {
+		public, err := listMembers(ctx, client, org+"/public_members?per_page=100")
+		if err != nil {
+			return nil, err
+		}
+		list.public = make(map[string]bool, len(public))
+		for _, login := range public {
+			list.public[login] = true
+		}
+	}
+	if v.AllowOrgAdmins {
+		admins, err := listMembers(ctx, client, org+"/members?per_page=100&role=admin")
+		if err != nil {
+			return nil, err
+		}
+		list.admins = make(map[string]bool, len(admins))
+		for _, login := range admins {
+			list.admins[login] = true
+		}
+	}
+	return list, nil
+}
+
+// listMembers returns the lowercase logins of every member listed at url
+func listMembers(ctx context.Context, client *http.Client, url string) ([]string, error) {
+	var logins []string
+	err := getPages(ctx, client, url, func(page json.RawMessage) error {
+		var members []struct {
+			Login string `json:"login"`
+		}
+		if err := json.Unmarshal(page, &members); err != nil {
+			return err
+		}
+		for _, m := range members {
+			logins = append(logins, strings.ToLower(m.Login))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return logins, nil
+}
@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+)
+
+// ErrorMessage is the Catalog key of the message shown when we couldn't
+// verify the user at all
+const ErrorMessage Reason = "error"
+
+// RequestSentMessage is the Catalog key of the message shown once a denied
+// user requested access
+const RequestSentMessage Reason = "request_sent"
+
+// PageData is the data model of denial and error pages. Catalog messages are
+// text/template strings executed with it
+type PageData struct {
+	Lang             string // language the message is in
+	Reason           Reason // why the user ended up here, ErrorMessage for errors
+	Message          string // localized message, filled in by Catalog.PageData()
+	Organization     string // Organization users must belong to
+	Team             string // Team users must belong to
+	RequestAccessURL string // where users can ask to be let in, optional
+	RequestToken     string // signed proof of the denied user, posted to RequestAccessURL
+	InvitationURL    string // where users accept their invitation, set for PendingInvite
+	EmailDomains     string // AllowedEmailDomains, comma separated
+	User             *User  // the user, nil if we don't know who they are
+}
+
+// Catalog holds denial and error messages per language, with fallback to
+// Fallback when a language or message is missing
+type Catalog struct {
+	Fallback string                       // language used when nothing better matches, en if empty
+	Messages map[string]map[Reason]string // language -> Reason -> message template
+}
+
+// DefaultCatalog returns a Catalog with english and spanish messages. It's a
+// fresh copy, add or replace languages and messages at will
+func DefaultCatalog() *Catalog {
+	return &Catalog{
+		Fallback: "en",
+		Messages: map[string]map[Reason]string{
+			"en": {
+				NotInOrganization:   "You must be a member of the {{.Organization}} organization on GitHub.",
+				NotInTeam:           "You must be a member of the {{.Team}} team in the {{.Organization}} organization on GitHub.",
+				PendingInvite:       "You have a pending invitation to the {{.Organization}} organization on GitHub, accept it and try again.",
+				MissingScope:        "Access to your GitHub organizations wasn't granted, please sign in again and allow it.",
+				MembershipConcealed: "Your membership of the {{.Organization}} organization must be public on GitHub.",
+				TokenInvalid:        "GitHub rejected your sign in, please try again.",
+				DeniedByPolicy:      "Your access to this application was revoked.",
+				NotCollaborator:     "You need access to the repository behind this application on GitHub.",
+				TwoFactorDisabled:   "You must enable two-factor authentication on your GitHub account.",
+				EmailNotAllowed:     "Your GitHub account needs a verified email address on {{.EmailDomains}}.",
+				SSORequired:         "Authorize this application for the single sign-on of the {{.Organization}} organization on GitHub, then try again.",
+				ErrorMessage:        "We couldn't verify your GitHub account, please try again later.",
+				RequestSentMessage:  "Your request was sent to the maintainers of the {{.Team}} team.",
+			},
+			"es": {
+				NotInOrganization:   "Debes ser miembro de la organización {{.Organization}} en GitHub.",
+				NotInTeam:           "Debes ser miembro del equipo {{.Team}} de la organización {{.Organization}} en GitHub.",
+				PendingInvite:       "Tienes una invitación pendiente a la organización {{.Organization}} en GitHub, acéptala e inténtalo de nuevo.",
+				MissingScope:        "No se concedió acceso a tus organizaciones de GitHub, vuelve a iniciar sesión y permítelo.",
+				MembershipConcealed: "Tu membresía en la organización {{.Organization}} debe ser pública en GitHub.",
+				TokenInvalid:        "GitHub rechazó tu inicio de sesión, inténtalo de nuevo.",
+				DeniedByPolicy:      "Tu acceso a esta aplicación fue revocado.",
+				NotCollaborator:     "Necesitas acceso en GitHub al repositorio de esta aplicación.",
+				TwoFactorDisabled:   "Debes activar la autenticación en dos pasos en tu cuenta de GitHub.",
+				EmailNotAllowed:     "Tu cuenta de GitHub necesita una dirección de correo verificada de {{.EmailDomains}}.",
+				SSORequired:         "Autoriza esta aplicación para el inicio de sesión único de la organización {{.Organization}} en GitHub e inténtalo de nuevo.",
+				ErrorMessage:        "No pudimos verificar tu cuenta de GitHub, inténtalo más tarde.",
+				RequestSentMessage:  "Tu solicitud fue enviada a los responsables del equipo {{.Team}}.",
+			},
+		},
+	}
+}
+
+// Message renders the message for reason in lang. Unknown reasons, e.g. ones
+// made up by an AuthorizeFunc, use the NotInTeam message
+func (c *Catalog) Message(lang string, reason Reason, data PageData) (string, error) {
+	text, ok := c.lookup(lang, reason)
+	if !ok {
+		text, ok = c.lookup(lang, NotInTeam)
+	}
+	if !ok {
+		return string(reason), nil
+	}
+
+	t, err := template.New(string(reason)).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// PageData returns the data for a denial or error page for r, with the
+// language picked from its Accept-Language header
+func (c *Catalog) PageData(r *http.Request, reason Reason, base PageData) (PageData, error) {
+	base.Lang = c.language(r.Header.Get("Accept-Language"))
+	base.Reason = reason
+	if reason == PendingInvite && base.InvitationURL == "" && base.Organization != "" {
+		base.InvitationURL = InvitationURL(base.Organization)
+	}
+	msg, err := c.Message(base.Lang, reason, base)
+	if err != nil {
+		return PageData{}, err
+	}
+	base.Message = msg
+	return base, nil
+}
+
+// InvitationURL is the github page where users accept their pending
+// invitation to org
+func InvitationURL(org string) string {
+	return "https://github.com/orgs/" + url.PathEscape(org) + "/invitation"
+}
+
+// lookup finds the message for reason in lang, falling back to Fallback
+func (c *Catalog) lookup(lang string, reason Reason) (string, bool) {
+	if text, ok := c.Messages[lang][reason]; ok {
+		return text, true
+	}
+	text, ok := c.Messages[c.fallback()][reason]
+	return text, ok
+}
+
+// language picks the first language of an Accept-Language header we have
+// messages for
+func (c *Catalog) language(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		tag := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		if _, ok := c.Messages[tag]; ok {
+			return tag
+		}
+		primary := strings.ToLower(strings.SplitN(tag, "-", 2)[0])
+		if _, ok := c.Messages[primary]; ok {
+			return primary
+		}
+	}
+	return c.fallback()
+}
+
+func (c *Catalog) fallback() string {
+	if c.Fallback == "" {
+		return "en"
+	}
+	return c.Fallback
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metrics instruments the login flow for dashboards, see the promauth
+// package for a Prometheus implementation. Implementations must be safe for
+// concurrent use and fast, they are called inline
+type Metrics interface {
+	// ObserveExchange records an OAuth2 code exchange
+	ObserveExchange(err error, took time.Duration)
+
+	// ObserveVerify records a membership check: allowed, denied with
+	// decision.Reason, or failed with err
+	ObserveVerify(decision Decision, err error, took time.Duration)
+
+	// ObserveRequest records a github api call. endpoint is the path with
+	// logins, organizations and ids replaced, like /orgs/:id/teams/:id
+	ObserveRequest(endpoint string, status int, took time.Duration)
+
+	// RateLimitRemaining reports the X-RateLimit-Remaining of a response
+	RateLimitRemaining(remaining int)
+}
+
+// observeExchange calls c.Metrics.ObserveExchange(), if set
+func (c *Config) observeExchange(start time.Time, err error) {
+	if c.Metrics != nil {
+		c.Metrics.ObserveExchange(err, time.Since(start))
+	}
+}
+
+// metricsClient returns a copy of base reporting every request to m, base
+// itself if m is nil
+func metricsClient(base *http.Client, m Metrics) *http.Client {
+	if m == nil {
+		return base
+	}
+	if base == nil {
+		base = http.DefaultClient
+	}
+	c := *base
+	c.Transport = &metricsTransport{base: base.Transport, metrics: m}
+	return &c
+}
+
+// metricsTransport reports requests to a Metrics
+type metricsTransport struct {
+	base    http.RoundTripper
+	metrics Metrics
+}
+
+func (t *metricsTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	start := time.Now()
+	resp, err := base.RoundTrip(r)
+	status := 0
+	if err == nil {
+		status = resp.StatusCode
+		if n, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+			t.metrics.RateLimitRemaining(n)
+		}
+	}
+	t.metrics.ObserveRequest(endpoint(r.URL.Path), status, time.Since(start))
+	return resp, err
+}
+
+// endpointWords are the path segments of github api urls kept by endpoint()
+var endpointWords = map[string]bool{
+	"user": true, "users": true, "emails": true, "teams": true, "orgs": true,
+	"memberships": true, "members": true, "public_members": true, "team-sync": true,
+	"group-mappings": true, "installation": true, "installations": true,
+	"repositories": true, "app": true, "graphql": true, "applications": true,
+	"token": true, "access_tokens": true, "login": true, "oauth": true,
+	"access_token": true, "device": true, "code": true,
+}
+
+// endpoint replaces the variable segments of path, so metrics labels
+// don't grow with every user
+func endpoint(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i, p := range parts {
+		if !endpointWords[p] {
+			parts[i] = ":id"
+		}
+	}
+	return "/" + strings.Join(parts, "/")
+}
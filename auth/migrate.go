@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// MigrateSessions copies every live session from one backend to another,
+// keeping ids and expiry so nobody is logged out when a deployment changes
+// backends, e.g. memory to Redis or Redis to SQL. It returns how many
+// sessions were copied
+//
+// Run it while both backends are reachable, then switch ServerSessions to
+// the new backend. Sessions created in between can be picked up by running
+// it again
+func MigrateSessions(ctx context.Context, from, to SessionBackend) (int, error) {
+	copied := 0
+	var putErr error
+	err := from.Range(ctx, func(id string, data []byte, expires time.Time) bool {
+		if putErr = to.Put(ctx, id, data, expires); putErr != nil {
+			return false
+		}
+		copied++
+		return true
+	})
+	if err == nil {
+		err = putErr
+	}
+	return copied, err
+}
+
+// MigratingStore moves sessions lazily from one SessionStore to another as
+// users come back, for stores which can't be enumerated, like cookie based
+// ones. Sessions are loaded from To first, then from From, in which case
+// they are saved into To and deleted from From
+type MigratingStore struct {
+	From SessionStore
+	To   SessionStore
+}
+
+// Load implements SessionStore. Sessions found in From are only moved on
+// the next Save, since Load can't write cookies; use LoadAndMigrate() in
+// handlers which have the ResponseWriter
+func (m *MigratingStore) Load(r *http.Request) (*Session, error) {
+	s, err := m.To.Load(r)
+	if err != ErrNoSession {
+		return s, err
+	}
+	return m.From.Load(r)
+}
+
+// LoadAndMigrate is Load() moving a session found in From into To
+func (m *MigratingStore) LoadAndMigrate(w http.ResponseWriter, r *http.Request) (*Session, error) {
+	s, err := m.To.Load(r)
+	if err != ErrNoSession {
+		return s, err
+	}
+	s, err = m.From.Load(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.To.Save(w, r, s); err != nil {
+		return nil, err
+	}
+	m.From.Delete(w, r)
+	return s, nil
+}
+
+// Save implements SessionStore, always into To
+func (m *MigratingStore) Save(w http.ResponseWriter, r *http.Request, s *Session) error {
+	m.From.Delete(w, r)
+	return m.To.Save(w, r, s)
+}
+
+// Delete implements SessionStore, from both stores
+func (m *MigratingStore) Delete(w http.ResponseWriter, r *http.Request) error {
+	m.From.Delete(w, r)
+	return m.To.Delete(w, r)
+}
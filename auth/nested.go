@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// withAncestors adds to teams the parents, grandparents... of the
+// Organization teams in it, marked Inherited. github only lists the teams
+// users were added to, while members of a child team are members of its
+// ancestors too. One request per ancestor not in teams, see
+// IncludeChildTeams
+func (v *Verifier) withAncestors(ctx context.Context, client *http.Client, teams []Team) ([]Team, error) {
+	seen := make(map[string]bool, len(teams))
+	var parents []string
+	for _, t := range teams {
+		if v.matchOrg(t.Organization) {
+			seen[strings.ToLower(t.Slug)] = true
+			if t.Parent != "" {
+				parents = append(parents, t.Parent)
+			}
+		}
+	}
+	for len(parents) > 0 {
+		slug := parents[0]
+		parents = parents[1:]
+		if seen[strings.ToLower(slug)] {
+			continue
+		}
+		seen[strings.ToLower(slug)] = true
+
+		var raw team
+		resp, err := get(ctx, client, "https://api.github.com/orgs/"+url.PathEscape(v.Organization)+"/teams/"+url.PathEscape(slug), &raw)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, statusError(resp)
+		}
+		t := raw.team(v.Organization)
+		t.Inherited = true
+		teams = append(teams, t)
+		if t.Parent != "" {
+			parents = append(parents, t.Parent)
+		}
+	}
+	return teams, nil
+}
+
+// countsChildTeams reports whether members of child teams pass for members
+// of their ancestors, as they do with IncludeChildTeams and in the
+// DirectMembership and GraphQL modes, which ask github about the teams
+// themselves. Otherwise only the teams users were added to count
+func (v *Verifier) countsChildTeams() bool {
+	_, plain := v.plainSlugs()
+	return v.IncludeChildTeams || v.directSlugs() != nil || v.GraphQL && plain
+}
+
+// immediateMembers lists the lowercase logins of the members added to the
+// team itself, not through a child team, the only ones the REST api can't
+// tell apart. login, when set, only looks for them
+func (v *Verifier) immediateMembers(ctx context.Context, client *http.Client, slug, login string, maintainers bool) ([]string, error) {
+	const query = `query($org: String!, $slug: String!, $login: String, $role: TeamMemberRole, $after: String) {
+  organization(login: $org) { team(slug: $slug) {
+    members(first: 100, membership: IMMEDIATE, query: $login, role: $role, after: $after) {
+      nodes { login } pageInfo { hasNextPage endCursor }
+    }
+  } }
+}`
+	vars := map[string]interface{}{"org": v.Organization, "slug": slug}
+	if login != "" {
+		vars["login"] = login
+	}
+	if maintainers {
+		vars["role"] = "MAINTAINER"
+	}
+
+	var logins []string
+	for {
+		var data struct {
+			Organization struct {
+				Team *struct {
+					Members struct {
+						Nodes []struct {
+							Login string `json:"login"`
+						} `json:"nodes"`
+						PageInfo struct {
+							HasNextPage bool   `json:"hasNextPage"`
+							EndCursor   string `json:"endCursor"`
+						} `json:"pageInfo"`
+					} `json:"members"`
+				} `json:"team"`
+			} `json:"organization"`
+		}
+		if _, err := graphQL(ctx, client, query, vars, &data); err != nil {
+			return nil, err
+		}
+		team := data.Organization.Team
+		if team == nil {
+			return logins, nil
+		}
+		for _, n := range team.Members.Nodes {
+			if login == "" || strings.EqualFold(n.Login, login) {
+				logins = append(logins, strings.ToLower(n.Login))
+			}
+		}
+		if !team.Members.PageInfo.HasNextPage {
+			return logins, nil
+		}
+		vars["after"] = team.Members.PageInfo.EndCursor
+	}
+}
@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrNoToken is returned by TokenStores without a token for the user
+var ErrNoToken = errors.New("auth: no token stored for user")
+
+// TokenStore persists the tokens of users by lowercase login, so their
+// membership can be checked again long after they signed in. Tokens are
+// credentials, keep them encrypted at rest
+type TokenStore interface {
+	Load(ctx context.Context, login string) (*oauth2.Token, error)
+	Save(ctx context.Context, login string, token *oauth2.Token) error
+}
+
+// TokenSource returns a source of fresh tokens for user, read from
+// c.Tokens. Expired tokens with a refresh token are refreshed and saved
+// back, so the source can be used for periodic re-verification:
+//
+//	ts, err := cfg.TokenSource(ctx, user)
+//	...
+//	token, err := ts.Token()
+//	...
+//	decision, _, err := cfg.Verify(ctx, token)
+//
+// Only github apps with expiring tokens hand out refresh tokens, OAuth app
+// tokens don't expire
+func (c *Config) TokenSource(ctx context.Context, user *User) (oauth2.TokenSource, error) {
+	if c.Tokens == nil {
+		return nil, ErrNoToken
+	}
+	login := strings.ToLower(user.Login)
+	token, err := c.Tokens.Load(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+	ts := c.oauth2Config().TokenSource(withHTTPClient(ctx, c.httpClient()), token)
+	return &savingSource{ctx: ctx, store: c.Tokens, login: login, base: ts, last: token.AccessToken}, nil
+}
+
+// saveToken keeps token for user in c.Tokens, if set
+func (c *Config) saveToken(ctx context.Context, user *User, token *oauth2.Token) error {
+	if c.Tokens == nil || user == nil {
+		return nil
+	}
+	return c.Tokens.Save(ctx, strings.ToLower(user.Login), token)
+}
+
+// accessType returns the access type option of AuthCodeURL, offline when
+// c.Offline is set
+func (c *Config) accessType() oauth2.AuthCodeOption {
+	if c.Offline {
+		return oauth2.AccessTypeOffline
+	}
+	return oauth2.AccessTypeOnline
+}
+
+// savingSource saves the tokens refreshed by base
+type savingSource struct {
+	ctx   context.Context
+	store TokenStore
+	login string
+	base  oauth2.TokenSource
+
+	mu   sync.Mutex
+	last string // access token last saved
+}
+
+func (s *savingSource) Token() (*oauth2.Token, error) {
+	token, err := s.base.Token()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if token.AccessToken != s.last {
+		if err := s.store.Save(s.ctx, s.login, token); err != nil {
+			return nil, err
+		}
+		s.last = token.AccessToken
+	}
+	return token, nil
+}
+
+// MemoryTokens is an in memory TokenStore
+type MemoryTokens struct {
+	mu     sync.Mutex
+	tokens map[string]*oauth2.Token
+}
+
+// Load implements TokenStore
+func (m *MemoryTokens) Load(ctx context.Context, login string) (*oauth2.Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	token, ok := m.tokens[login]
+	if !ok {
+		return nil, ErrNoToken
+	}
+	t := *token
+	return &t, nil
+}
+
+// Save implements TokenStore
+func (m *MemoryTokens) Save(ctx context.Context, login string, token *oauth2.Token) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tokens == nil {
+		m.tokens = make(map[string]*oauth2.Token)
+	}
+	t := *token
+	m.tokens[login] = &t
+	return nil
+}
@@ -0,0 +1,427 @@
+// Package oidc puts auth in front of internal services as a lightweight
+// OpenID Connect provider: users sign in with github through auth.Config,
+// and services get ID tokens, a JWKS and a userinfo endpoint instead of
+// talking to github themselves
+//
+//	p := &oidc.Provider{
+//		Config:  cfg, // its Handler() mounted where cfg.LoginURL points
+//		Issuer:  "https://id.example.com",
+//		Key:     key,
+//		Clients: []oidc.Client{{ID: "wiki", Secret: secret, RedirectURIs: []string{"https://wiki.example.com/callback"}}},
+//	}
+//	http.Handle("/", p.Handler())
+//
+// Only the authorization code flow is supported, with PKCE for clients
+// without a Secret. Codes and access tokens are kept in memory, so run a
+// single instance
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RealGeeks/github-org-auth/auth"
+)
+
+// Client is an application allowed to get ID tokens
+type Client struct {
+	ID           string
+	Secret       string   // empty for public clients, which must use PKCE
+	RedirectURIs []string // exact callback urls
+}
+
+// Provider serves the OpenID Connect endpoints:
+//
+//	/.well-known/openid-configuration  discovery document
+//	/jwks                              public signing key
+//	/authorize                         starts the code flow, signing in through Config
+//	/token                             trades codes for ID and access tokens
+//	/userinfo                          claims of an access token
+type Provider struct {
+	Config  *auth.Config
+	Issuer  string          // url of the provider, the iss claim
+	Key     *rsa.PrivateKey // signs ID tokens with RS256
+	KeyID   string          // kid of Key, derived from it if empty
+	Clients []Client
+	TTL     time.Duration // ID and access token lifetime, 1 hour if zero
+
+	mu     sync.Mutex
+	codes  map[string]grant
+	access map[string]grant
+}
+
+// grant is what a code or access token stands for
+type grant struct {
+	client    string
+	redirect  string
+	nonce     string
+	challenge string // S256 PKCE code challenge, if any
+	user      *auth.User
+	decision  auth.Decision
+	expires   time.Time
+}
+
+var errInvalidClient = errors.New("invalid_client")
+
+// Handler serves the provider endpoints, by path suffix like auth.Config
+// Handler()
+func (p *Provider) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch path := r.URL.Path; {
+		case strings.HasSuffix(path, "/.well-known/openid-configuration"):
+			p.discovery(w)
+		case strings.HasSuffix(path, "/jwks"):
+			p.jwks(w)
+		case strings.HasSuffix(path, "/authorize"):
+			p.authorize(w, r)
+		case strings.HasSuffix(path, "/token") && r.Method == "POST":
+			p.token(w, r)
+		case strings.HasSuffix(path, "/userinfo"):
+			p.userinfo(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// IDToken signs an ID token for an allowed user, for audience
+func (p *Provider) IDToken(user *auth.User, decision auth.Decision, audience, nonce string) (string, error) {
+	if user == nil || !decision.Allowed {
+		return "", auth.ErrNotAllowed
+	}
+	claims := p.claims(user, decision)
+	now := time.Now()
+	claims["iss"] = p.issuer()
+	claims["aud"] = audience
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(p.ttl()).Unix()
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": p.keyID()})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, p.Key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// claims are the standard claims of user, plus the matched teams as groups
+// and the roles
+func (p *Provider) claims(user *auth.User, decision auth.Decision) map[string]interface{} {
+	c := auth.NewClaims(user, decision)
+	claims := map[string]interface{}{
+		"sub":                subject(user),
+		"preferred_username": user.Login,
+	}
+	if user.Name != "" {
+		claims["name"] = user.Name
+	}
+	if user.Email != "" {
+		claims["email"] = user.Email
+		claims["email_verified"] = true
+	}
+	if user.Avatar != "" {
+		claims["picture"] = user.Avatar
+	}
+	if len(c.Teams) > 0 {
+		claims["groups"] = c.Teams
+	}
+	if len(c.Roles) > 0 {
+		claims["roles"] = c.Roles
+	}
+	return claims
+}
+
+// subject returns the github id of user, which never changes, or their
+// login for users without one
+func subject(user *auth.User) string {
+	if user.ID == 0 {
+		return user.Login
+	}
+	return strconv.FormatInt(user.ID, 10)
+}
+
+func (p *Provider) discovery(w http.ResponseWriter) {
+	issuer := p.issuer()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"token_endpoint":                        issuer + "/token",
+		"userinfo_endpoint":                     issuer + "/userinfo",
+		"jwks_uri":                              issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      []string{"openid", "profile", "email"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter) {
+	pub := p.Key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": p.keyID(),
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize signs the user in through Config and sends them back to the
+// client with a code
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	client, ok := p.client(r.FormValue("client_id"))
+	redirect := r.FormValue("redirect_uri")
+	if !ok || !contains(client.RedirectURIs, redirect) {
+		http.Error(w, "oidc: unknown client or redirect_uri", http.StatusBadRequest)
+		return
+	}
+	back, err := url.Parse(redirect)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := back.Query()
+	if state := r.FormValue("state"); state != "" {
+		q.Set("state", state)
+	}
+	if r.FormValue("response_type") != "code" {
+		redirectError(w, r, back, q, "unsupported_response_type")
+		return
+	}
+	if !contains(strings.Fields(r.FormValue("scope")), "openid") {
+		redirectError(w, r, back, q, "invalid_scope")
+		return
+	}
+	challenge := r.FormValue("code_challenge")
+	if challenge != "" && r.FormValue("code_challenge_method") != "S256" {
+		redirectError(w, r, back, q, "invalid_request")
+		return
+	}
+	if challenge == "" && client.Secret == "" {
+		redirectError(w, r, back, q, "invalid_request")
+		return
+	}
+
+	r2, err := p.Config.Authenticate(w, r)
+	if err == auth.ErrNoSession {
+		http.Redirect(w, r, p.Config.LoginRedirect(r), http.StatusFound)
+		return
+	}
+	if err == auth.ErrLinkRequired {
+		redirectError(w, r, back, q, "login_required")
+		return
+	}
+	if _, ok := auth.ReasonOf(err); ok {
+		redirectError(w, r, back, q, "access_denied")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	user, _ := auth.UserFromContext(r2.Context())
+	decision, _ := auth.DecisionFromContext(r2.Context())
+
+	code := random()
+	p.mu.Lock()
+	if p.codes == nil {
+		p.codes = make(map[string]grant)
+	}
+	p.sweep(p.codes)
+	p.codes[code] = grant{
+		client:    client.ID,
+		redirect:  redirect,
+		nonce:     r.FormValue("nonce"),
+		challenge: challenge,
+		user:      user,
+		decision:  decision,
+		expires:   time.Now().Add(time.Minute),
+	}
+	p.mu.Unlock()
+
+	q.Set("code", code)
+	back.RawQuery = q.Encode()
+	http.Redirect(w, r, back.String(), http.StatusFound)
+}
+
+// token trades a code for tokens. Codes are single use. Public clients
+// authenticate with the PKCE verifier of the code instead of a secret
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id, secret = r.FormValue("client_id"), r.FormValue("client_secret")
+	}
+	client, known := p.client(id)
+	if !known || client.Secret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(client.Secret)) != 1 {
+		tokenError(w, http.StatusUnauthorized, errInvalidClient.Error())
+		return
+	}
+	if r.FormValue("grant_type") != "authorization_code" {
+		tokenError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	p.mu.Lock()
+	g, found := p.codes[r.FormValue("code")]
+	delete(p.codes, r.FormValue("code"))
+	p.mu.Unlock()
+	if !found || time.Now().After(g.expires) || g.client != client.ID || g.redirect != r.FormValue("redirect_uri") {
+		tokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+	if (g.challenge != "" || client.Secret == "") && !verifies(r.FormValue("code_verifier"), g.challenge) {
+		tokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	idToken, err := p.IDToken(g.user, g.decision, client.ID, g.nonce)
+	if err != nil {
+		tokenError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	access := random()
+	p.mu.Lock()
+	if p.access == nil {
+		p.access = make(map[string]grant)
+	}
+	p.sweep(p.access)
+	p.access[access] = grant{client: client.ID, user: g.user, decision: g.decision, expires: time.Now().Add(p.ttl())}
+	p.mu.Unlock()
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": access,
+		"token_type":   "Bearer",
+		"expires_in":   int(p.ttl().Seconds()),
+		"id_token":     idToken,
+	})
+}
+
+// userinfo returns the claims of the bearer access token
+func (p *Provider) userinfo(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	p.mu.Lock()
+	g, ok := p.access[token]
+	p.mu.Unlock()
+	if !ok || time.Now().After(g.expires) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	writeJSON(w, http.StatusOK, p.claims(g.user, g.decision))
+}
+
+func (p *Provider) client(id string) (Client, bool) {
+	for _, c := range p.Clients {
+		if id != "" && c.ID == id {
+			return c, true
+		}
+	}
+	return Client{}, false
+}
+
+// sweep drops expired grants, p.mu must be held
+func (p *Provider) sweep(grants map[string]grant) {
+	now := time.Now()
+	for k, g := range grants {
+		if now.After(g.expires) {
+			delete(grants, k)
+		}
+	}
+}
+
+// issuer is Issuer without a trailing slash, the same in discovery and
+// in the iss claim
+func (p *Provider) issuer() string {
+	return strings.TrimSuffix(p.Issuer, "/")
+}
+
+func (p *Provider) ttl() time.Duration {
+	if p.TTL == 0 {
+		return time.Hour
+	}
+	return p.TTL
+}
+
+// keyID returns KeyID, or a thumbprint of the public key
+func (p *Provider) keyID() string {
+	if p.KeyID != "" {
+		return p.KeyID
+	}
+	sum := sha256.Sum256(p.Key.PublicKey.N.Bytes())
+	return hex.EncodeToString(sum[:8])
+}
+
+// verifies reports whether verifier is the PKCE verifier of the S256
+// challenge
+func verifies(verifier, challenge string) bool {
+	if verifier == "" || challenge == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(challenge)) == 1
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func random() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// redirectError sends the user back to the client with an OAuth error
+func redirectError(w http.ResponseWriter, r *http.Request, back *url.URL, q url.Values, code string) {
+	q.Set("error", code)
+	back.RawQuery = q.Encode()
+	http.Redirect(w, r, back.String(), http.StatusFound)
+}
+
+func tokenError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,159 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RealGeeks/github-org-auth/auth"
+)
+
+func testProvider(t *testing.T) *Provider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Provider{
+		Config: &auth.Config{},
+		Issuer: "https://id.example.com/",
+		Key:    key,
+		Clients: []Client{
+			{ID: "wiki", Secret: "secret", RedirectURIs: []string{"https://wiki.example.com/callback"}},
+			{ID: "cli", RedirectURIs: []string{"http://localhost/callback"}},
+		},
+	}
+}
+
+func TestIssuer(t *testing.T) {
+	p := testProvider(t)
+	w := httptest.NewRecorder()
+	p.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/.well-known/openid-configuration", nil))
+	var discovery struct {
+		Issuer string `json:"issuer"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&discovery); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := p.IDToken(&auth.User{ID: 1, Login: "alice"}, auth.Decision{Allowed: true}, "wiki", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims struct {
+		Issuer string `json:"iss"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	if discovery.Issuer != "https://id.example.com" || claims.Issuer != discovery.Issuer {
+		t.Errorf("discovery issuer %q, iss %q, want both https://id.example.com", discovery.Issuer, claims.Issuer)
+	}
+}
+
+func TestAuthorizeRejects(t *testing.T) {
+	p := testProvider(t)
+	tests := []struct {
+		name  string
+		query string
+		error string
+	}{
+		{"response type", "client_id=wiki&redirect_uri=https://wiki.example.com/callback&response_type=token&scope=openid", "unsupported_response_type"},
+		{"no openid scope", "client_id=wiki&redirect_uri=https://wiki.example.com/callback&response_type=code&scope=profile", "invalid_scope"},
+		{"public client without pkce", "client_id=cli&redirect_uri=http://localhost/callback&response_type=code&scope=openid", "invalid_request"},
+		{"plain pkce", "client_id=cli&redirect_uri=http://localhost/callback&response_type=code&scope=openid&code_challenge=abc&code_challenge_method=plain", "invalid_request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			p.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/authorize?"+tt.query+"&state=s1", nil))
+			if w.Code != http.StatusFound {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusFound)
+			}
+			u, err := url.Parse(w.Header().Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := u.Query().Get("error"); got != tt.error {
+				t.Errorf("error = %q, want %q", got, tt.error)
+			}
+			if got := u.Query().Get("state"); got != "s1" {
+				t.Errorf("state = %q, want s1", got)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	p.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/authorize?client_id=wiki&redirect_uri=https://evil.example.com/&response_type=code&scope=openid", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown redirect_uri status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestTokenPKCE(t *testing.T) {
+	verifier := "a-verifier-long-enough-to-be-a-real-one-0123456789"
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	tests := []struct {
+		name      string
+		client    string
+		secret    string
+		challenge string
+		verifier  string
+		status    int
+	}{
+		{"public client", "cli", "", challenge, verifier, http.StatusOK},
+		{"public client, wrong verifier", "cli", "", challenge, "wrong", http.StatusBadRequest},
+		{"public client, no verifier", "cli", "", challenge, "", http.StatusBadRequest},
+		{"public client, no challenge", "cli", "", "", "", http.StatusBadRequest},
+		{"confidential client", "wiki", "secret", "", "", http.StatusOK},
+		{"confidential client, pkce", "wiki", "secret", challenge, verifier, http.StatusOK},
+		{"confidential client, wrong verifier", "wiki", "secret", challenge, "wrong", http.StatusBadRequest},
+		{"confidential client, wrong secret", "wiki", "nope", "", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := testProvider(t)
+			redirect := p.Clients[0].RedirectURIs[0]
+			if tt.client == "cli" {
+				redirect = p.Clients[1].RedirectURIs[0]
+			}
+			p.codes = map[string]grant{"c1": {
+				client:    tt.client,
+				redirect:  redirect,
+				challenge: tt.challenge,
+				user:      &auth.User{ID: 1, Login: "alice"},
+				decision:  auth.Decision{Allowed: true},
+				expires:   time.Now().Add(time.Minute),
+			}}
+
+			form := url.Values{
+				"grant_type":    {"authorization_code"},
+				"code":          {"c1"},
+				"redirect_uri":  {redirect},
+				"client_id":     {tt.client},
+				"client_secret": {tt.secret},
+				"code_verifier": {tt.verifier},
+			}
+			r := httptest.NewRequest("POST", "/token", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			p.Handler().ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"context"
+
+	"golang.org/x/oauth2"
+)
+
+// NewPKCEVerifier returns a random PKCE code verifier for one login. Keep
+// it next to the state until the callback, it must not leave the client
+func NewPKCEVerifier() string {
+	return oauth2.GenerateVerifier()
+}
+
+// AuthCodeURLWithPKCE is AuthCodeURL() sending the S256 challenge of
+// verifier, for public clients like desktop or mobile apps which can't
+// keep a ClientSecret. Set PublicClient and leave ClientSecret empty then
+func (c *Config) AuthCodeURLWithPKCE(state, verifier string) string {
+	return c.oauth2Config().AuthCodeURL(state, c.accessType(), oauth2.S256ChallengeOption(verifier))
+}
+
+// ExchangeWithPKCE is Exchange() for flows started with
+// AuthCodeURLWithPKCE(), proving to github the code is ours with verifier
+func (c *Config) ExchangeWithPKCE(ctx context.Context, code, verifier string) (*oauth2.Token, error) {
+	return c.exchange(ctx, code, oauth2.VerifierOption(verifier))
+}
+
+// CheckPermissionWithPKCE is CheckPermissionContext() for flows started with
+// AuthCodeURLWithPKCE()
+func (c *Config) CheckPermissionWithPKCE(ctx context.Context, code, verifier string) (ok bool, user *User, err error) {
+	token, err := c.ExchangeWithPKCE(ctx, code, verifier)
+	if err != nil {
+		return false, nil, err
+	}
+	return c.CheckPermissionWithTokenContext(ctx, token)
+}
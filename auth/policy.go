@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// PolicyState is the access policy adjustable at runtime through the admin
+// API of a RuntimePolicy
+type PolicyState struct {
+	AllowedTeams []string            `json:"allowed_teams"` // extra org/team entries letting users in, globs allowed
+	Roles        map[string][]string `json:"roles"`         // org/team -> roles, evaluated like a RoleFile
+	Overrides    map[string]bool     `json:"overrides"`     // github login -> allowed, winning over everything else
+}
+
+// PolicyStore persists a PolicyState so runtime changes survive restarts
+type PolicyStore interface {
+	Load(ctx context.Context) (PolicyState, error)
+	Save(ctx context.Context, state PolicyState) error
+}
+
+// FilePolicyStore is a PolicyStore keeping the state as json in a file. A
+// missing file is an empty policy
+type FilePolicyStore struct {
+	Path string
+}
+
+// Load implements PolicyStore
+func (f *FilePolicyStore) Load(ctx context.Context) (PolicyState, error) {
+	var state PolicyState
+	raw, err := os.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(raw, &state)
+	return state, err
+}
+
+// Save implements PolicyStore, replacing the file atomically
+func (f *FilePolicyStore) Save(ctx context.Context, state PolicyState) error {
+	raw, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := f.Path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.Path)
+}
+
+// RuntimePolicy is access policy which can be changed while running, so
+// policy changes don't require config redeploys. Use its Authorize method as
+// Config.Authorize and itself as Config.Roles, and mount AdminHandler()
+// somewhere only operators can reach
+type RuntimePolicy struct {
+	store PolicyStore
+
+	mu    sync.RWMutex
+	state PolicyState
+	teams []roleRule
+	roles []roleRule
+}
+
+// NewRuntimePolicy loads the policy kept in store
+func NewRuntimePolicy(ctx context.Context, store PolicyStore) (*RuntimePolicy, error) {
+	state, err := store.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p := &RuntimePolicy{store: store}
+	if err := p.set(state); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// State returns the current policy
+func (p *RuntimePolicy) State() PolicyState {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.state
+}
+
+// Update validates, persists and applies a new policy
+func (p *RuntimePolicy) Update(ctx context.Context, state PolicyState) error {
+	if _, _, err := parsePolicy(state); err != nil {
+		return err
+	}
+	if err := p.store.Save(ctx, state); err != nil {
+		return err
+	}
+	return p.set(state)
+}
+
+// set applies state without persisting it
+func (p *RuntimePolicy) set(state PolicyState) error {
+	teams, roles, err := parsePolicy(state)
+	if err != nil {
+		return err
+	}
+
+	// logins are case insensitive, like in github
+
+	overrides := make(map[string]bool, len(state.Overrides))
+	for login, allowed := range state.Overrides {
+		overrides[strings.ToLower(login)] = allowed
+	}
+	state.Overrides = overrides
+
+	p.mu.Lock()
+	p.state, p.teams, p.roles = state, teams, roles
+	p.mu.Unlock()
+	return nil
+}
+
+// parsePolicy validates state and returns its rules
+func parsePolicy(state PolicyState) (teams, roles []roleRule, err error) {
+	for _, k := range state.AllowedTeams {
+		rule, err := parseTeamKey(k)
+		if err != nil {
+			return nil, nil, err
+		}
+		teams = append(teams, rule)
+	}
+	roles, err = parseRoleRules(state.Roles)
+	return teams, roles, err
+}
+
+// Authorize is an AuthorizeFunc applying the overrides and allowed teams
+func (p *RuntimePolicy) Authorize(ctx context.Context, user *User, teams []Team, decision Decision) (Decision, error) {
+	p.mu.RLock()
+	allowed, overridden := p.state.Overrides[strings.ToLower(user.Login)]
+	extra := p.teams
+	p.mu.RUnlock()
+
+	switch {
+	case overridden && !allowed:
+		decision.Allowed, decision.Reason = false, DeniedByPolicy
+		return decision, nil
+	case decision.Allowed:
+		return decision, nil
+	case !overridden:
+		for _, rule := range extra {
+			if rule.match(teams) {
+				overridden, allowed = true, true
+				break
+			}
+		}
+	}
+	if !allowed {
+		return decision, nil
+	}
+
+	roles, err := p.MapRoles(ctx, user, teams)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	// keep the teams, org role and the rest of what was found out
+
+	decision.Allowed, decision.Reason, decision.Roles = true, "", roles
+	return decision, nil
+}
+
+// MapRoles implements RoleMapper
+func (p *RuntimePolicy) MapRoles(ctx context.Context, user *User, teams []Team) ([]string, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return mapRules(p.roles, teams), nil
+}
+
+// AdminHandler serves the admin REST API, mount it with http.StripPrefix:
+//
+//	GET    /                  current policy
+//	PUT    /teams             replace allowed teams, body ["org/team", ...]
+//	PUT    /roles             replace role mappings, body {"org/team": ["role"]}
+//	PUT    /overrides/{login} body true to allow login, false to deny it
+//	DELETE /overrides/{login} remove the override of login
+//
+// allow gates access like in Config.InfoHandler(), nil rejects everybody
+func (p *RuntimePolicy) AdminHandler(allow func(r *http.Request) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if allow == nil || !allow(r) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		path := strings.Trim(r.URL.Path, "/")
+		state := p.State()
+		var err error
+		switch {
+		case path == "" && r.Method == "GET":
+		case path == "teams" && r.Method == "PUT":
+			state.AllowedTeams = nil
+			err = json.NewDecoder(r.Body).Decode(&state.AllowedTeams)
+		case path == "roles" && r.Method == "PUT":
+			state.Roles = nil
+			err = json.NewDecoder(r.Body).Decode(&state.Roles)
+		case strings.HasPrefix(path, "overrides/") && (r.Method == "PUT" || r.Method == "DELETE"):
+			login := strings.ToLower(strings.TrimPrefix(path, "overrides/"))
+			overrides := make(map[string]bool, len(state.Overrides)+1)
+			for k, v := range state.Overrides {
+				overrides[k] = v
+			}
+			if r.Method == "DELETE" {
+				delete(overrides, login)
+			} else {
+				var allowed bool
+				err = json.NewDecoder(r.Body).Decode(&allowed)
+				overrides[login] = allowed
+			}
+			state.Overrides = overrides
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		if err == nil {
+			_, _, err = parsePolicy(state)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.Method != "GET" {
+			if err := p.Update(r.Context(), state); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p.State())
+	})
+}
@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// TeamMembers keeps the members of the configured teams in memory, listed
+// in the background with Config.ServerToken, so Verify() only asks github
+// for the profile of users it finds there. Users it doesn't find, and
+// every user while the list is missing or too old, get the full check
+//
+//	members := &auth.TeamMembers{Config: cfg}
+//	cfg.Members = members
+//	svc.Go(members.Run)
+type TeamMembers struct {
+	Config   *Config
+	Interval time.Duration // between refreshes, 5 minutes if zero
+	MaxAge   time.Duration // older lists aren't used, 3 Intervals if zero
+
+	// OnError, if set, is called when a refresh fails. The previous list
+	// stays in use until MaxAge
+	OnError func(err error)
+
+	mu      sync.Mutex
+	list    *memberList
+	synced  time.Time
+	removed map[string]time.Time // by Remove(), kept out of lists started before
+}
+
+// Sync refreshes the list now
+func (m *TeamMembers) Sync(ctx context.Context) error {
+	if m.Config.ServerToken == nil {
+		return ErrNoServerToken
+	}
+	client := oauth2.NewClient(withHTTPClient(ctx, m.Config.httpClient()), m.Config.ServerToken)
+	start := time.Now()
+	list, err := m.Config.verifier().listMemberships(ctx, client)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for login, at := range m.removed {
+		if at.Before(start) {
+			delete(m.removed, login)
+			continue
+		}
+		list.remove(login)
+	}
+	m.list, m.synced = list, time.Now()
+	return nil
+}
+
+// Remove drops login from the list until the next refresh, so Verify()
+// gives them the full check. WebhookHandler() calls it for users removed
+// from Organization or its teams
+func (m *TeamMembers) Remove(login string) {
+	login = strings.ToLower(login)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.removed == nil {
+		m.removed = make(map[string]time.Time)
+	}
+	m.removed[login] = time.Now()
+	if m.list == nil {
+		return
+	}
+
+	// lookup() reads the list without the lock, change a copy
+
+	list := &memberList{
+		teams:  make(map[string][]Team, len(m.list.teams)),
+		admins: copySet(m.list.admins),
+		public: copySet(m.list.public),
+	}
+	for l, teams := range m.list.teams {
+		list.teams[l] = teams
+	}
+	list.remove(login)
+	m.list = list
+}
+
+// copySet returns a copy of set, nil if nil
+func copySet(set map[string]bool) map[string]bool {
+	if set == nil {
+		return nil
+	}
+	c := make(map[string]bool, len(set))
+	for k, v := range set {
+		c[k] = v
+	}
+	return c
+}
+
+// Logins returns the lowercase logins of the last list, sorted
+func (m *TeamMembers) Logins() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.list == nil {
+		return nil
+	}
+	logins := make([]string, 0, len(m.list.teams))
+	for login := range m.list.teams {
+		logins = append(logins, login)
+	}
+	sort.Strings(logins)
+	return logins
+}
+
+// Run syncs every Interval until ctx is done
+func (m *TeamMembers) Run(ctx context.Context) {
+	interval := m.Interval
+	if interval == 0 {
+		interval = 5 * time.Minute
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := m.Sync(ctx); err != nil && m.OnError != nil && ctx.Err() == nil {
+			m.OnError(err)
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// lookup returns the decision for login from a fresh enough list, ok is
+// false when the full check is needed
+func (m *TeamMembers) lookup(v *Verifier, login string) (decision Decision, ok bool) {
+	maxAge := m.MaxAge
+	if maxAge == 0 {
+		maxAge = 3 * m.Interval
+		if m.Interval == 0 {
+			maxAge = 15 * time.Minute
+		}
+	}
+	m.mu.Lock()
+	list, synced := m.list, m.synced
+	m.mu.Unlock()
+	if list == nil || time.Since(synced) > maxAge {
+		return Decision{}, false
+	}
+	decision = list.decision(v, login)
+	return decision, decision.Allowed
+}
+
+// decideMembers is decide() answering from v.Members, ok is false when the
+// full check is needed. The user and the /user response are returned for
+// it then
+func (v *Verifier) decideMembers(ctx context.Context, client *http.Client) (Decision, *User, *http.Response, bool, error) {
+	user, resp, err := fetchUser(ctx, client)
+	if err == ErrUnauthorized {
+		return Decision{Reason: TokenInvalid}, nil, nil, true, nil
+	}
+	if err != nil {
+		return Decision{}, nil, nil, true, err
+	}
+	decision, ok := v.Members.lookup(v, user.Login)
+	return decision, user, resp, ok, nil
+}
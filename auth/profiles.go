@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProfileEnv is the environment variable selecting the profile used by
+// ConfigFromProfiles()
+const ProfileEnv = "GITHUB_ORG_AUTH_PROFILE"
+
+// Profiles are named configurations (dev, staging, prod...) kept in one YAML
+// file, so the same binary can be promoted across environments safely:
+//
+//	default: dev
+//	profiles:
+//	  dev:
+//	    organization: myorg
+//	    team: eng
+//	    client_id: abc
+//	    client_secret: ${DEV_CLIENT_SECRET}
+//	    redirect_url: http://localhost:8080/callback
+//	  prod:
+//	    ...
+//
+// ${VAR} references in the values are expanded from the environment so
+// secrets don't need to live in the file. Other $ signs are kept as they are
+type Profiles struct {
+	Default  string             `yaml:"default"`
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+// Profile is one named configuration of Profiles
+type Profile struct {
+	Organization string   `yaml:"organization"`
+	Team         string   `yaml:"team"`
+	AllowedTeams []string `yaml:"allowed_teams"`
+	RequireAll   bool     `yaml:"require_all"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	PublicClient bool     `yaml:"public_client"`
+	RedirectURL  string   `yaml:"redirect_url"`
+	RedirectURLs []string `yaml:"redirect_urls"`
+
+	// Settings are free form values for the application, e.g. session
+	// settings, which differ per environment
+	Settings map[string]string `yaml:"settings"`
+}
+
+// LoadProfiles reads and validates the profiles at path
+func LoadProfiles(path string) (*Profiles, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := new(Profiles)
+	if err := yaml.Unmarshal(raw, p); err != nil {
+		return nil, fmt.Errorf("auth: %s: %v", path, err)
+	}
+	for name, profile := range p.Profiles {
+		profile.expand()
+		p.Profiles[name] = profile
+	}
+	if len(p.Profiles) == 0 {
+		return nil, fmt.Errorf("auth: %s: no profiles", path)
+	}
+	if p.Default != "" {
+		if _, ok := p.Profiles[p.Default]; !ok {
+			return nil, fmt.Errorf("auth: %s: default profile %q doesn't exist", path, p.Default)
+		}
+	}
+	for name, profile := range p.Profiles {
+		if profile.Organization == "" || profile.ClientID == "" || (profile.ClientSecret == "" && !profile.PublicClient) {
+			return nil, fmt.Errorf("auth: %s: profile %q needs organization, client_id and client_secret or public_client", path, name)
+		}
+	}
+	return p, nil
+}
+
+// envRef matches the ${VAR} references expanded in profiles
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces the ${VAR} references in s with their environment value
+func expandEnv(s string) string {
+	return envRef.ReplaceAllStringFunc(s, func(ref string) string {
+		return os.Getenv(ref[2 : len(ref)-1])
+	})
+}
+
+// expand expands the ${VAR} references in the string fields of p, after
+// parsing so values can't change the YAML structure
+func (p *Profile) expand() {
+	for _, s := range []*string{&p.Organization, &p.Team, &p.ClientID, &p.ClientSecret, &p.RedirectURL} {
+		*s = expandEnv(*s)
+	}
+	for _, list := range [][]string{p.AllowedTeams, p.RedirectURLs} {
+		for i := range list {
+			list[i] = expandEnv(list[i])
+		}
+	}
+	for k, v := range p.Settings {
+		p.Settings[k] = expandEnv(v)
+	}
+}
+
+// Config returns a Config for the profile called name, or for the default
+// profile if name is empty
+func (p *Profiles) Config(name string) (*Config, error) {
+	if name == "" {
+		name = p.Default
+	}
+	profile, ok := p.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(p.Profiles))
+		for n := range p.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("auth: unknown profile %q, have %s", name, strings.Join(names, ", "))
+	}
+
+	return &Config{
+		Organization: profile.Organization,
+		Team:         profile.Team,
+		AllowedTeams: profile.AllowedTeams,
+		RequireAll:   profile.RequireAll,
+		ClientID:     profile.ClientID,
+		ClientSecret: profile.ClientSecret,
+		PublicClient: profile.PublicClient,
+		RedirectURL:  profile.RedirectURL,
+		RedirectURLs: profile.RedirectURLs,
+	}, nil
+}
+
+// ConfigFromProfiles loads the profiles at path and returns the Config for
+// the profile named by the ProfileEnv environment variable, or the default one
+func ConfigFromProfiles(path string) (*Config, error) {
+	p, err := LoadProfiles(path)
+	if err != nil {
+		return nil, err
+	}
+	return p.Config(os.Getenv(ProfileEnv))
+}
@@ -0,0 +1,96 @@
+// Package promauth is a Prometheus implementation of auth.Metrics
+//
+//	cfg.Metrics = promauth.New(prometheus.DefaultRegisterer)
+package promauth
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/RealGeeks/github-org-auth/auth"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics exports:
+//
+//	auth_exchanges_total{result}                   code exchanges, ok or error
+//	auth_exchange_seconds                          code exchange latency
+//	auth_verifications_total{result,reason}        allowed, stale, denied or error
+//	auth_verification_seconds                      membership check latency
+//	auth_github_requests_seconds{endpoint,status}  github api latency
+//	auth_github_rate_limit_remaining               last X-RateLimit-Remaining seen
+type Metrics struct {
+	exchanges      *prometheus.CounterVec
+	exchangeTime   prometheus.Histogram
+	verifications  *prometheus.CounterVec
+	verifyTime     prometheus.Histogram
+	requests       *prometheus.HistogramVec
+	rateLimitGauge prometheus.Gauge
+}
+
+// New creates the metrics and registers them with reg
+func New(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		exchanges: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "auth_exchanges_total",
+			Help: "OAuth2 code exchanges by result.",
+		}, []string{"result"}),
+		exchangeTime: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name: "auth_exchange_seconds",
+			Help: "OAuth2 code exchange latency.",
+		}),
+		verifications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "auth_verifications_total",
+			Help: "Membership checks by result and denial reason.",
+		}, []string{"result", "reason"}),
+		verifyTime: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name: "auth_verification_seconds",
+			Help: "Membership check latency.",
+		}),
+		requests: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "auth_github_requests_seconds",
+			Help: "GitHub API request latency by endpoint and status.",
+		}, []string{"endpoint", "status"}),
+		rateLimitGauge: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "auth_github_rate_limit_remaining",
+			Help: "Last X-RateLimit-Remaining returned by GitHub.",
+		}),
+	}
+	reg.MustRegister(m.exchanges, m.exchangeTime, m.verifications, m.verifyTime, m.requests, m.rateLimitGauge)
+	return m
+}
+
+// ObserveExchange implements auth.Metrics
+func (m *Metrics) ObserveExchange(err error, took time.Duration) {
+	if err != nil {
+		m.exchanges.WithLabelValues("error").Inc()
+	} else {
+		m.exchanges.WithLabelValues("ok").Inc()
+	}
+	m.exchangeTime.Observe(took.Seconds())
+}
+
+// ObserveVerify implements auth.Metrics
+func (m *Metrics) ObserveVerify(decision auth.Decision, err error, took time.Duration) {
+	switch {
+	case err != nil && err != auth.ErrLinkRequired:
+		m.verifications.WithLabelValues("error", "").Inc()
+	case decision.Allowed && decision.Stale:
+		m.verifications.WithLabelValues("stale", "").Inc()
+	case decision.Allowed:
+		m.verifications.WithLabelValues("allowed", "").Inc()
+	default:
+		m.verifications.WithLabelValues("denied", string(decision.Reason)).Inc()
+	}
+	m.verifyTime.Observe(took.Seconds())
+}
+
+// ObserveRequest implements auth.Metrics
+func (m *Metrics) ObserveRequest(endpoint string, status int, took time.Duration) {
+	m.requests.WithLabelValues(endpoint, strconv.Itoa(status)).Observe(took.Seconds())
+}
+
+// RateLimitRemaining implements auth.Metrics
+func (m *Metrics) RateLimitRemaining(remaining int) {
+	m.rateLimitGauge.Set(float64(remaining))
+}
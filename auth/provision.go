@@ -0,0 +1,326 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scimUserSchema is the SCIM 2.0 core user schema
+const scimUserSchema = "urn:ietf:params:scim:schemas:core:2.0:User"
+
+// SCIMUser is a team member as a SCIM 2.0 user resource
+type SCIMUser struct {
+	Schemas    []string `json:"schemas"`
+	ID         string   `json:"id,omitempty"` // set by the SCIM service provider
+	ExternalID string   `json:"externalId"`   // github user id
+	UserName   string   `json:"userName"`     // github login
+	Active     bool     `json:"active"`
+}
+
+// AccountProvisioner creates and disables application accounts as users
+// join and leave the team. Provision must be idempotent, since every member
+// gets provisioned on the first sync
+type AccountProvisioner interface {
+	Provision(ctx context.Context, user SCIMUser) error
+	Deprovision(ctx context.Context, user SCIMUser) error
+}
+
+// AccountLister is an AccountProvisioner which can list the accounts it
+// holds, so Provisioner reconciles against them instead of remembering who
+// it provisioned. SCIMEndpoint implements it
+type AccountLister interface {
+	List(ctx context.Context) ([]SCIMUser, error)
+}
+
+// ErrSCIM is an unexpected response from a SCIM service provider
+type ErrSCIM struct {
+	URL    string
+	Status int    // http status code
+	Body   string // start of the response body, SCIM errors are explained there
+}
+
+func (e *ErrSCIM) Error() string {
+	return fmt.Sprintf("auth: scim: unexpected response from %s: %d %s", e.URL, e.Status, http.StatusText(e.Status))
+}
+
+// scimError builds an error for an unexpected SCIM response
+func scimError(resp *http.Response) error {
+	e := &ErrSCIM{URL: resp.Request.URL.String(), Status: resp.StatusCode}
+	if b, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody)); err == nil {
+		e.Body = string(b)
+	}
+	return e
+}
+
+// Provisioner keeps application accounts in sync with the members of a
+// github team, using a token which can read the team (a PAT or a GitHub App
+// installation token) instead of any user's token
+//
+// When Accounts is an AccountLister every sync compares the team with the
+// accounts it lists, deprovisioning the active ones with an ExternalID
+// which aren't members, so leavers are caught after restarts. Accounts
+// without ExternalID weren't made by Provisioner and are left alone. Other
+// AccountProvisioners only get deprovisioned the members which left while
+// the process was running
+type Provisioner struct {
+	Client       *http.Client       // authorized to read the team members
+	Organization string             // Organization name
+	Team         string             // team slug
+	Accounts     AccountProvisioner // where accounts are created and disabled
+	Interval     time.Duration      // time between syncs, 15 minutes if zero
+	OnError      func(error)        // optional, called when a sync fails
+
+	mu    sync.Mutex
+	known map[string]SCIMUser
+}
+
+// Sync lists the team members once, provisioning new members and
+// deprovisioning the ones who left
+func (p *Provisioner) Sync(ctx context.Context) error {
+	members, err := p.members(ctx)
+	if err != nil {
+		return err
+	}
+	if lister, ok := p.Accounts.(AccountLister); ok {
+		return p.reconcile(ctx, lister, members)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.known == nil {
+		p.known = make(map[string]SCIMUser)
+	}
+	for login, u := range members {
+		if _, ok := p.known[login]; ok {
+			continue
+		}
+		if err := p.Accounts.Provision(ctx, u); err != nil {
+			return err
+		}
+		p.known[login] = u
+	}
+	for login, u := range p.known {
+		if _, ok := members[login]; ok {
+			continue
+		}
+		u.Active = false
+		if err := p.Accounts.Deprovision(ctx, u); err != nil {
+			return err
+		}
+		delete(p.known, login)
+	}
+	return nil
+}
+
+// reconcile provisions the members without an active account and
+// deprovisions the accounts of non members listed by lister
+func (p *Provisioner) reconcile(ctx context.Context, lister AccountLister, members map[string]SCIMUser) error {
+	accounts, err := lister.List(ctx)
+	if err != nil {
+		return err
+	}
+	active := make(map[string]bool)
+	for _, a := range accounts {
+		login := strings.ToLower(a.UserName)
+		if _, ok := members[login]; ok {
+			active[login] = a.Active
+			continue
+		}
+		if !a.Active || a.ExternalID == "" {
+			continue
+		}
+		a.Active = false
+		if err := p.Accounts.Deprovision(ctx, a); err != nil {
+			return err
+		}
+	}
+	for login, u := range members {
+		if active[login] {
+			continue
+		}
+		if err := p.Accounts.Provision(ctx, u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// members lists the team members by lowercase login
+func (p *Provisioner) members(ctx context.Context) (map[string]SCIMUser, error) {
+	members := make(map[string]SCIMUser)
+	u := "https://api.github.com/orgs/" + url.PathEscape(p.Organization) + "/teams/" + url.PathEscape(p.Team) + "/members?per_page=100"
+	err := getPages(ctx, p.Client, u, func(page json.RawMessage) error {
+		var users []struct {
+			Login string `json:"login"`
+			ID    int64  `json:"id"`
+		}
+		if err := json.Unmarshal(page, &users); err != nil {
+			return err
+		}
+		for _, u := range users {
+			members[strings.ToLower(u.Login)] = SCIMUser{
+				Schemas:    []string{scimUserSchema},
+				ExternalID: strconv.FormatInt(u.ID, 10),
+				UserName:   u.Login,
+				Active:     true,
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// Run syncs every Interval until ctx is done
+func (p *Provisioner) Run(ctx context.Context) {
+	interval := p.Interval
+	if interval == 0 {
+		interval = 15 * time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := p.Sync(ctx); err != nil && p.OnError != nil {
+			p.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SCIMEndpoint is an AccountProvisioner talking SCIM 2.0 to the /Users
+// resource of a service provider
+type SCIMEndpoint struct {
+	BaseURL string       // SCIM base url, e.g. https://app.example.com/scim/v2
+	Token   string       // bearer token for the service provider
+	Client  *http.Client // http.DefaultClient if nil
+}
+
+// Provision implements AccountProvisioner by creating the user. A 409
+// means the user already exists, it's marked active again
+func (s *SCIMEndpoint) Provision(ctx context.Context, user SCIMUser) error {
+	resp, err := s.do(ctx, "POST", "/Users", user)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusConflict {
+		return s.setActive(ctx, user.UserName, true)
+	}
+	if resp.StatusCode/100 != 2 {
+		return scimError(resp)
+	}
+	return nil
+}
+
+// Deprovision implements AccountProvisioner by marking the user inactive
+func (s *SCIMEndpoint) Deprovision(ctx context.Context, user SCIMUser) error {
+	return s.setActive(ctx, user.UserName, false)
+}
+
+// List implements AccountLister, going through every page of /Users
+func (s *SCIMEndpoint) List(ctx context.Context) ([]SCIMUser, error) {
+	var users []SCIMUser
+	for start := 1; ; {
+		var page struct {
+			TotalResults int        `json:"totalResults"`
+			Resources    []SCIMUser `json:"Resources"`
+		}
+		if err := s.get(ctx, "/Users?count=100&startIndex="+strconv.Itoa(start), &page); err != nil {
+			return nil, err
+		}
+		users = append(users, page.Resources...)
+		start += len(page.Resources)
+		if len(page.Resources) == 0 || start > page.TotalResults {
+			return users, nil
+		}
+	}
+}
+
+// setActive marks userName active or not, unknown users are ignored
+func (s *SCIMEndpoint) setActive(ctx context.Context, userName string, active bool) error {
+	id, err := s.find(ctx, userName)
+	if err != nil || id == "" {
+		return err
+	}
+
+	patch := map[string]interface{}{
+		"schemas": []string{"urn:ietf:params:scim:api:messages:2.0:PatchOp"},
+		"Operations": []map[string]interface{}{
+			{"op": "replace", "value": map[string]bool{"active": active}},
+		},
+	}
+	resp, err := s.do(ctx, "PATCH", "/Users/"+url.PathEscape(id), patch)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return scimError(resp)
+	}
+	return nil
+}
+
+// find returns the service provider id of userName, empty if unknown
+func (s *SCIMEndpoint) find(ctx context.Context, userName string) (string, error) {
+	filter := url.QueryEscape(`userName eq "` + strings.Replace(userName, `"`, ``, -1) + `"`)
+	var list struct {
+		Resources []SCIMUser `json:"Resources"`
+	}
+	if err := s.get(ctx, "/Users?filter="+filter, &list); err != nil {
+		return "", err
+	}
+	if len(list.Resources) == 0 {
+		return "", nil
+	}
+	return list.Resources[0].ID, nil
+}
+
+// get decodes the response to a GET of path into v
+func (s *SCIMEndpoint) get(ctx context.Context, path string, v interface{}) error {
+	resp, err := s.do(ctx, "GET", path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return scimError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// do sends a SCIM request, the caller closes the response body
+func (s *SCIMEndpoint) do(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(s.BaseURL, "/")+path, &buf)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/scim+json")
+	req.Header.Set("Authorization", "Bearer "+s.Token)
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req.WithContext(ctx))
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// PublicPaths lets some requests, like health checks, metrics, static
+// assets or webhooks, skip the auth middleware without restructuring the
+// router around it
+//
+// Patterns are matched against the cleaned request path:
+//
+//	/healthz     exactly /healthz
+//	/static/     /static/ and everything below it
+//	/assets/*.js path.Match globs, * doesn't cross slashes
+//
+// Protected patterns win over Public ones, so /static/ can be public while
+// /static/private/ isn't. Paths with encoded slashes or dot segments that
+// change when cleaned are always protected, so they can't be used to reach
+// around the rules
+type PublicPaths struct {
+	Public    []string
+	Protected []string
+}
+
+// IsPublic reports whether r can skip authentication
+func (p PublicPaths) IsPublic(r *http.Request) bool {
+	if r.URL.RawPath != "" && strings.Contains(strings.ToLower(r.URL.RawPath), "%2f") {
+		return false
+	}
+	clean := path.Clean("/" + r.URL.Path)
+	if strings.HasSuffix(r.URL.Path, "/") && clean != "/" {
+		clean += "/"
+	}
+	if clean != r.URL.Path {
+		return false
+	}
+
+	return matchPaths(p.Public, clean) && !matchPaths(p.Protected, clean)
+}
+
+// Wrap returns middleware running protect, e.g. AppVerifier.Middleware,
+// only for requests which aren't public
+func (p PublicPaths) Wrap(protect func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		protected := protect(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if p.IsPublic(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			protected.ServeHTTP(w, r)
+		})
+	}
+}
+
+// matchPaths reports whether p matches any of patterns
+func matchPaths(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		switch {
+		case isGlob(pattern):
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+		case strings.HasSuffix(pattern, "/"):
+			if strings.HasPrefix(p, pattern) {
+				return true
+			}
+		case p == pattern:
+			return true
+		}
+	}
+	return false
+}
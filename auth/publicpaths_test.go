@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPublicPaths(t *testing.T) {
+	p := PublicPaths{
+		Public:    []string{"/healthz", "/static/", "/assets/*.js"},
+		Protected: []string{"/static/private/"},
+	}
+	tests := []struct {
+		path   string
+		public bool
+	}{
+		{"/healthz", true},
+		{"/healthz/", false},
+		{"/healthzz", false},
+		{"/static/", true},
+		{"/static/app.css", true},
+		{"/static", false},
+		{"/static/private/key", false},
+		{"/static/private/", false},
+		{"/assets/app.js", true},
+		{"/assets/js/app.js", false},
+		{"/assets/app.css", false},
+		{"/static/../admin", false},
+		{"/static/./private/key", false},
+		{"//static/app.css", false},
+		{"/static%2Fprivate/key", false},
+		{"/static/private%2Fkey", false},
+		{"/admin", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.path, nil)
+			if got := p.IsPublic(r); got != tt.public {
+				t.Errorf("IsPublic(%s) = %v, want %v", tt.path, got, tt.public)
+			}
+		})
+	}
+}
+
+func TestPublicPathsWrap(t *testing.T) {
+	p := PublicPaths{Public: []string{"/healthz"}}
+	deny := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		})
+	}
+	h := p.Wrap(deny)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/healthz", http.StatusOK},
+		{"/admin", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.status {
+			t.Errorf("GET %s = %d, want %d", tt.path, w.Code, tt.status)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Counter counts hits per key in fixed time windows. Implement it on top of
+// Redis or similar to share limits between instances
+type Counter interface {
+	// Incr adds a hit to key in the current window, returning the hits so
+	// far and when the window ends
+	Incr(ctx context.Context, key string, window time.Duration) (hits int64, reset time.Time, err error)
+}
+
+// MemoryCounter is an in memory Counter, for single instance deployments
+type MemoryCounter struct {
+	mu      sync.Mutex
+	windows map[string]*counterWindow
+}
+
+// counterWindow is the state of one key
+type counterWindow struct {
+	hits  int64
+	reset time.Time
+}
+
+// Incr implements Counter
+func (m *MemoryCounter) Incr(ctx context.Context, key string, window time.Duration) (int64, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if m.windows == nil {
+		m.windows = make(map[string]*counterWindow)
+	}
+	w, ok := m.windows[key]
+	if !ok || now.After(w.reset) {
+		if len(m.windows) > 10000 {
+			m.sweep(now)
+		}
+		w = &counterWindow{reset: now.Add(window)}
+		m.windows[key] = w
+	}
+	w.hits++
+	return w.hits, w.reset, nil
+}
+
+// sweep drops finished windows. Must be called with m.mu held
+func (m *MemoryCounter) sweep(now time.Time) {
+	for k, w := range m.windows {
+		if now.After(w.reset) {
+			delete(m.windows, k)
+		}
+	}
+}
+
+// Endpoints counted by RateLimiter, whatever path they are mounted on
+const (
+	EndpointLogin    = "login"
+	EndpointCallback = "callback"
+	EndpointValidate = "validate"
+)
+
+// RateLimiter limits hits to the auth endpoints (login, callback, token
+// validation) so they can't be used to exhaust resources or github quota.
+// Set it as Config.RateLimit, and RateLimit of the token verifiers, to
+// count hits per endpoint and client, plus per login on callback
+type RateLimiter struct {
+	Counter Counter                      // shared counters, a MemoryCounter if nil
+	Limit   int64                        // hits allowed per Window per key
+	Window  time.Duration                // 1 minute if zero
+	Key     func(r *http.Request) string // defaults to ClientIP()
+
+	once    sync.Once
+	counter Counter
+}
+
+// Allow counts a hit for key, e.g. "login:octocat" for per-login limits,
+// and reports whether it's within the limit and, if not, when to retry
+func (l *RateLimiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	l.once.Do(func() {
+		l.counter = l.Counter
+		if l.counter == nil {
+			l.counter = new(MemoryCounter)
+		}
+	})
+	window := l.Window
+	if window == 0 {
+		window = time.Minute
+	}
+
+	hits, reset, err := l.counter.Incr(ctx, key, window)
+	if err != nil {
+		return false, 0, err
+	}
+	if hits > l.Limit {
+		return false, time.Until(reset), nil
+	}
+	return true, 0, nil
+}
+
+// Wrap rate limits next as endpoint, e.g. EndpointValidate, answering 429
+// with Retry-After over the limit
+func (l *RateLimiter) Wrap(endpoint string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.limit(w, r, endpoint) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limit counts a hit of the client of r to endpoint, answering 429 and
+// returning true over the limit. A nil l allows everything
+func (l *RateLimiter) limit(w http.ResponseWriter, r *http.Request, endpoint string) bool {
+	if l == nil {
+		return false
+	}
+	key := ClientIP(r)
+	if l.Key != nil {
+		key = l.Key(r)
+	}
+	return l.limitKey(w, r, endpoint+"|"+key)
+}
+
+// limitKey is limit() for any key. Counter errors let requests through, so
+// a broken Redis doesn't lock everybody out
+func (l *RateLimiter) limitKey(w http.ResponseWriter, r *http.Request, key string) bool {
+	if l == nil {
+		return false
+	}
+	ok, retry, err := l.Allow(r.Context(), key)
+	if err != nil || ok {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(retry.Seconds())+1))
+	http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+	return true
+}
+
+// ClientIP returns the ip address of the client of r. Proxy headers aren't
+// trusted, use a custom RateLimiter.Key behind a reverse proxy
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// AuthCodeURLForRequest is AuthCodeURL() for apps served on several domains
+// backed by one OAuth app: the callback url is picked from RedirectURLs by
+// the host of r, falling back to RedirectURL
+//
+// Use ExchangeForRequest() in the callback so github sees the same url
+func (c *Config) AuthCodeURLForRequest(r *http.Request, state string) string {
+	opts := append([]oauth2.AuthCodeOption{c.accessType()}, c.redirectParam(r)...)
+	return c.oauth2Config().AuthCodeURL(state, opts...)
+}
+
+// ExchangeForRequest is Exchange() for callbacks reached through
+// AuthCodeURLForRequest()
+func (c *Config) ExchangeForRequest(ctx context.Context, r *http.Request, code string) (*oauth2.Token, error) {
+	return c.exchange(ctx, code, c.redirectParam(r)...)
+}
+
+// ErrRedirectNotAllowed is returned for callback urls which are neither
+// RedirectURL nor in RedirectURLs
+var ErrRedirectNotAllowed = errors.New("auth: redirect url is not allowed")
+
+// AuthCodeURLWithRedirect is AuthCodeURL() sending github back to redirect,
+// which must be RedirectURL or one of RedirectURLs, e.g. the callback of a
+// preview environment picked by the app
+//
+// Use ExchangeWithRedirect() in the callback with the same redirect
+func (c *Config) AuthCodeURLWithRedirect(state, redirect string) (string, error) {
+	if !c.allowedRedirect(redirect) {
+		return "", ErrRedirectNotAllowed
+	}
+	opt := oauth2.SetAuthURLParam("redirect_uri", redirect)
+	return c.oauth2Config().AuthCodeURL(state, c.accessType(), opt), nil
+}
+
+// ExchangeWithRedirect is Exchange() for callbacks reached through
+// AuthCodeURLWithRedirect()
+func (c *Config) ExchangeWithRedirect(ctx context.Context, code, redirect string) (*oauth2.Token, error) {
+	if !c.allowedRedirect(redirect) {
+		return nil, ErrRedirectNotAllowed
+	}
+	return c.exchange(ctx, code, oauth2.SetAuthURLParam("redirect_uri", redirect))
+}
+
+// allowedRedirect reports whether redirect is a registered callback url
+func (c *Config) allowedRedirect(redirect string) bool {
+	if redirect == "" {
+		return false
+	}
+	for _, u := range append([]string{c.RedirectURL}, c.RedirectURLs...) {
+		if u == redirect {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectParam returns the redirect_uri option for r, none if we don't
+// have a callback url and github should use the registered one
+func (c *Config) redirectParam(r *http.Request) []oauth2.AuthCodeOption {
+	u := c.redirectURLFor(r)
+	if u == "" {
+		return nil
+	}
+	return []oauth2.AuthCodeOption{oauth2.SetAuthURLParam("redirect_uri", u)}
+}
+
+// redirectURLFor picks the registered callback url matching the host of r.
+// Only registered urls are ever returned, so a forged Host header can't send
+// the code anywhere else
+func (c *Config) redirectURLFor(r *http.Request) string {
+	host := hostOnly(r.Host)
+	for _, ru := range c.RedirectURLs {
+		u, err := url.Parse(ru)
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(hostOnly(u.Host), host) {
+			return ru
+		}
+	}
+	return c.RedirectURL
+}
+
+// hostOnly strips the port from a host[:port]
+func hostOnly(hostport string) string {
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		return host
+	}
+	return hostport
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAllowedRedirect(t *testing.T) {
+	c := &Config{
+		RedirectURL:  "https://app.example.com/callback",
+		RedirectURLs: []string{"https://preview.example.com/callback"},
+	}
+	tests := []struct {
+		redirect string
+		ok       bool
+	}{
+		{"https://app.example.com/callback", true},
+		{"https://preview.example.com/callback", true},
+		{"", false},
+		{"https://app.example.com/callback/", false},
+		{"https://app.example.com/callback?x=1", false},
+		{"https://evil.example.com/callback", false},
+		{"http://app.example.com/callback", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.redirect, func(t *testing.T) {
+			if got := c.allowedRedirect(tt.redirect); got != tt.ok {
+				t.Errorf("allowedRedirect(%q) = %v, want %v", tt.redirect, got, tt.ok)
+			}
+		})
+	}
+
+	if _, err := c.AuthCodeURLWithRedirect("state", "https://evil.example.com/callback"); err != ErrRedirectNotAllowed {
+		t.Errorf("AuthCodeURLWithRedirect() error = %v, want ErrRedirectNotAllowed", err)
+	}
+}
+
+func TestRedirectURLFor(t *testing.T) {
+	c := &Config{
+		RedirectURL:  "https://app.example.com/callback",
+		RedirectURLs: []string{"https://preview.example.com/callback", "http://localhost:8080/callback"},
+	}
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"preview.example.com", "https://preview.example.com/callback"},
+		{"PREVIEW.example.com:443", "https://preview.example.com/callback"},
+		{"localhost:9999", "http://localhost:8080/callback"},
+		{"app.example.com", "https://app.example.com/callback"},
+		{"evil.example.com", "https://app.example.com/callback"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/login", nil)
+			r.Host = tt.host
+			if got := c.redirectURLFor(r); got != tt.want {
+				t.Errorf("redirectURLFor(%s) = %q, want %q", tt.host, got, tt.want)
+			}
+		})
+	}
+}
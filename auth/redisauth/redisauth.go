@@ -0,0 +1,57 @@
+// Package redisauth keeps auth memberships in redis, so every instance of an
+// app shares them
+//
+//	cfg.Cache = &redisauth.Cache{Client: redis.NewClient(&redis.Options{Addr: "localhost:6379"})}
+package redisauth
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/RealGeeks/github-org-auth/auth"
+	"github.com/redis/go-redis/v9"
+)
+
+// Cache is an auth.Cache storing memberships as json under Prefix+login
+type Cache struct {
+	Client redis.UniversalClient
+	Prefix string // key prefix, "auth:membership:" if empty
+}
+
+// Get implements auth.Cache
+func (c *Cache) Get(ctx context.Context, login string) (auth.Membership, bool, error) {
+	var m auth.Membership
+	raw, err := c.Client.Get(ctx, c.key(login)).Bytes()
+	if err == redis.Nil {
+		return m, false, nil
+	}
+	if err != nil {
+		return m, false, err
+	}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return m, false, err
+	}
+	return m, true, nil
+}
+
+// Set implements auth.Cache
+func (c *Cache) Set(ctx context.Context, login string, m auth.Membership, ttl time.Duration) error {
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return c.Client.Set(ctx, c.key(login), raw, ttl).Err()
+}
+
+// Delete implements auth.Cache
+func (c *Cache) Delete(ctx context.Context, login string) error {
+	return c.Client.Del(ctx, c.key(login)).Err()
+}
+
+func (c *Cache) key(login string) string {
+	if c.Prefix == "" {
+		return "auth:membership:" + login
+	}
+	return c.Prefix + login
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// repoPermission admits users with MinPermission on Repository, denying
+// them otherwise when no team is configured, so the whole Organization
+// isn't let in. Other decisions are kept
+func (v *Verifier) repoPermission(ctx context.Context, client *http.Client, login string, decision Decision) (Decision, error) {
+	if v.Repository == "" || decision.Reason == TokenInvalid || decision.Allowed && !v.orgOnly() {
+		return decision, nil
+	}
+	ok, err := hasPermission(ctx, client, v.Repository, login, v.minPermission())
+	if err != nil {
+		return Decision{}, err
+	}
+	switch {
+	case ok:
+		return Decision{Allowed: true, Teams: decision.Teams, OrgRole: decision.OrgRole}, nil
+	case decision.Allowed:
+		return Decision{Reason: NotCollaborator, Teams: decision.Teams, OrgRole: decision.OrgRole}, nil
+	}
+	return decision, nil
+}
+
+func (v *Verifier) minPermission() string {
+	if v.MinPermission == "" {
+		return "push"
+	}
+	return v.MinPermission
+}
+
+// permissionRanks orders the permissions of MinPermission, with the names
+// github gives them in role_name and permission
+var permissionRanks = map[string]int{
+	"pull":     1,
+	"read":     1,
+	"triage":   2,
+	"push":     3,
+	"write":    3,
+	"maintain": 4,
+	"admin":    5,
+}
+
+// hasPermission asks github whether login has permission (pull, triage,
+// push, maintain or admin) on repo, given as owner/name. Repositories the
+// token can't see are a no. Custom roles count as the base permission
+// github reports for them
+func hasPermission(ctx context.Context, client *http.Client, repo, login, permission string) (bool, error) {
+	var r struct {
+		Permission string `json:"permission"` // admin, write, read or none
+		RoleName   string `json:"role_name"`  // admin, maintain, write, triage, read or a custom role
+	}
+	u := "https://api.github.com/repos/" + strings.Trim(repo, "/") + "/collaborators/" + url.PathEscape(login) + "/permission"
+	resp, err := get(ctx, client, u, &r)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		rank, ok := permissionRanks[r.RoleName]
+		if !ok {
+			rank = permissionRanks[r.Permission]
+		}
+		return rank > 0 && rank >= permissionRanks[permission], nil
+	case resp.StatusCode == http.StatusNotFound, resp.StatusCode == http.StatusForbidden && !rateLimited(resp):
+		return false, nil
+	}
+	return false, statusError(resp)
+}
@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"context"
+
+	"golang.org/x/oauth2"
+)
+
+// Result is everything learned about a user signing in, returned by
+// AuthenticateCode(). New details are added here
+type Result struct {
+	Allowed      bool
+	User         *User         // nil when the Reason is TokenInvalid
+	Teams        []Team        // teams of the user in Organization, see Decision.Teams
+	Token        *oauth2.Token // github token of the user
+	DeniedReason Reason        // why access was denied, empty when Allowed
+	Decision     Decision      // the full decision
+}
+
+// AuthenticateCode exchanges the code given to the callback url and checks
+// the user, like CheckPermission() and CheckDecision() do, returning all of
+// it as a Result. With Config.Accounts set err can also be ErrLinkRequired
+// together with the Result, and errors with a ReasonOf() come with a
+// denied Result too
+func (c *Config) AuthenticateCode(ctx context.Context, code string) (*Result, error) {
+	token, err := c.Exchange(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	decision, user, err := c.Verify(ctx, token)
+	if reason, ok := ReasonOf(err); ok {
+		decision = Decision{Reason: reason}
+	} else if err != nil && err != ErrLinkRequired {
+		return nil, err
+	}
+	return &Result{
+		Allowed:      decision.Allowed,
+		User:         user,
+		Teams:        decision.Teams,
+		Token:        token,
+		DeniedReason: decision.Reason,
+		Decision:     decision,
+	}, err
+}
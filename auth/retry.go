@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryTransport retries idempotent requests github answers with 502, 503
+// or 504, backing off exponentially, and those refused by secondary rate
+// limits after the Retry-After github asks for. Config and Verifier use it
+// for their github api calls, see Retries
+type RetryTransport struct {
+	Base     http.RoundTripper // http.DefaultTransport if nil
+	Retries  int               // retries after the first attempt
+	Backoff  time.Duration     // first backoff, doubled on each retry, 200ms if zero
+	MaxDelay time.Duration     // longest wait, longer Retry-After aren't retried, 10 seconds if zero
+}
+
+func (t *RetryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return base.RoundTrip(r)
+	}
+
+	backoff := t.Backoff
+	if backoff == 0 {
+		backoff = 200 * time.Millisecond
+	}
+	maxDelay := t.MaxDelay
+	if maxDelay == 0 {
+		maxDelay = 10 * time.Second
+	}
+	for attempt := 0; ; attempt++ {
+		resp, err := base.RoundTrip(r)
+		if err != nil || attempt >= t.Retries {
+			return resp, err
+		}
+		delay, ok := retryDelay(resp, backoff<<attempt)
+		if !ok || delay > maxDelay {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-r.Context().Done():
+			timer.Stop()
+			return nil, r.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryDelay returns how long to wait before retrying resp, ok is false if
+// it shouldn't be retried
+func retryDelay(resp *http.Response, backoff time.Duration) (delay time.Duration, ok bool) {
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return backoff, true
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+		if err != nil {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	return 0, false
+}
+
+// retryClient returns a copy of base, http.DefaultClient if nil, retrying
+// up to retries times. Zero means 2 retries, negative disables them
+func retryClient(base *http.Client, retries int) *http.Client {
+	if retries < 0 {
+		return base
+	}
+	if retries == 0 {
+		retries = 2
+	}
+	if base == nil {
+		base = http.DefaultClient
+	}
+	c := *base
+	c.Transport = &RetryTransport{Base: base.Transport, Retries: retries}
+	return &c
+}
+
+// httpClient returns the client used for github requests made for users
+func (c *Config) httpClient() *http.Client {
+	base := rateLimitClient(c.HTTPClient, &c.limits, c.RateLimitFloor)
+	return retryClient(metricsClient(logClient(timeoutClient(base, c.timeout()), c.Logger), c.Metrics), c.Retries)
+}
+
+// httpClient returns the client used for github requests
+func (v *Verifier) httpClient() *http.Client {
+	base := rateLimitClient(v.HTTPClient, v.RateLimits, v.RateLimitFloor)
+	return retryClient(metricsClient(logClient(timeoutClient(base, v.Timeout), v.Logger), v.Metrics), v.Retries)
+}
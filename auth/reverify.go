@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Reverifier periodically checks active sessions against github again and
+// invalidates the ones whose user lost membership, closing the gap between
+// removal from the Team and cookie expiry
+//
+// Config.Reverifier does it for the sessions of Handler(). Otherwise Track
+// sessions after a successful login, Forget them on logout, and call
+// Revoked() on every request to log out invalidated sessions
+type Reverifier struct {
+	// Verify checks a token again, use Config.Verify or Verifier.VerifyToken
+	Verify func(ctx context.Context, token *oauth2.Token) (Decision, *User, error)
+
+	// Interval between checks of each session, 10 minutes if zero
+	Interval time.Duration
+
+	// OnRevoke, if set, is called when a session gets invalidated
+	OnRevoke func(sessionID string, user *User, decision Decision)
+
+	// OnError, if set, is called when a check fails. Sessions are kept on
+	// errors, so a github outage doesn't log everybody out
+	OnError func(sessionID string, err error)
+
+	// Events optionally receives a revoked Event for every invalidated
+	// session of Organization
+	Events       Publisher
+	Organization string
+
+	mu       sync.Mutex
+	sessions map[string]*trackedSession
+	revoked  map[string]time.Time
+}
+
+// trackedSession is a session being re-verified
+type trackedSession struct {
+	token   *oauth2.Token
+	checked time.Time
+}
+
+// Track starts re-verifying the session identified by sessionID
+func (r *Reverifier) Track(sessionID string, token *oauth2.Token) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sessions == nil {
+		r.sessions = make(map[string]*trackedSession)
+	}
+	r.sessions[sessionID] = &trackedSession{token: token, checked: time.Now()}
+	delete(r.revoked, sessionID)
+}
+
+// Forget stops re-verifying sessionID, e.g. on logout
+func (r *Reverifier) Forget(sessionID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions, sessionID)
+	delete(r.revoked, sessionID)
+}
+
+// Revoked reports whether sessionID was invalidated and must be logged out
+func (r *Reverifier) Revoked(sessionID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.revoked[sessionID]
+	return ok
+}
+
+// Run checks sessions as they become due until ctx is done
+func (r *Reverifier) Run(ctx context.Context) {
+	tick := r.interval() / 10
+	if tick < time.Second {
+		tick = time.Second
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.checkDue(ctx)
+		}
+	}
+}
+
+// checkDue checks every session last checked more than Interval ago
+func (r *Reverifier) checkDue(ctx context.Context) {
+	now := time.Now()
+	due := make(map[string]*oauth2.Token)
+	r.mu.Lock()
+	for id, s := range r.sessions {
+		if now.Sub(s.checked) >= r.interval() {
+			due[id] = s.token
+			s.checked = now
+		}
+	}
+	r.mu.Unlock()
+
+	for id, token := range due {
+		decision, user, err := r.Verify(ctx, token)
+		if err != nil {
+			if r.OnError != nil {
+				r.OnError(id, err)
+			}
+			continue
+		}
+		if decision.Allowed {
+			continue
+		}
+
+		r.mu.Lock()
+		if _, ok := r.sessions[id]; ok {
+			delete(r.sessions, id)
+			if r.revoked == nil {
+				r.revoked = make(map[string]time.Time)
+			}
+			r.revoked[id] = now
+		}
+		r.mu.Unlock()
+		if r.OnRevoke != nil {
+			r.OnRevoke(id, user, decision)
+		}
+		if r.Events != nil {
+			e := NewEvent(EventRevoked, r.Organization, user, &decision)
+			e.Session = id
+			if err := r.Events.Publish(ctx, e); err != nil && r.OnError != nil {
+				r.OnError(id, err)
+			}
+		}
+	}
+
+	// revoked sessions can't outlive their cookies for long, forget them
+	// eventually so the map doesn't grow forever
+
+	r.mu.Lock()
+	for id, at := range r.revoked {
+		if now.Sub(at) > 24*time.Hour {
+			delete(r.revoked, id)
+		}
+	}
+	r.mu.Unlock()
+}
+
+func (r *Reverifier) interval() time.Duration {
+	if r.Interval == 0 {
+		return 10 * time.Minute
+	}
+	return r.Interval
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/oauth2"
+)
+
+// RevokeToken deletes token on github, so it stops working everywhere and
+// not just in our session. Tokens github doesn't know anymore are fine
+func (c *Config) RevokeToken(ctx context.Context, token *oauth2.Token) error {
+	body, err := json.Marshal(map[string]string{"access_token": token.AccessToken})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("DELETE", "https://api.github.com/applications/"+url.PathEscape(c.ClientID)+"/token", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.ClientID, c.ClientSecret)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return statusError(resp)
+}
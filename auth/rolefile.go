@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RoleFile is a RoleMapper reading a declarative team to roles mapping from
+// a YAML file, so access policy lives in reviewable config instead of code:
+//
+//	teams:
+//	  myorg/admins: [admin, deploy]
+//	  myorg/eng-*: [viewer]
+//
+// Keys are org/team where team is a slug, a name or a glob. Matching ignores
+// case. A user gets the roles of every matching entry
+type RoleFile struct {
+	path string
+
+	mu      sync.RWMutex
+	rules   []roleRule
+	modTime time.Time
+}
+
+// roleRule is one validated entry of a RoleFile
+type roleRule struct {
+	org   string
+	team  string
+	roles []string
+}
+
+// roleFileData is the YAML layout of a RoleFile
+type roleFileData struct {
+	Teams map[string][]string `yaml:"teams"`
+}
+
+// LoadRoleFile reads and validates the mapping at path
+func LoadRoleFile(path string) (*RoleFile, error) {
+	f := &RoleFile{path: path}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Reload reads the file again. On error the previous mapping is kept
+func (f *RoleFile) Reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	raw, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	rules, err := parseRoleFile(raw)
+	if err != nil {
+		return fmt.Errorf("auth: %s: %v", f.path, err)
+	}
+
+	f.mu.Lock()
+	f.rules, f.modTime = rules, info.ModTime()
+	f.mu.Unlock()
+	return nil
+}
+
+// Watch reloads the file every interval when it changed, until ctx is done.
+// Reload errors are given to onError, which may be nil, and the previous
+// mapping is kept
+func (f *RoleFile) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(f.path)
+		if err == nil {
+			f.mu.RLock()
+			changed := !info.ModTime().Equal(f.modTime)
+			f.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			err = f.Reload()
+		}
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+// MapRoles implements RoleMapper
+func (f *RoleFile) MapRoles(ctx context.Context, user *User, teams []Team) ([]string, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return mapRules(f.rules, teams), nil
+}
+
+// mapRules returns the roles of every rule matched by teams, without
+// duplicates
+func mapRules(rules []roleRule, teams []Team) []string {
+	var roles []string
+	seen := make(map[string]bool)
+	for _, rule := range rules {
+		if !rule.match(teams) {
+			continue
+		}
+		for _, role := range rule.roles {
+			if !seen[role] {
+				seen[role] = true
+				roles = append(roles, role)
+			}
+		}
+	}
+	return roles
+}
+
+// match reports whether any of teams satisfies the rule
+func (r roleRule) match(teams []Team) bool {
+	for _, t := range teams {
+		if !strings.EqualFold(t.Organization, r.org) {
+			continue
+		}
+		for _, name := range []string{t.Slug, t.Name} {
+			if ok, _ := path.Match(r.team, strings.ToLower(name)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseRoleFile decodes and validates a RoleFile
+func parseRoleFile(raw []byte) ([]roleRule, error) {
+	var data roleFileData
+	if err := yaml.Unmarshal(raw, &data); err != nil {
+		return nil, err
+	}
+	return parseRoleRules(data.Teams)
+}
+
+// parseRoleRules validates a team to roles mapping. Rules are sorted so the
+// resulting roles order is stable
+func parseRoleRules(teams map[string][]string) ([]roleRule, error) {
+	keys := make([]string, 0, len(teams))
+	for k := range teams {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	rules := make([]roleRule, 0, len(keys))
+	for _, k := range keys {
+		rule, err := parseTeamKey(k)
+		if err != nil {
+			return nil, err
+		}
+		rule.roles = teams[k]
+		if len(rule.roles) == 0 {
+			return nil, fmt.Errorf("team %q has no roles", k)
+		}
+		for _, role := range rule.roles {
+			if strings.TrimSpace(role) == "" {
+				return nil, fmt.Errorf("team %q has an empty role", k)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// parseTeamKey validates an org/team key, team being a slug, a name or a
+// glob, and returns a rule without roles for it
+func parseTeamKey(k string) (roleRule, error) {
+	parts := strings.SplitN(k, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return roleRule{}, fmt.Errorf("team %q must look like org/team", k)
+	}
+	team := strings.ToLower(parts[1])
+	if _, err := path.Match(team, ""); err != nil {
+		return roleRule{}, fmt.Errorf("team %q: %v", k, err)
+	}
+	return roleRule{org: parts[0], team: team}, nil
+}
@@ -0,0 +1,48 @@
+package auth
+
+import "context"
+
+// RoleMapper resolves application roles from the teams a user belongs to,
+// letting apps do authorization beyond the binary allow/deny. Roles are only
+// resolved for allowed users and end up in Decision.Roles
+type RoleMapper interface {
+	MapRoles(ctx context.Context, user *User, teams []Team) ([]string, error)
+}
+
+// mapRoles fills decision.Roles using v.Roles, if any
+func (v *Verifier) mapRoles(ctx context.Context, user *User, teams []Team, decision *Decision) error {
+	if v.Roles == nil || !decision.Allowed {
+		return nil
+	}
+	roles, err := v.Roles.MapRoles(ctx, user, teams)
+	if err != nil {
+		return err
+	}
+	decision.Roles = roles
+	return nil
+}
+
+// RoleMapperFunc adapts a function to a RoleMapper
+type RoleMapperFunc func(ctx context.Context, user *User, teams []Team) ([]string, error)
+
+// MapRoles implements RoleMapper
+func (f RoleMapperFunc) MapRoles(ctx context.Context, user *User, teams []Team) ([]string, error) {
+	return f(ctx, user, teams)
+}
+
+// TeamRoles is a RoleMapper defined in code, keyed like a RoleFile:
+//
+//	auth.TeamRoles{
+//		"myorg/admins":      {"admin"},
+//		"myorg/engineering": {"viewer"},
+//	}
+type TeamRoles map[string][]string
+
+// MapRoles implements RoleMapper
+func (m TeamRoles) MapRoles(ctx context.Context, user *User, teams []Team) ([]string, error) {
+	rules, err := parseRoleRules(m)
+	if err != nil {
+		return nil, err
+	}
+	return mapRules(rules, teams), nil
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"context"
+	"sync"
+)
+
+// Service ties the background parts of an auth deployment (Reverifier,
+// Provisioner, RoleFile watchers...) to one lifecycle, so rolling deploys
+// stop them cleanly and flush state instead of losing it or dropping events
+//
+//	var svc auth.Service
+//	svc.Go(reverifier.Run)
+//	svc.OnShutdown(func(ctx context.Context) error {
+//		return auth.SaveSnapshots("snapshots.json", snapshots)
+//	})
+//	...
+//	svc.Shutdown(ctx)
+type Service struct {
+	mu       sync.Mutex
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	flushers []func(ctx context.Context) error
+	closed   bool
+}
+
+// Go runs run in the background until Shutdown(). It's a no-op after
+// Shutdown()
+func (s *Service) Go(run func(ctx context.Context)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	if s.ctx == nil {
+		s.ctx, s.cancel = context.WithCancel(context.Background())
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		run(s.ctx)
+	}()
+}
+
+// OnShutdown registers f to flush state on Shutdown(), after every
+// background loop stopped. Flushers run in reverse registration order
+func (s *Service) OnShutdown(f func(ctx context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushers = append(s.flushers, f)
+}
+
+// Shutdown stops the background loops, waits for them until ctx is done,
+// and runs the flushers. The first error is returned but every flusher runs
+func (s *Service) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	if s.cancel != nil {
+		s.cancel()
+	}
+	flushers := s.flushers
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	var first error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		first = ctx.Err()
+	}
+
+	for i := len(flushers) - 1; i >= 0; i-- {
+		if err := flushers[i](ctx); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
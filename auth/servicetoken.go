@@ -0,0 +1,267 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serviceTokenPrefix starts every service token secret, so they are easy to
+// spot by secret scanners
+const serviceTokenPrefix = "gost_"
+
+// ErrServiceTokenNotFound is returned by a ServiceTokenStore for unknown ids
+var ErrServiceTokenNotFound = errors.New("auth: service token not found")
+
+// ServiceToken is a long-lived, revocable credential for clients which
+// can't complete an OAuth flow, like monitoring probes. Only a hash of the
+// secret is kept
+type ServiceToken struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`            // what it's for
+	Hash    string    `json:"hash"`            // sha256 of the secret
+	Paths   []string  `json:"paths,omitempty"` // paths it grants access to with everything below them, all if empty
+	Roles   []string  `json:"roles,omitempty"` // roles it carries
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires,omitempty"` // zero for never
+	Revoked bool      `json:"revoked"`
+}
+
+// allows reports whether t may access p, once cleaned. Paths match whole
+// segments, so /metrics allows /metrics/cpu but not /metrics-admin
+func (t *ServiceToken) allows(p string) bool {
+	if len(t.Paths) == 0 {
+		return true
+	}
+	clean := path.Clean("/" + p)
+	for _, allowed := range t.Paths {
+		allowed = strings.TrimSuffix(path.Clean("/"+allowed), "/")
+		if clean == allowed || strings.HasPrefix(clean, allowed+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ServiceTokenStore persists service tokens
+type ServiceTokenStore interface {
+	Get(ctx context.Context, id string) (*ServiceToken, error)
+	Put(ctx context.Context, t *ServiceToken) error
+	List(ctx context.Context) ([]*ServiceToken, error)
+}
+
+// MemoryServiceTokens is an in memory ServiceTokenStore
+type MemoryServiceTokens struct {
+	mu     sync.Mutex
+	tokens map[string]*ServiceToken
+}
+
+// Get implements ServiceTokenStore
+func (m *MemoryServiceTokens) Get(ctx context.Context, id string) (*ServiceToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tokens[id]
+	if !ok {
+		return nil, ErrServiceTokenNotFound
+	}
+	c := *t
+	return &c, nil
+}
+
+// Put implements ServiceTokenStore
+func (m *MemoryServiceTokens) Put(ctx context.Context, t *ServiceToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tokens == nil {
+		m.tokens = make(map[string]*ServiceToken)
+	}
+	c := *t
+	m.tokens[t.ID] = &c
+	return nil
+}
+
+// List implements ServiceTokenStore
+func (m *MemoryServiceTokens) List(ctx context.Context) ([]*ServiceToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]*ServiceToken, 0, len(m.tokens))
+	for _, t := range m.tokens {
+		c := *t
+		list = append(list, &c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	return list, nil
+}
+
+// ServiceTokens issues and verifies service tokens kept in Store
+type ServiceTokens struct {
+	Store     ServiceTokenStore
+	RateLimit *RateLimiter // optional, limits Middleware() as EndpointValidate
+}
+
+// Issue creates a token. The returned secret is shown only this once, ttl
+// zero means it never expires
+func (s *ServiceTokens) Issue(ctx context.Context, name string, paths, roles []string, ttl time.Duration) (string, *ServiceToken, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return "", nil, err
+	}
+	random, err := randomHex(24)
+	if err != nil {
+		return "", nil, err
+	}
+	secret := serviceTokenPrefix + id + "_" + random
+
+	t := &ServiceToken{
+		ID:      id,
+		Name:    name,
+		Hash:    hashKey(secret),
+		Paths:   paths,
+		Roles:   roles,
+		Created: time.Now(),
+	}
+	if ttl > 0 {
+		t.Expires = t.Created.Add(ttl)
+	}
+	if err := s.Store.Put(ctx, t); err != nil {
+		return "", nil, err
+	}
+	return secret, t, nil
+}
+
+// Verify returns the token of secret if it's valid and allows path
+func (s *ServiceTokens) Verify(ctx context.Context, secret, path string) (*ServiceToken, error) {
+	if !strings.HasPrefix(secret, serviceTokenPrefix) {
+		return nil, ErrTokenRejected
+	}
+	parts := strings.SplitN(strings.TrimPrefix(secret, serviceTokenPrefix), "_", 2)
+	if len(parts) != 2 {
+		return nil, ErrTokenRejected
+	}
+	t, err := s.Store.Get(ctx, parts[0])
+	if err == ErrServiceTokenNotFound {
+		return nil, ErrTokenRejected
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hashKey(secret))) != 1 {
+		return nil, ErrTokenRejected
+	}
+	if t.Revoked || (!t.Expires.IsZero() && time.Now().After(t.Expires)) || !t.allows(path) {
+		return nil, ErrTokenRejected
+	}
+	return t, nil
+}
+
+// Revoke makes the token with id unusable
+func (s *ServiceTokens) Revoke(ctx context.Context, id string) error {
+	t, err := s.Store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	t.Revoked = true
+	return s.Store.Put(ctx, t)
+}
+
+// Middleware only lets requests with a valid service token in the
+// Authorization header through to next, storing the ServiceToken in the
+// request context, see ServiceTokenFromContext()
+func (s *ServiceTokens) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.RateLimit.limit(w, r, EndpointValidate) {
+			return
+		}
+		t, err := s.Verify(r.Context(), bearer(r), r.URL.Path)
+		if err == ErrTokenRejected {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithServiceToken(r.Context(), t)))
+	})
+}
+
+// AdminHandler serves the service token admin API, mount it with
+// http.StripPrefix:
+//
+//	GET    /     list tokens
+//	POST   /     create a token, body {"name": "", "paths": [], "roles": [], "ttl": "720h"}
+//	DELETE /{id} revoke a token
+//
+// allow gates access like in Config.InfoHandler(), nil rejects everybody
+func (s *ServiceTokens) AdminHandler(allow func(r *http.Request) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if allow == nil || !allow(r) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		id := strings.Trim(r.URL.Path, "/")
+		var body interface{}
+		var err error
+		switch {
+		case id == "" && r.Method == "GET":
+			body, err = s.Store.List(r.Context())
+		case id == "" && r.Method == "POST":
+			var req struct {
+				Name  string   `json:"name"`
+				Paths []string `json:"paths"`
+				Roles []string `json:"roles"`
+				TTL   string   `json:"ttl"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			var ttl time.Duration
+			if req.TTL != "" {
+				if ttl, err = time.ParseDuration(req.TTL); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			var secret string
+			var t *ServiceToken
+			secret, t, err = s.Issue(r.Context(), req.Name, req.Paths, req.Roles, ttl)
+			body = map[string]interface{}{"secret": secret, "token": t}
+		case id != "" && r.Method == "DELETE":
+			err = s.Revoke(r.Context(), id)
+			body = map[string]bool{"revoked": err == nil}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		if err == ErrServiceTokenNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	})
+}
+
+// randomHex returns n random bytes hex encoded
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestServiceTokenAllows(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		path  string
+		ok    bool
+	}{
+		{"no paths", nil, "/anything", true},
+		{"exact", []string{"/api/metrics"}, "/api/metrics", true},
+		{"below", []string{"/api/metrics"}, "/api/metrics/cpu", true},
+		{"trailing slash entry", []string{"/api/metrics/"}, "/api/metrics/cpu", true},
+		{"trailing slash request", []string{"/api/metrics"}, "/api/metrics/", true},
+		{"sibling prefix", []string{"/api/metrics"}, "/api/metricsadmin", false},
+		{"dot segments", []string{"/api/metrics"}, "/api/metrics/../admin", false},
+		{"double slash", []string{"/api/metrics"}, "/api//metrics", true},
+		{"other", []string{"/api/metrics"}, "/api/admin", false},
+		{"relative", []string{"/api/metrics"}, "api/metrics", true},
+		{"root", []string{"/"}, "/api/admin", true},
+		{"any of", []string{"/a", "/b"}, "/b/c", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := &ServiceToken{Paths: tt.paths}
+			if got := token.allows(tt.path); got != tt.ok {
+				t.Errorf("allows(%q) with %q = %v, want %v", tt.path, tt.paths, got, tt.ok)
+			}
+		})
+	}
+}
+
+func TestServiceTokens(t *testing.T) {
+	ctx := context.Background()
+	s := &ServiceTokens{Store: &MemoryServiceTokens{}}
+	secret, token, err := s.Issue(ctx, "ci", []string{"/deploy"}, []string{"deployer"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, old, err := s.Issue(ctx, "old", nil, nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old.Expires = time.Now().Add(-time.Minute)
+	if err := s.Store.Put(ctx, old); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		path   string
+		ok     bool
+	}{
+		{"valid", secret, "/deploy/app", true},
+		{"outside paths", secret, "/admin", false},
+		{"wrong secret", secret + "x", "/deploy", false},
+		{"garbage", "nope", "/deploy", false},
+		{"expired", expired, "/", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Verify(ctx, tt.secret, tt.path)
+			if tt.ok != (err == nil) {
+				t.Fatalf("Verify() error = %v, want ok %v", err, tt.ok)
+			}
+			if tt.ok && got.ID != token.ID {
+				t.Errorf("Verify() = %+v, want %s", got, token.ID)
+			}
+		})
+	}
+
+	if err := s.Revoke(ctx, token.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Verify(ctx, secret, "/deploy"); err == nil {
+		t.Error("Verify() of a revoked token succeeded")
+	}
+}
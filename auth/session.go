@@ -0,0 +1,388 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrNoSession is returned by SessionStore.Load when the request doesn't
+// have a valid session
+var ErrNoSession = errors.New("auth: no session")
+
+// Session is what we remember about an authenticated user between requests
+type Session struct {
+	ID       string        `json:"id,omitempty"` // random, tells sessions apart, e.g. for Reverifier
+	User     *User         `json:"user"`
+	Decision Decision      `json:"decision"`
+	Token    *oauth2.Token `json:"token,omitempty"` // only kept when the app needs it
+	Created  time.Time     `json:"created"`
+	Expires  time.Time     `json:"expires"`
+	Checked  time.Time     `json:"checked,omitempty"` // last check against github after Created, see ReverifyEvery
+	Pending  bool          `json:"pending,omitempty"` // waiting for CompleteLink(), see Config.LinkURL
+
+	// Claims is the payload built by Config.Claims, if set
+	Claims map[string]interface{} `json:"claims,omitempty"`
+}
+
+// SessionStore keeps sessions between requests. Load returns ErrNoSession
+// when r doesn't carry a valid one
+type SessionStore interface {
+	Load(r *http.Request) (*Session, error)
+	Save(w http.ResponseWriter, r *http.Request, s *Session) error
+	Delete(w http.ResponseWriter, r *http.Request) error
+}
+
+// SessionBackend is the storage behind ServerSessions, keyed by session id.
+// Implement it on top of Redis, memcached or SQL
+type SessionBackend interface {
+	Get(ctx context.Context, id string) ([]byte, error) // ErrNoSession if missing or expired
+	Put(ctx context.Context, id string, data []byte, expires time.Time) error
+	Delete(ctx context.Context, id string) error
+
+	// Range calls f for every live session until it returns false
+	Range(ctx context.Context, f func(id string, data []byte, expires time.Time) bool) error
+}
+
+// ServerSessions is a SessionStore keeping sessions in a SessionBackend,
+// with only a random session id in the cookie
+type ServerSessions struct {
+	Backend SessionBackend
+	Cookie  CookieOptions
+}
+
+// CookieOptions describe the session cookie
+type CookieOptions struct {
+	Name     string // "auth_session" if empty
+	Path     string // "/" if empty
+	Domain   string
+	Insecure bool // don't set the Secure flag, only for local development
+}
+
+func (o CookieOptions) name() string {
+	if o.Name == "" {
+		return "auth_session"
+	}
+	return o.Name
+}
+
+func (o CookieOptions) path() string {
+	if o.Path == "" {
+		return "/"
+	}
+	return o.Path
+}
+
+// cookie returns the session cookie with value expiring at expires
+func (o CookieOptions) cookie(value string, expires time.Time) *http.Cookie {
+	c := &http.Cookie{
+		Name:     o.name(),
+		Value:    value,
+		Path:     o.path(),
+		Domain:   o.Domain,
+		Expires:  expires,
+		Secure:   !o.Insecure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if value == "" {
+		c.MaxAge = -1
+	}
+	return c
+}
+
+// Load implements SessionStore
+func (s *ServerSessions) Load(r *http.Request) (*Session, error) {
+	c, err := r.Cookie(s.Cookie.name())
+	if err != nil {
+		return nil, ErrNoSession
+	}
+	data, err := s.Backend.Get(r.Context(), c.Value)
+	if err != nil {
+		return nil, err
+	}
+	session := new(Session)
+	if err := json.Unmarshal(data, session); err != nil {
+		return nil, err
+	}
+	if time.Now().After(session.Expires) {
+		return nil, ErrNoSession
+	}
+	return session, nil
+}
+
+// Save implements SessionStore. Saving always creates a new session id, so
+// ids can't be fixated before login
+func (s *ServerSessions) Save(w http.ResponseWriter, r *http.Request, session *Session) error {
+	if c, err := r.Cookie(s.Cookie.name()); err == nil {
+		s.Backend.Delete(r.Context(), c.Value)
+	}
+	id, err := randomHex(32)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	if err := s.Backend.Put(r.Context(), id, data, session.Expires); err != nil {
+		return err
+	}
+	http.SetCookie(w, s.Cookie.cookie(id, session.Expires))
+	return nil
+}
+
+// Update saves session under the id of r, for changes which don't need a
+// new one like reverifications, so requests still carrying the current
+// cookie keep working. It's Save() when r has no session cookie
+func (s *ServerSessions) Update(w http.ResponseWriter, r *http.Request, session *Session) error {
+	c, err := r.Cookie(s.Cookie.name())
+	if err != nil {
+		return s.Save(w, r, session)
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return s.Backend.Put(r.Context(), c.Value, data, session.Expires)
+}
+
+// sessionUpdater is a SessionStore able to save a session without
+// rotating its id, like ServerSessions
+type sessionUpdater interface {
+	Update(w http.ResponseWriter, r *http.Request, s *Session) error
+}
+
+// updateSession saves s, keeping its id when the store supports it
+func (c *Config) updateSession(w http.ResponseWriter, r *http.Request, s *Session) error {
+	if u, ok := c.sessions().(sessionUpdater); ok {
+		return u.Update(w, r, s)
+	}
+	return c.sessions().Save(w, r, s)
+}
+
+// Delete implements SessionStore
+func (s *ServerSessions) Delete(w http.ResponseWriter, r *http.Request) error {
+	http.SetCookie(w, s.Cookie.cookie("", time.Time{}))
+	c, err := r.Cookie(s.Cookie.name())
+	if err != nil {
+		return nil
+	}
+	return s.Backend.Delete(r.Context(), c.Value)
+}
+
+// MemoryBackend is an in memory SessionBackend, for single instance
+// deployments and tests
+type MemoryBackend struct {
+	mu       sync.Mutex
+	sessions map[string]memorySession
+}
+
+// memorySession is a session kept by MemoryBackend
+type memorySession struct {
+	data    []byte
+	expires time.Time
+}
+
+// Get implements SessionBackend
+func (m *MemoryBackend) Get(ctx context.Context, id string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok || time.Now().After(s.expires) {
+		return nil, ErrNoSession
+	}
+	return s.data, nil
+}
+
+// Put implements SessionBackend
+func (m *MemoryBackend) Put(ctx context.Context, id string, data []byte, expires time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sessions == nil {
+		m.sessions = make(map[string]memorySession)
+	}
+	m.sessions[id] = memorySession{data: data, expires: expires}
+	return nil
+}
+
+// Delete implements SessionBackend
+func (m *MemoryBackend) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+// Range implements SessionBackend
+func (m *MemoryBackend) Range(ctx context.Context, f func(id string, data []byte, expires time.Time) bool) error {
+	m.mu.Lock()
+	sessions := make(map[string]memorySession, len(m.sessions))
+	for id, s := range m.sessions {
+		sessions[id] = s
+	}
+	m.mu.Unlock()
+
+	now := time.Now()
+	for id, s := range sessions {
+		if now.After(s.expires) {
+			continue
+		}
+		if !f(id, s.data, s.expires) {
+			break
+		}
+	}
+	return nil
+}
+
+// SessionInfo describes a live session in ServerSessions.AdminHandler()
+type SessionInfo struct {
+	ID      string    `json:"id"` // hash of the session id, which stays secret
+	Login   string    `json:"login"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+// Sessions lists the live sessions
+func (s *ServerSessions) Sessions(ctx context.Context) ([]SessionInfo, error) {
+	var list []SessionInfo
+	err := s.Backend.Range(ctx, func(id string, data []byte, expires time.Time) bool {
+		var session Session
+		if json.Unmarshal(data, &session) != nil || session.User == nil {
+			return true
+		}
+		list = append(list, SessionInfo{
+			ID:      hashKey(id)[:16],
+			Login:   session.User.Login,
+			Created: session.Created,
+			Expires: expires,
+		})
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	return list, err
+}
+
+// RevokeUser deletes every session of login, returning how many there were
+func (s *ServerSessions) RevokeUser(ctx context.Context, login string) (int, error) {
+	var ids []string
+	err := s.Backend.Range(ctx, func(id string, data []byte, expires time.Time) bool {
+		var session Session
+		if json.Unmarshal(data, &session) == nil && session.User != nil && strings.EqualFold(session.User.Login, login) {
+			ids = append(ids, id)
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if err := s.Backend.Delete(ctx, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), nil
+}
+
+// AdminHandler serves the session admin API, mount it with http.StripPrefix:
+//
+//	GET    /              list live sessions
+//	DELETE /users/{login} revoke every session of login
+//
+// allow gates access like in Config.InfoHandler(), nil rejects everybody
+func (s *ServerSessions) AdminHandler(allow func(r *http.Request) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if allow == nil || !allow(r) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		path := strings.Trim(r.URL.Path, "/")
+		var body interface{}
+		var err error
+		switch {
+		case path == "" && r.Method == "GET":
+			body, err = s.Sessions(r.Context())
+		case strings.HasPrefix(path, "users/") && r.Method == "DELETE":
+			var n int
+			n, err = s.RevokeUser(r.Context(), strings.TrimPrefix(path, "users/"))
+			body = map[string]int{"revoked": n}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	})
+}
+
+// SetSession remembers user, allowed by decision, in c.Sessions for
+// SessionTTL. Use it after CheckDecision() in your own callback handler
+func (c *Config) SetSession(w http.ResponseWriter, r *http.Request, user *User, decision Decision) error {
+	_, err := c.saveSession(w, r, user, decision, nil, false)
+	return err
+}
+
+// saveSession is SetSession() optionally keeping token in the session,
+// pending ones wait for CompleteLink()
+func (c *Config) saveSession(w http.ResponseWriter, r *http.Request, user *User, decision Decision, token *oauth2.Token, pending bool) (*Session, error) {
+	if user == nil || !decision.Allowed {
+		return nil, ErrNotAllowed
+	}
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	s := &Session{ID: id, User: user, Decision: decision, Token: token, Created: now, Expires: now.Add(c.sessionTTL()), Pending: pending}
+	if c.Claims != nil {
+		claims, err := c.Claims(user, decision.Teams)
+		if err != nil {
+			return nil, err
+		}
+		s.User = &User{ID: user.ID, Login: user.Login}
+		s.Decision.Teams = nil
+		s.Claims = claims
+	}
+	return s, c.sessions().Save(w, r, s)
+}
+
+// GetSession returns the session of r, ErrNoSession if there isn't one
+func (c *Config) GetSession(r *http.Request) (*Session, error) {
+	return c.sessions().Load(r)
+}
+
+// Logout ends the session of r, publishing a logout Event to c.Events. With
+// RevokeOnLogout the github token of the session is revoked too
+func (c *Config) Logout(w http.ResponseWriter, r *http.Request) error {
+	s, loadErr := c.sessions().Load(r)
+	if err := c.sessions().Delete(w, r); err != nil {
+		return err
+	}
+	if loadErr == nil && c.Reverifier != nil {
+		c.Reverifier.Forget(s.ID)
+	}
+	if loadErr == nil && c.RevokeOnLogout && s.Token != nil {
+		if err := c.RevokeToken(r.Context(), s.Token); err != nil {
+			return err
+		}
+	}
+	if loadErr == nil && c.Events != nil {
+		e := NewEvent(EventLogout, c.Organization, s.User, nil)
+		if err := c.Events.Publish(r.Context(), e); err != nil && c.OnEventError != nil {
+			c.OnEventError(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// query parameters added by URLSigner
+const (
+	signedExpiresParam = "auth_expires"
+	signedSigParam     = "auth_sig"
+)
+
+// URLSigner mints signed, expiring urls granting access to one protected
+// path without signing in, e.g. sharing a dashboard snapshot with someone
+// outside the team for 24 hours
+type URLSigner struct {
+	// Keys are HMAC keys. The first one signs, all of them verify, so keys
+	// can be rotated by prepending a new one
+	Keys [][]byte
+}
+
+// errNoKeys is returned when a URLSigner, TokenIssuer, HeaderSigner,
+// CookieSessions or EncryptedTokens has nothing to sign or encrypt with
+var errNoKeys = errors.New("auth: no keys configured")
+
+// Sign returns rawurl, a path with optional query like /dash/42?range=1d,
+// with a signature valid for ttl. The signature covers the path and the
+// whole query, so neither can be changed
+func (s *URLSigner) Sign(rawurl string, ttl time.Duration) (string, error) {
+	if len(s.Keys) == 0 {
+		return "", errNoKeys
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Del(signedSigParam)
+	q.Set(signedExpiresParam, strconv.FormatInt(time.Now().Add(ttl).Unix(), 10))
+	q.Set(signedSigParam, sign(s.Keys[0], u.Path, q))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Verify reports whether r carries a valid, unexpired signature for its
+// path and query
+func (s *URLSigner) Verify(r *http.Request) bool {
+	q := r.URL.Query()
+	sig := q.Get(signedSigParam)
+	expires, err := strconv.ParseInt(q.Get(signedExpiresParam), 10, 64)
+	if sig == "" || err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	q.Del(signedSigParam)
+	for _, key := range s.Keys {
+		if hmac.Equal([]byte(sig), []byte(sign(key, r.URL.Path, q))) {
+			return true
+		}
+	}
+	return false
+}
+
+// Grant sends requests with a valid signature straight to next, and every
+// other request to protected, usually next wrapped by the auth middleware
+func (s *URLSigner) Grant(next, protected http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.Verify(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		protected.ServeHTTP(w, r)
+	})
+}
+
+// sign computes the signature of path and q, which must not include the
+// signature itself. q.Encode() sorts the keys so the result is stable
+func sign(key []byte, path string, q url.Values) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(path))
+	mac.Write([]byte{'?'})
+	mac.Write([]byte(q.Encode()))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
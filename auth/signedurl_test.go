@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestURLSigner(t *testing.T) {
+	signer := &URLSigner{Keys: [][]byte{[]byte("k1")}}
+	signed, err := signer.Sign("/dash/42?range=1d", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := signer.Sign("/dash/42", -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		signer *URLSigner
+		url    string
+		ok     bool
+	}{
+		{"signed", signer, signed, true},
+		{"rotated", &URLSigner{Keys: [][]byte{[]byte("k2"), []byte("k1")}}, signed, true},
+		{"wrong key", &URLSigner{Keys: [][]byte{[]byte("k2")}}, signed, false},
+		{"no keys", &URLSigner{}, signed, false},
+		{"unsigned", signer, "/dash/42?range=1d", false},
+		{"other path", signer, strings.Replace(signed, "/dash/42", "/dash/43", 1), false},
+		{"changed query", signer, strings.Replace(signed, "range=1d", "range=30d", 1), false},
+		{"added query", signer, signed + "&admin=1", false},
+		{"expired", signer, expired, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.url, nil)
+			if got := tt.signer.Verify(r); got != tt.ok {
+				t.Errorf("Verify(%s) = %v, want %v", tt.url, got, tt.ok)
+			}
+		})
+	}
+
+	if _, err := (&URLSigner{}).Sign("/dash", time.Hour); err != errNoKeys {
+		t.Errorf("Sign() without keys error = %v, want errNoKeys", err)
+	}
+}
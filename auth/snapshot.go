@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Snapshot is a decision remembered so it can be reused while github is
+// unreachable
+type Snapshot struct {
+	Decision Decision
+	User     *User
+	Taken    time.Time // when github last confirmed the decision
+}
+
+// SnapshotStore keeps the most recent Snapshot per key
+type SnapshotStore interface {
+	Load(key string) (Snapshot, bool)
+	Save(key string, s Snapshot)
+}
+
+// MemorySnapshots is an in memory SnapshotStore, safe for concurrent use
+type MemorySnapshots struct {
+	// MaxAge is how old snapshots get before Sweep() drops them, usually
+	// Config.MaxStaleness. They are kept forever if zero
+	MaxAge time.Duration
+
+	mu        sync.Mutex
+	snapshots map[string]Snapshot
+}
+
+// Load implements SnapshotStore
+func (m *MemorySnapshots) Load(key string) (Snapshot, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.snapshots[key]
+	return s, ok
+}
+
+// Save implements SnapshotStore
+func (m *MemorySnapshots) Save(key string, s Snapshot) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.snapshots == nil {
+		m.snapshots = make(map[string]Snapshot)
+	}
+	m.snapshots[key] = s
+}
+
+// Range calls f for every snapshot until it returns false
+func (m *MemorySnapshots) Range(f func(key string, s Snapshot) bool) {
+	m.mu.Lock()
+	snapshots := make(map[string]Snapshot, len(m.snapshots))
+	for k, s := range m.snapshots {
+		snapshots[k] = s
+	}
+	m.mu.Unlock()
+
+	for k, s := range snapshots {
+		if !f(k, s) {
+			return
+		}
+	}
+}
+
+// SnapshotRanger is a SnapshotStore which can list its snapshots, needed by
+// ExportSnapshots()
+type SnapshotRanger interface {
+	SnapshotStore
+	Range(f func(key string, s Snapshot) bool)
+}
+
+// snapshotFile is the layout written by ExportSnapshots()
+type snapshotFile struct {
+	Version   int                 `json:"version"`
+	Exported  time.Time           `json:"exported"`
+	Snapshots map[string]Snapshot `json:"snapshots"`
+}
+
+// ExportSnapshots writes every snapshot in store to w, so another instance
+// can be seeded with ImportSnapshots() for cold starts or air-gapped failover
+func ExportSnapshots(w io.Writer, store SnapshotRanger) error {
+	f := snapshotFile{Version: 1, Exported: time.Now(), Snapshots: make(map[string]Snapshot)}
+	store.Range(func(key string, s Snapshot) bool {
+		f.Snapshots[key] = s
+		return true
+	})
+	return json.NewEncoder(w).Encode(f)
+}
+
+// ImportSnapshots saves the snapshots written by ExportSnapshots() into
+// store. Snapshots keep the time they were taken, so MaxStaleness still
+// applies to them
+func ImportSnapshots(r io.Reader, store SnapshotStore) error {
+	var f snapshotFile
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return err
+	}
+	if f.Version != 1 {
+		return fmt.Errorf("auth: unsupported snapshot file version %d", f.Version)
+	}
+	for k, s := range f.Snapshots {
+		if old, ok := store.Load(k); ok && old.Taken.After(s.Taken) {
+			continue
+		}
+		store.Save(k, s)
+	}
+	return nil
+}
+
+// SaveSnapshots exports store to the file at path, replacing it atomically.
+// Handy as a Service flusher
+func SaveSnapshots(path string, store SnapshotRanger) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := ExportSnapshots(f, store); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadSnapshots imports the file written by SaveSnapshots() into store. A
+// missing file isn't an error, there's just nothing to load
+func LoadSnapshots(path string, store SnapshotStore) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return ImportSnapshots(f, store)
+}
+
+// tokenKey is the SnapshotStore key of a token. Tokens are hashed so the
+// store never holds usable credentials
+func tokenKey(token *oauth2.Token) string {
+	return "token:" + hashKey(token.AccessToken)
+}
+
+// hashKey hashes a credential so it can be used as a map or store key
+func hashKey(credential string) string {
+	sum := sha256.Sum256([]byte(credential))
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyWithFallback is Verify() remembering decisions in v.Snapshots, and
+// reusing them when github is unreachable and they are no older than
+// v.MaxStaleness. Reused decisions have Stale set
+func (v *Verifier) verifyWithFallback(ctx context.Context, client *http.Client, token *oauth2.Token) (Decision, *User, error) {
+	if v.Snapshots == nil {
+		return v.Verify(ctx, client)
+	}
+
+	key := tokenKey(token)
+	decision, user, err := v.Verify(ctx, client)
+	if err == nil {
+		if user != nil {
+			v.Snapshots.Save(key, Snapshot{Decision: decision, User: user, Taken: time.Now()})
+		}
+		return decision, user, nil
+	}
+	if !isOutage(err) {
+		return Decision{}, nil, err
+	}
+
+	s, ok := v.Snapshots.Load(key)
+	if !ok || time.Since(s.Taken) > v.MaxStaleness {
+		return Decision{}, nil, err
+	}
+	s.Decision.Stale = true
+	return s.Decision, s.User, nil
+}
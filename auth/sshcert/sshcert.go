@@ -0,0 +1,124 @@
+// Package sshcert signs short-lived SSH certificates for users who passed the
+// Organization/Team check, so bastion and SSH access can be gated on github
+// team membership through the same package
+package sshcert
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/RealGeeks/github-org-auth/auth"
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrDenied is returned by Issue for users the Decision didn't allow
+var ErrDenied = errors.New("sshcert: user is not allowed")
+
+// CASource gives the CA key certificates are signed with. It's called for
+// every certificate so keys can be rotated or kept in a KMS/HSM
+type CASource interface {
+	Signer(ctx context.Context) (ssh.Signer, error)
+}
+
+// StaticCA is a CASource always returning the same key
+type StaticCA struct {
+	Key ssh.Signer
+}
+
+// Signer implements CASource
+func (s StaticCA) Signer(ctx context.Context) (ssh.Signer, error) {
+	return s.Key, nil
+}
+
+// FileCA is a CASource reading a PEM private key from Path every time, so it
+// can be rotated on disk
+type FileCA struct {
+	Path       string
+	Passphrase []byte // optional
+}
+
+// Signer implements CASource
+func (f FileCA) Signer(ctx context.Context) (ssh.Signer, error) {
+	pem, err := os.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Passphrase) > 0 {
+		return ssh.ParsePrivateKeyWithPassphrase(pem, f.Passphrase)
+	}
+	return ssh.ParsePrivateKey(pem)
+}
+
+// Issuer signs user certificates
+type Issuer struct {
+	CA  CASource      // where the CA key comes from
+	TTL time.Duration // certificate lifetime, 8 hours if zero
+
+	// Principals returns the principals, the usernames the certificate is
+	// valid for. The github login if nil
+	Principals func(user *auth.User, decision auth.Decision) []string
+
+	// Extensions of the certificate, permit-pty and friends if nil
+	Extensions map[string]string
+}
+
+// defaultExtensions are what ssh-keygen grants by default
+var defaultExtensions = map[string]string{
+	"permit-X11-forwarding":   "",
+	"permit-agent-forwarding": "",
+	"permit-port-forwarding":  "",
+	"permit-pty":              "",
+	"permit-user-rc":          "",
+}
+
+// Issue signs a certificate for pub, the user's public key. decision must
+// allow the user, as returned by auth.Config.Verify and friends
+func (i *Issuer) Issue(ctx context.Context, user *auth.User, decision auth.Decision, pub ssh.PublicKey) (*ssh.Certificate, error) {
+	if user == nil || !decision.Allowed {
+		return nil, ErrDenied
+	}
+	ca, err := i.CA.Signer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var serial [8]byte
+	if _, err := rand.Read(serial[:]); err != nil {
+		return nil, err
+	}
+
+	principals := []string{user.Login}
+	if i.Principals != nil {
+		principals = i.Principals(user, decision)
+	}
+	extensions := i.Extensions
+	if extensions == nil {
+		extensions = defaultExtensions
+	}
+	ttl := i.TTL
+	if ttl == 0 {
+		ttl = 8 * time.Hour
+	}
+
+	// allow a little clock skew between us and the ssh servers
+
+	now := time.Now()
+	cert := &ssh.Certificate{
+		Key:             pub,
+		Serial:          binary.BigEndian.Uint64(serial[:]),
+		CertType:        ssh.UserCert,
+		KeyId:           "github:" + user.Login,
+		ValidPrincipals: principals,
+		ValidAfter:      uint64(now.Add(-time.Minute).Unix()),
+		ValidBefore:     uint64(now.Add(ttl).Unix()),
+		Permissions:     ssh.Permissions{Extensions: extensions},
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
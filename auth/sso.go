@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrSSOAuthorizationRequired is returned when Organization enforces SAML
+// SSO and the user didn't authorize the OAuth app for it yet, which github
+// would otherwise make look like they aren't a member. Send them to URL,
+// then through the login again. Handler() and Middleware() do it
+type ErrSSOAuthorizationRequired struct {
+	URL string // where github asks the user to authorize the app, may be empty
+}
+
+func (e *ErrSSOAuthorizationRequired) Error() string {
+	return "auth: github requires SAML SSO authorization for the organization"
+}
+
+// ssoRequired returns an ErrSSOAuthorizationRequired when resp is github
+// refusing an organization resource until the user authorizes SAML SSO.
+// It says so with a header like
+//
+//	X-GitHub-SSO: required; url=https://github.com/orgs/acme/sso?authorization_request=...
+func ssoRequired(resp *http.Response) error {
+	if resp.StatusCode != http.StatusForbidden {
+		return nil
+	}
+	header := resp.Header.Get("X-GitHub-SSO")
+	if !strings.HasPrefix(header, "required") {
+		return nil
+	}
+	e := &ErrSSOAuthorizationRequired{}
+	for _, part := range strings.Split(header, ";") {
+		if u := strings.TrimPrefix(strings.TrimSpace(part), "url="); u != strings.TrimSpace(part) {
+			e.URL = u
+		}
+	}
+	return e
+}
+
+// ReasonOf returns the Reason to show users for errors of Verify() which
+// are really denials they can do something about, like
+// ErrSSOAuthorizationRequired. ok is false for every other error
+func ReasonOf(err error) (reason Reason, ok bool) {
+	var sso *ErrSSOAuthorizationRequired
+	if errors.As(err, &sso) {
+		return SSORequired, true
+	}
+	return "", false
+}
+
+// ssoRedirect sends the user to authorize SAML SSO if err asks for it,
+// reporting whether it did
+func ssoRedirect(w http.ResponseWriter, r *http.Request, err error) bool {
+	var sso *ErrSSOAuthorizationRequired
+	if !errors.As(err, &sso) || sso.URL == "" || r.Method != "GET" {
+		return false
+	}
+	http.Redirect(w, r, sso.URL, http.StatusFound)
+	return true
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrStateMismatch is returned when the OAuth2 state coming back from github
+// wasn't issued by NewState(), expired, or doesn't belong to the browser
+var ErrStateMismatch = errors.New("auth: login state mismatch")
+
+// stateTTL is how long users have to complete the github login
+const stateTTL = 10 * time.Minute
+
+// processStateKey signs states when Config.StateKey isn't set
+var processStateKey struct {
+	once sync.Once
+	key  []byte
+}
+
+// NewState returns a random state signed with StateKey for AuthCodeURL(),
+// valid for 10 minutes. next, if a local path or a url on RedirectHosts, is
+// carried through the login to send the user back there, see ValidateState()
+//
+// The state alone doesn't prove the callback comes from the same browser,
+// keep it in a cookie and compare, like Handler() does
+func (c *Config) NewState(next string) (string, error) {
+	payload := make([]byte, 16+8, 16+8+len(next))
+	if _, err := rand.Read(payload[:16]); err != nil {
+		return "", err
+	}
+	binary.BigEndian.PutUint64(payload[16:], uint64(time.Now().Add(stateTTL).Unix()))
+	payload = append(payload, c.nextURL(next)...)
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + c.signState(encoded), nil
+}
+
+// ValidateState checks state was made by NewState() and hasn't expired,
+// returning the next path it carries
+func (c *Config) ValidateState(state string) (next string, err error) {
+	i := strings.LastIndex(state, ".")
+	if i < 0 || !hmac.Equal([]byte(state[i+1:]), []byte(c.signState(state[:i]))) {
+		return "", ErrStateMismatch
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(state[:i])
+	if err != nil || len(payload) < 16+8 {
+		return "", ErrStateMismatch
+	}
+	if time.Now().Unix() > int64(binary.BigEndian.Uint64(payload[16:24])) {
+		return "", ErrStateMismatch
+	}
+	return string(payload[24:]), nil
+}
+
+// signState returns the HMAC of encoded with the state key
+func (c *Config) signState(encoded string) string {
+	return c.signWith("state:", encoded)
+}
+
+// signWith returns the HMAC of encoded with the state key, prefix keeping
+// apart the values signed for different purposes
+func (c *Config) signWith(prefix, encoded string) string {
+	key := c.StateKey
+	if len(key) == 0 {
+		processStateKey.once.Do(func() {
+			processStateKey.key = make([]byte, 32)
+			rand.Read(processStateKey.key)
+		})
+		key = processStateKey.key
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(prefix + encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
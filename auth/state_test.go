@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestState(t *testing.T) {
+	c := &Config{StateKey: []byte("state key"), RedirectHosts: []string{"app.example.com"}}
+	tests := []struct {
+		name string
+		next string
+		want string
+	}{
+		{"empty", "", ""},
+		{"local path", "/dash?range=1d", "/dash?range=1d"},
+		{"redirect host", "https://app.example.com/x", "https://app.example.com/x"},
+		{"other host", "https://evil.example.com/x", ""},
+		{"protocol relative", "//evil.example.com/x", ""},
+		{"backslash", "/\\evil.example.com", ""},
+		{"userinfo", "https://user@app.example.com/x", ""},
+		{"javascript", "javascript:alert(1)", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, err := c.NewState(tt.next)
+			if err != nil {
+				t.Fatal(err)
+			}
+			next, err := c.ValidateState(state)
+			if err != nil {
+				t.Fatalf("ValidateState() error = %v", err)
+			}
+			if next != tt.want {
+				t.Errorf("next = %q, want %q", next, tt.want)
+			}
+		})
+	}
+}
+
+func TestStateRejected(t *testing.T) {
+	c := &Config{StateKey: []byte("state key")}
+	state, err := c.NewState("/dash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := strings.LastIndex(state, ".")
+	changed := []byte(state)
+	changed[0] ^= 1
+	payload := make([]byte, 16+8)
+	binary.BigEndian.PutUint64(payload[16:], uint64(time.Now().Add(-time.Minute).Unix()))
+	expired := base64.RawURLEncoding.EncodeToString(payload)
+	tests := []struct {
+		name   string
+		config *Config
+		state  string
+	}{
+		{"empty", c, ""},
+		{"no signature", c, state[:i]},
+		{"bad signature", c, state[:i] + ".AAAA"},
+		{"changed payload", c, string(changed)},
+		{"expired", c, expired + "." + c.signState(expired)},
+		{"other key", &Config{StateKey: []byte("other key")}, state},
+		{"short payload", c, "AAAA." + c.signState("AAAA")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.config.ValidateState(tt.state); err != ErrStateMismatch {
+				t.Errorf("ValidateState() error = %v, want ErrStateMismatch", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+// Package stepup adds an optional WebAuthn second factor after github
+// authentication, for tools needing stronger assurance than a github login.
+// Users register a security key or passkey once, then must present it
+// before the application issues them a session
+//
+// After auth.Config.Verify() allows a user, put them in the request context
+// with auth.WithUser() and send them to the Handler, e.g. mounted on
+// /webauthn/ with http.StripPrefix:
+//
+//	POST /register/begin  challenge to register a credential
+//	POST /register/finish store the new credential
+//	POST /login/begin     challenge to present a credential
+//	POST /login/finish    check it, then call OnVerified
+//
+// Registered() tells which ceremony the user needs. Only OnVerified should
+// issue the session
+package stepup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RealGeeks/github-org-auth/auth"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// ErrNoCeremony is returned when finishing a ceremony which wasn't begun,
+// or expired
+var ErrNoCeremony = errors.New("stepup: no pending webauthn ceremony")
+
+// CredentialStore keeps the WebAuthn credentials of every github login
+type CredentialStore interface {
+	Credentials(ctx context.Context, login string) ([]webauthn.Credential, error)
+
+	// PutCredential adds c, or replaces the credential with the same ID,
+	// e.g. to update its sign counter
+	PutCredential(ctx context.Context, login string, c webauthn.Credential) error
+}
+
+// MemoryCredentials is an in memory CredentialStore, for tests and single
+// instance deployments that don't mind re-registering after restarts
+type MemoryCredentials struct {
+	mu          sync.Mutex
+	credentials map[string][]webauthn.Credential
+}
+
+// Credentials implements CredentialStore
+func (m *MemoryCredentials) Credentials(ctx context.Context, login string) ([]webauthn.Credential, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]webauthn.Credential(nil), m.credentials[strings.ToLower(login)]...), nil
+}
+
+// PutCredential implements CredentialStore
+func (m *MemoryCredentials) PutCredential(ctx context.Context, login string, c webauthn.Credential) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.credentials == nil {
+		m.credentials = make(map[string][]webauthn.Credential)
+	}
+	login = strings.ToLower(login)
+	for i, existing := range m.credentials[login] {
+		if string(existing.ID) == string(c.ID) {
+			m.credentials[login][i] = c
+			return nil
+		}
+	}
+	m.credentials[login] = append(m.credentials[login], c)
+	return nil
+}
+
+// StepUp runs the WebAuthn ceremonies for github users
+type StepUp struct {
+	WebAuthn *webauthn.WebAuthn
+	Store    CredentialStore
+
+	// OnVerified is called once the user presented a registered
+	// credential, it should issue the session and respond
+	OnVerified func(w http.ResponseWriter, r *http.Request, user *auth.User)
+
+	mu         sync.Mutex
+	ceremonies map[string]*webauthn.SessionData // by lowercased login
+}
+
+// New returns a StepUp for the relying party described by cfg
+func New(cfg *webauthn.Config, store CredentialStore, onVerified func(w http.ResponseWriter, r *http.Request, user *auth.User)) (*StepUp, error) {
+	w, err := webauthn.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &StepUp{WebAuthn: w, Store: store, OnVerified: onVerified}, nil
+}
+
+// Registered reports whether user already has a credential, otherwise they
+// need to register one first
+func (s *StepUp) Registered(ctx context.Context, user *auth.User) (bool, error) {
+	credentials, err := s.Store.Credentials(ctx, user.Login)
+	return len(credentials) > 0, err
+}
+
+// webauthnUser adapts a github user to webauthn.User
+type webauthnUser struct {
+	user        *auth.User
+	credentials []webauthn.Credential
+}
+
+// WebAuthnID is derived from the login, it only needs to be stable and
+// opaque
+func (u *webauthnUser) WebAuthnID() []byte {
+	id := sha256.Sum256([]byte(strings.ToLower(u.user.Login)))
+	return id[:]
+}
+
+func (u *webauthnUser) WebAuthnName() string { return u.user.Login }
+
+func (u *webauthnUser) WebAuthnDisplayName() string {
+	if u.user.Name != "" {
+		return u.user.Name
+	}
+	return u.user.Login
+}
+
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+
+// Handler serves the WebAuthn ceremonies for the auth.User in the request
+// context
+func (s *StepUp) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		user, ok := auth.UserFromContext(r.Context())
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		credentials, err := s.Store.Credentials(r.Context(), user.Login)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		u := &webauthnUser{user: user, credentials: credentials}
+
+		switch strings.Trim(r.URL.Path, "/") {
+		case "register/begin":
+			options, session, err := s.WebAuthn.BeginRegistration(u)
+			s.begin(w, user, options, session, err)
+		case "register/finish":
+			session, err := s.finish(user)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			c, err := s.WebAuthn.FinishRegistration(u, *session, r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := s.Store.PutCredential(r.Context(), user.Login, *c); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"registered":true}`))
+		case "login/begin":
+			if len(credentials) == 0 {
+				http.Error(w, "stepup: no registered credential", http.StatusConflict)
+				return
+			}
+			options, session, err := s.WebAuthn.BeginLogin(u)
+			s.begin(w, user, options, session, err)
+		case "login/finish":
+			session, err := s.finish(user)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			c, err := s.WebAuthn.FinishLogin(u, *session, r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			// keep the updated sign counter, so cloned authenticators
+			// can be detected
+
+			if err := s.Store.PutCredential(r.Context(), user.Login, *c); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			s.OnVerified(w, r, user)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// begin remembers the ceremony of user and sends its options to the browser
+func (s *StepUp) begin(w http.ResponseWriter, user *auth.User, options interface{}, session *webauthn.SessionData, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	if s.ceremonies == nil {
+		s.ceremonies = make(map[string]*webauthn.SessionData)
+	}
+	now := time.Now()
+	for login, c := range s.ceremonies {
+		if !c.Expires.IsZero() && now.After(c.Expires) {
+			delete(s.ceremonies, login)
+		}
+	}
+	s.ceremonies[strings.ToLower(user.Login)] = session
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(options)
+}
+
+// finish takes the pending ceremony of user, each can only be finished once
+func (s *StepUp) finish(user *auth.User) (*webauthn.SessionData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	login := strings.ToLower(user.Login)
+	session, ok := s.ceremonies[login]
+	delete(s.ceremonies, login)
+	if !ok || (!session.Expires.IsZero() && time.Now().After(session.Expires)) {
+		return nil, ErrNoCeremony
+	}
+	return session, nil
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"time"
+)
+
+// Sweeper is a store which can purge its expired entries. The in memory
+// stores implement it, other implementations should when their storage
+// doesn't expire entries by itself, e.g. SQL
+type Sweeper interface {
+	Sweep(ctx context.Context) (int, error) // returns the entries purged
+}
+
+// GC periodically purges expired sessions, cache entries and other records
+// from Sweepers, so long-running deployments don't grow unbounded storage.
+// Run it with Service.Go()
+type GC struct {
+	Sweepers []Sweeper
+
+	// Interval between sweeps, 10 minutes if zero
+	Interval time.Duration
+
+	// OnError, if set, is called when a sweeper fails. The others still run
+	OnError func(err error)
+}
+
+// Run sweeps every Interval until ctx is done
+func (g *GC) Run(ctx context.Context) {
+	interval := g.Interval
+	if interval == 0 {
+		interval = 10 * time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			g.Sweep(ctx)
+		}
+	}
+}
+
+// Sweep runs every sweeper once, returning how many entries were purged
+func (g *GC) Sweep(ctx context.Context) int {
+	purged := 0
+	for _, s := range g.Sweepers {
+		n, err := s.Sweep(ctx)
+		purged += n
+		if err != nil && g.OnError != nil {
+			g.OnError(err)
+		}
+	}
+	return purged
+}
+
+// Sweep implements Sweeper
+func (m *MemoryBackend) Sweep(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	purged := 0
+	for id, s := range m.sessions {
+		if now.After(s.expires) {
+			delete(m.sessions, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// Sweep implements Sweeper, dropping snapshots older than MaxAge. Nothing
+// is dropped when MaxAge is zero
+func (m *MemorySnapshots) Sweep(ctx context.Context) (int, error) {
+	if m.MaxAge == 0 {
+		return 0, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	purged := 0
+	for k, s := range m.snapshots {
+		if time.Since(s.Taken) > m.MaxAge {
+			delete(m.snapshots, k)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// Sweep implements Sweeper
+func (m *MemoryCounter) Sweep(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	before := len(m.windows)
+	m.sweep(time.Now())
+	return before - len(m.windows), nil
+}
+
+// Sweep implements Sweeper, dropping expired avatars
+func (p *AvatarProxy) Sweep(ctx context.Context) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	purged := 0
+	for k, a := range p.cache {
+		if now.After(a.expires) {
+			delete(p.cache, k)
+			purged++
+		}
+	}
+	return purged, nil
+}
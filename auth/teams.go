@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/oauth2"
+)
+
+// Team describes a github team the user belongs to
+type Team struct {
+	ID           int64  // github team id, never changes
+	Name         string // team display name
+	Slug         string // team name as used in urls
+	Organization string // login of the organization the team belongs to
+	Role         string // user role inside the team: member or maintainer
+	Parent       string // slug of the parent team, empty for top level teams
+
+	// Inherited is set for ancestors of the user teams, added with
+	// Config.IncludeChildTeams
+	Inherited bool
+
+	// IdPGroups are the identity provider groups linked to the team by
+	// team synchronization. Only filled in for the matched team, when
+	// Config.IdPGroups is set
+	IdPGroups []IdPGroup
+}
+
+// teamMembership is the response of /orgs/{org}/teams/{team_slug}/memberships/{username}
+type teamMembership struct {
+	State string `json:"state"` // active or pending
+	Role  string `json:"role"`  // member or maintainer
+}
+
+// Teams returns all teams, from every organization, the user owning token
+// belongs to so applications can do their own finer-grained mapping beyond
+// the configured Team
+//
+// Finding out the user Role requires one extra request per team
+func (c *Config) Teams(ctx context.Context, token *oauth2.Token) ([]Team, error) {
+	return teamsWithRoles(ctx, c.userClient(ctx, token))
+}
+
+// Teams is Config.Teams() for tokens obtained somewhere else
+func (v *Verifier) Teams(ctx context.Context, token *oauth2.Token) ([]Team, error) {
+	return teamsWithRoles(ctx, oauth2.NewClient(withHTTPClient(ctx, v.httpClient()), oauth2.StaticTokenSource(token)))
+}
+
+// teamsWithRoles lists the user teams and fills in their role in each one
+func teamsWithRoles(ctx context.Context, client *http.Client) ([]Team, error) {
+	user, _, err := fetchUser(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	teams, err := listTeams(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	for i := range teams {
+		teams[i].Role, err = teamRole(ctx, client, teams[i], user.Login)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return teams, nil
+}
+
+// listTeams gets a list of all teams the current user belongs to, going
+// through every page. Role is left empty since github doesn't include it
+// in the listing
+func listTeams(ctx context.Context, client *http.Client) ([]Team, error) {
+	var teams []Team
+	err := getPages(ctx, client, "https://api.github.com/user/teams?per_page=100", func(page json.RawMessage) error {
+		var raw []team
+		if err := json.Unmarshal(page, &raw); err != nil {
+			return err
+		}
+		for _, t := range raw {
+			teams = append(teams, t.team(""))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return teams, nil
+}
+
+// teamRole asks github which role login has inside t
+func teamRole(ctx context.Context, client *http.Client, t Team, login string) (string, error) {
+	var membership teamMembership
+	u := "https://api.github.com/orgs/" + url.PathEscape(t.Organization) + "/teams/" + url.PathEscape(t.Slug) + "/memberships/" + url.PathEscape(login)
+	resp, err := get(ctx, client, u, &membership)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", statusError(resp)
+	}
+	return membership.Role, nil
+}
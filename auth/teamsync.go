@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// IdPGroup is an identity provider group linked to a github team through
+// team synchronization
+type IdPGroup struct {
+	ID          string `json:"group_id"`
+	Name        string `json:"group_name"`
+	Description string `json:"group_description"`
+}
+
+// idpGroups fetches the IdP groups linked to t. github only shows them to
+// organization owners and team maintainers, so missing permissions or team
+// sync being off just mean no groups
+func idpGroups(ctx context.Context, client *http.Client, t Team) ([]IdPGroup, error) {
+	var mappings struct {
+		Groups []IdPGroup `json:"groups"`
+	}
+	u := "https://api.github.com/orgs/" + url.PathEscape(t.Organization) + "/teams/" + url.PathEscape(t.Slug) + "/team-sync/group-mappings"
+	resp, err := get(ctx, client, u, &mappings)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return mappings.Groups, nil
+	case rateLimited(resp):
+		return nil, statusError(resp)
+	case resp.StatusCode == http.StatusForbidden, resp.StatusCode == http.StatusNotFound:
+		return nil, nil
+	}
+	return nil, statusError(resp)
+}
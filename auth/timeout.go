@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrTimeout is returned, possibly wrapped in a *url.Error, when github
+// doesn't answer within Config.Timeout or the context deadline
+var ErrTimeout = errors.New("auth: github request timed out")
+
+// timeout returns c.Timeout, 10 seconds if zero and none if negative
+func (c *Config) timeout() time.Duration {
+	if c.Timeout == 0 {
+		return 10 * time.Second
+	}
+	return c.Timeout
+}
+
+// exchange trades code for a token within c.timeout(). oauth2 doesn't wrap
+// transport errors, so deadlines are told apart with the context
+func (c *Config) exchange(ctx context.Context, code string, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	start := time.Now()
+	if timeout := c.timeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	token, err := c.oauth2Config().Exchange(withHTTPClient(ctx, c.httpClient()), code, opts...)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		err = ErrTimeout
+	}
+	c.observeExchange(start, err)
+	return token, err
+}
+
+// timeoutClient returns a copy of base, http.DefaultClient if nil, giving
+// each request timeout, none if negative, and reporting deadlines as
+// ErrTimeout
+func timeoutClient(base *http.Client, timeout time.Duration) *http.Client {
+	if base == nil {
+		base = http.DefaultClient
+	}
+	c := *base
+	c.Transport = &timeoutTransport{base: base.Transport, timeout: timeout}
+	return &c
+}
+
+// timeoutTransport bounds each request, including reading its body
+type timeoutTransport struct {
+	base    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *timeoutTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ctx, cancel := r.Context(), context.CancelFunc(func() {})
+	if t.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+	}
+	resp, err := base.RoundTrip(r.WithContext(ctx))
+	if err != nil {
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, ErrTimeout
+		}
+		return nil, err
+	}
+	resp.Body = &timeoutBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// timeoutBody releases the request context when closed
+type timeoutBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *timeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = ErrTimeout
+	}
+	return n, err
+}
+
+func (b *timeoutBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrTokenRejected is returned by TokenIssuer.Verify for malformed, forged
+// or expired tokens
+var ErrTokenRejected = errors.New("auth: invalid or expired token")
+
+// ErrNotAllowed is returned when asked to issue credentials for a user the
+// Decision didn't allow
+var ErrNotAllowed = errors.New("auth: user is not allowed")
+
+// TokenIssuer mints short-lived signed tokens (HS256 or RS256 JWTs)
+// carrying the user Claims, usable against protected services by SPAs,
+// scripts and cron jobs. Issue one after CheckDecision() allows the user
+type TokenIssuer struct {
+	// Keys are HMAC keys. The first one signs, all of them verify, so keys
+	// can be rotated by prepending a new one
+	Keys [][]byte
+
+	// RSAKey, when set, signs with RS256 instead of Keys. RSAPublicKeys
+	// verify RS256 tokens besides RSAKey, so services holding only the
+	// public keys can verify, and keys can be rotated
+	RSAKey        *rsa.PrivateKey
+	RSAPublicKeys []*rsa.PublicKey
+
+	TTL    time.Duration // token lifetime, 1 hour if zero
+	Issuer string        // optional iss claim, checked by Verify when set
+
+	// RateLimit optionally limits Middleware() as EndpointValidate
+	RateLimit *RateLimiter
+
+	// Claims, when set, builds the token payload instead of NewClaims(),
+	// the registered claims are added to it. Read it with VerifyPayload()
+	Claims ClaimsFunc
+}
+
+// jwtHeader and rsaHeader are the only headers TokenIssuer produces and
+// accepts, so the alg can't be picked by whoever made the token
+var (
+	jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	rsaHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+)
+
+// Issue returns a token for an allowed user
+func (t *TokenIssuer) Issue(user *User, decision Decision) (string, error) {
+	if user == nil || !decision.Allowed {
+		return "", ErrNotAllowed
+	}
+	if len(t.Keys) == 0 && t.RSAKey == nil {
+		return "", errNoKeys
+	}
+
+	ttl := t.TTL
+	if ttl == 0 {
+		ttl = time.Hour
+	}
+	payload, err := t.payload(user, decision, ttl)
+	if err != nil {
+		return "", err
+	}
+	if t.RSAKey != nil {
+		signed := rsaHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+		digest := sha256.Sum256([]byte(signed))
+		sig, err := rsa.SignPKCS1v15(rand.Reader, t.RSAKey, crypto.SHA256, digest[:])
+		if err != nil {
+			return "", err
+		}
+		return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+	}
+	signed := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + jwtSign(t.Keys[0], signed), nil
+}
+
+// payload marshals the claims of a token lasting ttl
+func (t *TokenIssuer) payload(user *User, decision Decision, ttl time.Duration) ([]byte, error) {
+	now := time.Now()
+	if t.Claims == nil {
+		claims := NewClaims(user, decision)
+		claims.Issuer = t.Issuer
+		claims.IssuedAt = now.Unix()
+		claims.ExpiresAt = now.Add(ttl).Unix()
+		return json.Marshal(claims)
+	}
+
+	custom, err := t.Claims(user, decision.Teams)
+	if err != nil {
+		return nil, err
+	}
+	claims := make(map[string]interface{}, len(custom)+3)
+	for k, v := range custom {
+		claims[k] = v
+	}
+	if t.Issuer != "" {
+		claims["iss"] = t.Issuer
+	}
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(ttl).Unix()
+	return json.Marshal(claims)
+}
+
+// Verify checks token was issued by us and is still valid, returning its
+// Claims
+func (t *TokenIssuer) Verify(token string) (*Claims, error) {
+	payload, err := t.verify(token)
+	if err != nil {
+		return nil, err
+	}
+	claims := new(Claims)
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, ErrTokenRejected
+	}
+	return claims, nil
+}
+
+// VerifyPayload is Verify() returning the whole payload, for tokens built
+// by a ClaimsFunc
+func (t *TokenIssuer) VerifyPayload(token string) (map[string]interface{}, error) {
+	payload, err := t.verify(token)
+	if err != nil {
+		return nil, err
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrTokenRejected
+	}
+	return claims, nil
+}
+
+// verify checks token, returning its payload
+func (t *TokenIssuer) verify(token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenRejected
+	}
+	signed := parts[0] + "." + parts[1]
+	valid := false
+	switch parts[0] {
+	case jwtHeader:
+		for _, key := range t.Keys {
+			valid = valid || hmac.Equal([]byte(parts[2]), []byte(jwtSign(key, signed)))
+		}
+	case rsaHeader:
+		valid = t.verifyRSA(signed, parts[2])
+	}
+	if !valid {
+		return nil, ErrTokenRejected
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrTokenRejected
+	}
+	var registered struct {
+		Issuer    string `json:"iss"`
+		ExpiresAt int64  `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &registered); err != nil {
+		return nil, ErrTokenRejected
+	}
+	if time.Now().Unix() >= registered.ExpiresAt || (t.Issuer != "" && registered.Issuer != t.Issuer) {
+		return nil, ErrTokenRejected
+	}
+	return payload, nil
+}
+
+// jwtSign is the HS256 signature of signed
+func jwtSign(key []byte, signed string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signed))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyRSA checks the RS256 signature sig of signed
+func (t *TokenIssuer) verifyRSA(signed, sig string) bool {
+	raw, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	keys := t.RSAPublicKeys
+	if t.RSAKey != nil {
+		keys = append([]*rsa.PublicKey{&t.RSAKey.PublicKey}, keys...)
+	}
+	digest := sha256.Sum256([]byte(signed))
+	for _, key := range keys {
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], raw) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware only lets requests with a valid bearer token through to next,
+// storing its Claims in the request context, see ClaimsFromContext().
+// Downstream services use it to trust tokens without calling github
+func (t *TokenIssuer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if t.RateLimit.limit(w, r, EndpointValidate) {
+			return
+		}
+		claims, err := t.Verify(bearer(r))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), claims)))
+	})
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenIssuer(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &User{ID: 1, Login: "alice"}
+	decision := Decision{Allowed: true, Team: &Team{Organization: "acme", Slug: "eng"}, Roles: []string{"admin"}}
+
+	tests := []struct {
+		name    string
+		issuer  *TokenIssuer
+		checker *TokenIssuer
+		ok      bool
+	}{
+		{"hs256", &TokenIssuer{Keys: [][]byte{[]byte("k1")}}, &TokenIssuer{Keys: [][]byte{[]byte("k1")}}, true},
+		{"hs256 rotated", &TokenIssuer{Keys: [][]byte{[]byte("k1")}}, &TokenIssuer{Keys: [][]byte{[]byte("k2"), []byte("k1")}}, true},
+		{"hs256 wrong key", &TokenIssuer{Keys: [][]byte{[]byte("k1")}}, &TokenIssuer{Keys: [][]byte{[]byte("k2")}}, false},
+		{"hs256 expired", &TokenIssuer{Keys: [][]byte{[]byte("k1")}, TTL: -time.Minute}, &TokenIssuer{Keys: [][]byte{[]byte("k1")}}, false},
+		{"issuer", &TokenIssuer{Keys: [][]byte{[]byte("k1")}, Issuer: "a"}, &TokenIssuer{Keys: [][]byte{[]byte("k1")}, Issuer: "a"}, true},
+		{"issuer mismatch", &TokenIssuer{Keys: [][]byte{[]byte("k1")}, Issuer: "a"}, &TokenIssuer{Keys: [][]byte{[]byte("k1")}, Issuer: "b"}, false},
+		{"rs256", &TokenIssuer{RSAKey: key}, &TokenIssuer{RSAKey: key}, true},
+		{"rs256 public key", &TokenIssuer{RSAKey: key}, &TokenIssuer{RSAPublicKeys: []*rsa.PublicKey{&other.PublicKey, &key.PublicKey}}, true},
+		{"rs256 wrong key", &TokenIssuer{RSAKey: key}, &TokenIssuer{RSAPublicKeys: []*rsa.PublicKey{&other.PublicKey}}, false},
+		{"rs256 to hs256", &TokenIssuer{RSAKey: key}, &TokenIssuer{Keys: [][]byte{[]byte("k1")}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := tt.issuer.Issue(user, decision)
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := tt.checker.Verify(token)
+			if !tt.ok {
+				if err != ErrTokenRejected {
+					t.Errorf("Verify() error = %v, want ErrTokenRejected", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if claims.Login != "alice" || len(claims.Roles) != 1 || claims.Roles[0] != "admin" {
+				t.Errorf("Verify() = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestTokenIssuerRejects(t *testing.T) {
+	issuer := &TokenIssuer{Keys: [][]byte{[]byte("k1")}}
+	token, err := issuer.Issue(&User{Login: "alice"}, Decision{Allowed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"login":"mallory","exp":9999999999}`))
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"empty", ""},
+		{"two parts", parts[0] + "." + parts[1]},
+		{"alg none", none + "." + parts[1] + "."},
+		{"changed payload", parts[0] + "." + forged + "." + parts[2]},
+		{"changed signature", parts[0] + "." + parts[1] + ".AAAA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := issuer.Verify(tt.token); err != ErrTokenRejected {
+				t.Errorf("Verify() error = %v, want ErrTokenRejected", err)
+			}
+		})
+	}
+
+	if _, err := issuer.Issue(&User{Login: "alice"}, Decision{Reason: NotInTeam}); err != ErrNotAllowed {
+		t.Errorf("Issue() of a denied user error = %v, want ErrNotAllowed", err)
+	}
+	if _, err := (&TokenIssuer{}).Issue(&User{Login: "alice"}, Decision{Allowed: true}); err != errNoKeys {
+		t.Errorf("Issue() without keys error = %v, want errNoKeys", err)
+	}
+}
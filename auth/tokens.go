@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// sealedPrefix marks the tokens sealed by EncryptedTokens
+const sealedPrefix = "sealed:"
+
+// EncryptedTokens is a TokenStore encrypting tokens (AES-GCM) before
+// handing them to Store, which only ever sees tokens whose AccessToken is
+// the sealed original. Each token is bound to its login, so they can't be
+// swapped between users
+type EncryptedTokens struct {
+	Store TokenStore
+
+	// Keys are secrets of any length. The first one encrypts, all of them
+	// decrypt, so keys can be rotated by prepending a new one. KeyFunc,
+	// when set, is asked for them instead, e.g. to get data keys from a KMS
+	Keys    [][]byte
+	KeyFunc func(ctx context.Context) ([][]byte, error)
+}
+
+// keys returns the encryption keys
+func (e *EncryptedTokens) keys(ctx context.Context) ([][]byte, error) {
+	keys := e.Keys
+	if e.KeyFunc != nil {
+		var err error
+		if keys, err = e.KeyFunc(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errNoKeys
+	}
+	return keys, nil
+}
+
+// Load implements TokenStore
+func (e *EncryptedTokens) Load(ctx context.Context, login string) (*oauth2.Token, error) {
+	stored, err := e.Store.Load(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := e.keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(stored.AccessToken, sealedPrefix))
+	if err != nil || !strings.HasPrefix(stored.AccessToken, sealedPrefix) {
+		return nil, ErrNoToken
+	}
+	for _, key := range keys {
+		aead, err := sessionCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if len(sealed) < aead.NonceSize() {
+			return nil, ErrNoToken
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		data, err := aead.Open(nil, nonce, ciphertext, []byte("token:"+login))
+		if err != nil {
+			continue
+		}
+		token := new(oauth2.Token)
+		if err := json.Unmarshal(data, token); err != nil {
+			return nil, ErrNoToken
+		}
+		return token, nil
+	}
+	return nil, ErrNoToken
+}
+
+// Save implements TokenStore
+func (e *EncryptedTokens) Save(ctx context.Context, login string, token *oauth2.Token) error {
+	keys, err := e.keys(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	aead, err := sessionCipher(keys[0])
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := aead.Seal(nonce, nonce, data, []byte("token:"+login))
+	return e.Store.Save(ctx, login, &oauth2.Token{AccessToken: sealedPrefix + base64.RawURLEncoding.EncodeToString(sealed)})
+}
+
+// SQLTokens is a TokenStore keeping tokens as json in a table like
+//
+//	CREATE TABLE github_tokens (login TEXT PRIMARY KEY, token TEXT NOT NULL)
+//
+// Wrap it in EncryptedTokens, the tokens are stored as they are
+type SQLTokens struct {
+	DB     *sql.DB
+	Table  string // github_tokens if empty
+	Dollar bool   // use $1 placeholders, for PostgreSQL, instead of ?
+}
+
+// query returns q for the table and placeholder style of s
+func (s *SQLTokens) query(q string) string {
+	table := s.Table
+	if table == "" {
+		table = "github_tokens"
+	}
+	q = strings.ReplaceAll(q, "TABLE", table)
+	if s.Dollar {
+		for n := 1; strings.Contains(q, "?"); n++ {
+			q = strings.Replace(q, "?", "$"+strconv.Itoa(n), 1)
+		}
+	}
+	return q
+}
+
+// Load implements TokenStore
+func (s *SQLTokens) Load(ctx context.Context, login string) (*oauth2.Token, error) {
+	var data string
+	err := s.DB.QueryRowContext(ctx, s.query("SELECT token FROM TABLE WHERE login = ?"), login).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	token := new(oauth2.Token)
+	if err := json.Unmarshal([]byte(data), token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// Save implements TokenStore. It updates the row of login, inserting it if
+// missing, with plain UPDATE and INSERT since upserts differ per database.
+// MySQL counts rows left unchanged as not affected, and a concurrent Save
+// can insert first, so a failed INSERT is followed by another UPDATE and
+// only returned when the row still doesn't exist
+func (s *SQLTokens) Save(ctx context.Context, login string, token *oauth2.Token) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	res, err := s.DB.ExecContext(ctx, s.query("UPDATE TABLE SET token = ? WHERE login = ?"), string(data), login)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		return nil
+	}
+	_, insertErr := s.DB.ExecContext(ctx, s.query("INSERT INTO TABLE (login, token) VALUES (?, ?)"), login, string(data))
+	if insertErr == nil {
+		return nil
+	}
+	if _, err := s.DB.ExecContext(ctx, s.query("UPDATE TABLE SET token = ? WHERE login = ?"), string(data), login); err != nil {
+		return err
+	}
+	var one int
+	err = s.DB.QueryRowContext(ctx, s.query("SELECT 1 FROM TABLE WHERE login = ?"), login).Scan(&one)
+	if err == sql.ErrNoRows {
+		return insertErr
+	}
+	return err
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestEncryptedTokens(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		loading [][]byte
+		login   string
+		err     error
+	}{
+		{"same key", [][]byte{[]byte("k1")}, "alice", nil},
+		{"rotated", [][]byte{[]byte("k2"), []byte("k1")}, "alice", nil},
+		{"wrong key", [][]byte{[]byte("k2")}, "alice", ErrNoToken},
+		{"no keys", nil, "alice", errNoKeys},
+		{"other login", [][]byte{[]byte("k1")}, "mallory", ErrNoToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &MemoryTokens{}
+			saver := &EncryptedTokens{Store: store, Keys: [][]byte{[]byte("k1")}}
+			if err := saver.Save(ctx, "alice", &oauth2.Token{AccessToken: "gho_secret"}); err != nil {
+				t.Fatal(err)
+			}
+			stored, _ := store.Load(ctx, "alice")
+			if strings.Contains(stored.AccessToken, "gho_secret") || !strings.HasPrefix(stored.AccessToken, sealedPrefix) {
+				t.Fatalf("stored token %q isn't sealed", stored.AccessToken)
+			}
+
+			// a token moved to another login doesn't open there
+
+			store.Save(ctx, "mallory", stored)
+
+			loader := &EncryptedTokens{Store: store, Keys: tt.loading}
+			token, err := loader.Load(ctx, tt.login)
+			if err != tt.err {
+				t.Fatalf("Load() error = %v, want %v", err, tt.err)
+			}
+			if err == nil && token.AccessToken != "gho_secret" {
+				t.Errorf("Load() = %q, want gho_secret", token.AccessToken)
+			}
+		})
+	}
+}
+
+func TestEncryptedTokensUnsealed(t *testing.T) {
+	ctx := context.Background()
+	store := &MemoryTokens{}
+	store.Save(ctx, "alice", &oauth2.Token{AccessToken: "gho_plain"})
+	e := &EncryptedTokens{Store: store, Keys: [][]byte{[]byte("k1")}}
+	if _, err := e.Load(ctx, "alice"); err != ErrNoToken {
+		t.Errorf("Load() of a plain token error = %v, want ErrNoToken", err)
+	}
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrTwoFactorUnknown is returned with RequireTwoFactor when neither github
+// nor ServerToken tell whether the user has two-factor authentication
+var ErrTwoFactorUnknown = errors.New("auth: can't tell whether the user has two-factor authentication")
+
+// twoFactor denies allowed users without two-factor authentication when
+// RequireTwoFactor is set. The /user response only says so for some
+// tokens, otherwise ServerToken, of an Organization owner, lists the
+// members who have it disabled, see twoFactorList
+func (c *Config) twoFactor(ctx context.Context, user *User, decision Decision) (Decision, error) {
+	if !c.RequireTwoFactor || !decision.Allowed || decision.Stale || user == nil {
+		return decision, nil
+	}
+	denied := Decision{Reason: TwoFactorDisabled, Teams: decision.Teams, OrgRole: decision.OrgRole}
+	if user.TwoFactorEnabled != nil {
+		if !*user.TwoFactorEnabled {
+			return denied, nil
+		}
+		return decision, nil
+	}
+	if c.ServerToken == nil {
+		return Decision{}, ErrTwoFactorUnknown
+	}
+
+	disabled, err := c.twoFactorOff.get(func() ([]string, error) {
+		client := oauth2.NewClient(withHTTPClient(ctx, c.httpClient()), c.ServerToken)
+		return listMembers(ctx, client, "https://api.github.com/orgs/"+url.PathEscape(c.Organization)+"/members?filter=2fa_disabled&per_page=100")
+	})
+	if err != nil {
+		return Decision{}, err
+	}
+	if disabled[strings.ToLower(user.Login)] {
+		return denied, nil
+	}
+	return decision, nil
+}
+
+// twoFactorList caches the lowercase logins of the members with two-factor
+// authentication disabled for a minute, so logins don't list them every
+// time. Members turning it off are caught on the next refresh
+type twoFactorList struct {
+	mu      sync.Mutex
+	logins  map[string]bool
+	fetched time.Time
+}
+
+// get returns the cached logins, calling list when they are missing or
+// too old
+func (l *twoFactorList) get(list func() ([]string, error)) (map[string]bool, error) {
+	l.mu.Lock()
+	logins, fetched := l.logins, l.fetched
+	l.mu.Unlock()
+	if logins != nil && time.Since(fetched) < time.Minute {
+		return logins, nil
+	}
+
+	members, err := list()
+	if err != nil {
+		return nil, err
+	}
+	logins = make(map[string]bool, len(members))
+	for _, login := range members {
+		logins[strings.ToLower(login)] = true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logins, l.fetched = logins, time.Now()
+	return logins, nil
+}
@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"embed"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"sync"
+)
+
+// uiFiles are the default templates and assets of UI
+//
+//go:embed ui
+var uiFiles embed.FS
+
+// Theme is the branding of the UI pages
+type Theme struct {
+	Title           string        // page title, "Sign in" if empty
+	LogoURL         string        // optional logo shown above every page
+	PrimaryColor    string        // buttons and links, a CSS color
+	BackgroundColor string        // page background, a CSS color
+	Footer          template.HTML // optional footer, trusted HTML
+}
+
+// UI renders the login, denied and interstitial pages. Templates from
+// Overrides replace the default ones with the same name: layout.html,
+// login.html, denied.html, interstitial.html and style.css
+type UI struct {
+	Theme     Theme    // branding
+	Catalog   *Catalog // denial messages, DefaultCatalog() if nil
+	Overrides fs.FS    // optional per deployment templates and assets
+	AssetsURL string   // where AssetsHandler() is mounted, /auth/assets if empty
+
+	once  sync.Once
+	pages map[string]*template.Template
+	err   error
+}
+
+// pageView is the data every UI template gets
+type pageView struct {
+	PageData
+	Theme     Theme
+	AssetsURL string
+	URL       string // the page main link: sign in, try again or continue
+}
+
+// RenderLogin renders the "Sign in with GitHub" page linking to loginURL
+func (u *UI) RenderLogin(w http.ResponseWriter, r *http.Request, loginURL string, data PageData) {
+	data.Lang = u.catalog().language(r.Header.Get("Accept-Language"))
+	u.render(w, "login.html", http.StatusOK, pageView{PageData: data, URL: loginURL})
+}
+
+// RenderDenied renders the denial page for reason. retryURL is optional
+func (u *UI) RenderDenied(w http.ResponseWriter, r *http.Request, reason Reason, retryURL string, data PageData) {
+	data, err := u.catalog().PageData(r, reason, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	u.render(w, "denied.html", http.StatusForbidden, pageView{PageData: data, URL: retryURL})
+}
+
+// RenderInterstitial renders a page showing message with a link to
+// continueURL, e.g. before sending the user to accept an invitation
+func (u *UI) RenderInterstitial(w http.ResponseWriter, r *http.Request, message, continueURL string, data PageData) {
+	data.Lang = u.catalog().language(r.Header.Get("Accept-Language"))
+	data.Message = message
+	u.render(w, "interstitial.html", http.StatusOK, pageView{PageData: data, URL: continueURL})
+}
+
+// AssetsHandler serves style.css, mount it at AssetsURL with
+// http.StripPrefix
+func (u *UI) AssetsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "style.css" && r.URL.Path != "/style.css" {
+			http.NotFound(w, r)
+			return
+		}
+		css, err := u.file("style.css")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/css; charset=utf-8")
+		w.Write(css)
+	})
+}
+
+// render executes page inside the layout
+func (u *UI) render(w http.ResponseWriter, page string, status int, view pageView) {
+	u.once.Do(u.parse)
+	if u.err != nil {
+		http.Error(w, u.err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	view.Theme = u.theme()
+	view.AssetsURL = u.assetsURL()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	u.pages[page].ExecuteTemplate(w, "layout", view)
+}
+
+// parse builds every page template once
+func (u *UI) parse() {
+	layout, err := u.file("layout.html")
+	if err != nil {
+		u.err = err
+		return
+	}
+	u.pages = make(map[string]*template.Template)
+	for _, page := range []string{"login.html", "denied.html", "interstitial.html"} {
+		content, err := u.file(page)
+		if err != nil {
+			u.err = err
+			return
+		}
+		t, err := template.New(page).Parse(string(layout))
+		if err == nil {
+			_, err = t.Parse(string(content))
+		}
+		if err != nil {
+			u.err = err
+			return
+		}
+		u.pages[page] = t
+	}
+}
+
+// file reads name from Overrides, falling back to the embedded default
+func (u *UI) file(name string) ([]byte, error) {
+	if u.Overrides != nil {
+		if b, err := fs.ReadFile(u.Overrides, name); err == nil {
+			return b, nil
+		}
+	}
+	return uiFiles.ReadFile("ui/" + name)
+}
+
+func (u *UI) catalog() *Catalog {
+	if u.Catalog == nil {
+		return DefaultCatalog()
+	}
+	return u.Catalog
+}
+
+func (u *UI) theme() Theme {
+	t := u.Theme
+	if t.Title == "" {
+		t.Title = "Sign in"
+	}
+	if t.PrimaryColor == "" {
+		t.PrimaryColor = "#2da44e"
+	}
+	if t.BackgroundColor == "" {
+		t.BackgroundColor = "#f6f8fa"
+	}
+	return t
+}
+
+func (u *UI) assetsURL() string {
+	if u.AssetsURL == "" {
+		return "/auth/assets"
+	}
+	return u.AssetsURL
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+// UserInfo fetches the profile of the user owning token on its own, handy to
+// refresh displayed profile data later without checking membership again
+func (c *Config) UserInfo(ctx context.Context, token *oauth2.Token) (*User, error) {
+	user, _, err := fetchUser(ctx, c.userClient(ctx, token))
+	return user, err
+}
+
+// UserInfo is Config.UserInfo() for tokens obtained somewhere else
+func (v *Verifier) UserInfo(ctx context.Context, token *oauth2.Token) (*User, error) {
+	user, _, err := fetchUser(ctx, oauth2.NewClient(withHTTPClient(ctx, v.httpClient()), oauth2.StaticTokenSource(token)))
+	return user, err
+}
+
+// fetchUser gets the user details from github. The response is returned as
+// well so callers can look at the granted scopes
+//
+// If github rejects the token ErrUnauthorized is returned
+func fetchUser(ctx context.Context, client *http.Client) (*User, *http.Response, error) {
+	var raw json.RawMessage
+	resp, err := get(ctx, client, "https://api.github.com/user", &raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, resp, ErrUnauthorized
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp, statusError(resp)
+	}
+
+	user := &User{raw: raw}
+	if err := json.Unmarshal(raw, user); err != nil {
+		return nil, nil, err
+	}
+	return user, resp, nil
+}
+
+// fetchEmails gets the /user/emails response body. It's nil when the token
+// can't read emails, like without the user:email scope
+func fetchEmails(ctx context.Context, client *http.Client) (json.RawMessage, error) {
+	var raw json.RawMessage
+	resp, err := get(ctx, client, "https://api.github.com/user/emails", &raw)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden && !rateLimited(resp) {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+	return raw, nil
+}
+
+// primaryEmail returns the primary verified address of a /user/emails
+// response, empty if there's none
+func primaryEmail(raw json.RawMessage) string {
+	var emails []email
+	if json.Unmarshal(raw, &emails) != nil {
+		return ""
+	}
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			return e.Email
+		}
+	}
+	return ""
+}
+
+// UserData is everything github told us about the user, given to a
+// DecodeUserFunc
+type UserData struct {
+	User   json.RawMessage // /user response body
+	Emails json.RawMessage // /user/emails response body
+	Teams  []Team          // teams the user belongs to, nil without read:org
+}
+
+// DecodeUserFunc can populate application specific fields of user, or store
+// an entirely custom user type in user.Extra, from the raw github data. This
+// avoids a second API call just to get fields the package discards
+type DecodeUserFunc func(ctx context.Context, user *User, data UserData) error
+
+// decodeUser calls v.DecodeUser, if any
+func (v *Verifier) decodeUser(ctx context.Context, user *User, emails json.RawMessage, teams []Team) error {
+	if v.DecodeUser == nil {
+		return nil
+	}
+	return v.DecodeUser(ctx, user, UserData{User: user.raw, Emails: emails, Teams: teams})
+}
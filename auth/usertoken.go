@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+// CheckPermissionToken is CheckPermissionContext() also returning the
+// user's token, so the application can make more github API calls on
+// their behalf, e.g. with Client(). token is set whenever the exchange
+// worked, even if the user was denied
+func (c *Config) CheckPermissionToken(ctx context.Context, code string) (ok bool, user *User, token *oauth2.Token, err error) {
+	token, err = c.Exchange(ctx, code)
+	if err != nil {
+		return false, nil, nil, err
+	}
+	decision, user, err := c.Verify(ctx, token)
+	if err != nil {
+		return false, nil, token, err
+	}
+	if decision.Reason == TokenInvalid {
+		return false, nil, token, ErrUnauthorized
+	}
+	return decision.Allowed, user, token, nil
+}
+
+// Client returns an http.Client making requests to github on behalf of the
+// user owning token. Clients are pooled, see ClientPoolSize
+func (c *Config) Client(ctx context.Context, token *oauth2.Token) *http.Client {
+	return c.userClient(ctx, token)
+}
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// Authenticator is a Config checked by New(), so misconfigurations show up
+// at startup instead of as confusing failures during logins
+type Authenticator struct {
+	*Config
+}
+
+// New validates c, see Validate(), normalizes its team names and returns an
+// Authenticator using it. c must not be changed afterwards
+func New(c *Config) (*Authenticator, error) {
+	c.Team = c.normalizeTeam(c.Team)
+	for i, spec := range c.AllowedTeams {
+		c.AllowedTeams[i] = c.normalizeTeam(spec)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &Authenticator{Config: c}, nil
+}
+
+// normalizeTeam trims spec and, unless CaseSensitive, lowercases it so it
+// reads like the slug github uses in urls
+func (c *Config) normalizeTeam(spec string) string {
+	spec = strings.TrimSpace(spec)
+	if !c.CaseSensitive {
+		spec = strings.ToLower(spec)
+	}
+	return spec
+}
+
+// Validate checks the required fields of c are set and the team settings
+// make sense
+func (c *Config) Validate() error {
+	switch {
+	case strings.TrimSpace(c.Organization) == "":
+		return errors.New("auth: Organization is required")
+	case strings.Contains(c.Organization, "/"):
+		return fmt.Errorf("auth: Organization %q must be an organization login", c.Organization)
+	case c.ClientID == "":
+		return errors.New("auth: ClientID is required")
+	case c.ClientSecret == "" && !c.PublicClient:
+		return errors.New("auth: ClientSecret is required, unless PublicClient")
+	case c.RevokeOnLogout && !c.KeepToken:
+		return errors.New("auth: RevokeOnLogout needs KeepToken")
+	case c.RevokeOnLogout && c.ClientSecret == "":
+		return errors.New("auth: RevokeOnLogout needs ClientSecret")
+	case c.Reverifier != nil && c.Reverifier.Verify == nil:
+		return errors.New("auth: Reverifier needs Verify")
+	}
+
+	for _, spec := range c.specs() {
+		if strings.Contains(spec, "/") {
+			return fmt.Errorf("auth: team %q must not include the organization", spec)
+		}
+		if _, err := path.Match(spec, ""); err != nil {
+			return fmt.Errorf("auth: team %q: %v", spec, err)
+		}
+	}
+	if (c.DirectMembership || c.GraphQL) && len(c.TeamIDs) == 0 && len(c.TeamRegexps) == 0 {
+		for _, spec := range c.specs() {
+			if isGlob(spec) {
+				return fmt.Errorf("auth: team %q: DirectMembership and GraphQL need slugs, not globs", spec)
+			}
+		}
+	}
+
+	for _, u := range append([]string{c.RedirectURL}, c.RedirectURLs...) {
+		if u == "" {
+			continue
+		}
+		parsed, err := url.Parse(u)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return fmt.Errorf("auth: redirect url %q must be absolute", u)
+		}
+	}
+	return nil
+}
+
+// specs is Verifier.specs() for c
+func (c *Config) specs() []string {
+	return (&Verifier{Team: c.Team, AllowedTeams: c.AllowedTeams}).specs()
+}
+
+// Probe asks github whether Organization and the configured team slugs
+// exist, a startup check catching typos. Teams are only checked with token,
+// which must belong to a member of Organization with read:org. Team names
+// and globs are skipped
+func (a *Authenticator) Probe(ctx context.Context, token *oauth2.Token) error {
+	client := a.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if token != nil {
+		client = a.Client(ctx, token)
+	}
+
+	resp, err := get(ctx, client, "https://api.github.com/orgs/"+url.PathEscape(a.Organization), nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("auth: organization %q doesn't exist", a.Organization)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp)
+	}
+	if token == nil {
+		return nil
+	}
+
+	for _, spec := range a.specs() {
+		if isGlob(spec) || strings.Contains(spec, " ") {
+			continue
+		}
+		resp, err := get(ctx, client, "https://api.github.com/orgs/"+url.PathEscape(a.Organization)+"/teams/"+url.PathEscape(spec), nil)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("auth: team %q doesn't exist in %s, or isn't visible to the token", spec, a.Organization)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return statusError(resp)
+		}
+	}
+	return nil
+}
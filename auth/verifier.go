@@ -0,0 +1,640 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Verifier holds only the Organization/Team settings and does the membership
+// check with any authorized client or token. It's independent of the OAuth2
+// application, so services receiving tokens from another component can still
+// make sure the user belongs to the Team
+//
+// Without any Team, AllowedTeams, TeamIDs or TeamRegexps every active member
+// of Organization is allowed
+type Verifier struct {
+	Organization string // Organization name
+	Team         string // Team inside Organization by slug or name, or a glob like eng-*
+
+	// AllowedTeams are more teams, or globs, besides Team. By default
+	// membership in any of them is enough, set RequireAll to require all
+	AllowedTeams []string
+	RequireAll   bool
+
+	// TeamIDs are teams given by their immutable numeric github id, so
+	// renaming them in github never breaks authentication
+	TeamIDs []int64
+
+	// RequirePublicMembership makes only active and publicly visible
+	// Organization memberships satisfy the check. Concealed or pending
+	// memberships are denied, as some compliance setups require
+	RequirePublicMembership bool
+
+	// Repository, as owner/name, admits anyone with MinPermission on it:
+	// pull, triage, push (the default), maintain or admin. Teams still
+	// admit their members, without teams only the repository does. Private
+	// repositories need the repo scope, see Config.RepoScope
+	Repository    string
+	MinPermission string
+
+	// AllowedEmailDomains only admit users with a verified email address
+	// in one of them, whatever their teams. Subdomains must be listed too.
+	// The addresses need the user:email scope, always requested
+	AllowedEmailDomains []string
+
+	// Members, when set, answers for the users it lists without asking
+	// github about their teams, see TeamMembers
+	Members *TeamMembers
+
+	// JIT, when set, adds users denied with NotInTeam to its team before
+	// the remaining rules run, see Config.JIT
+	JIT *TeamProvisioner
+
+	// IncludeChildTeams makes the teams match members of their child
+	// teams, like github does for permissions. Listing the teams needs one
+	// more request per ancestor, DirectMembership and GraphQL modes already
+	// count child team members
+	IncludeChildTeams bool
+
+	// AllowOrgAdmins admits owners of Organization even when they aren't in
+	// any of the teams. Their Decision has no Team and an admin OrgRole
+	AllowOrgAdmins bool
+
+	// RequireMaintainer only admits maintainers of the teams, members get
+	// NotInTeam. Finding out the role takes one request per matching team
+	// unless in DirectMembership or GraphQL mode
+	RequireMaintainer bool
+
+	// TeamRegexps are acceptable team slugs, in addition to Team, for naming
+	// schemes globs can't express. They are used as is, so add (?i) for
+	// case insensitive matching
+	TeamRegexps []*regexp.Regexp
+
+	// SlugOnly matches Team and AllowedTeams against team slugs only.
+	// Display names can contain spaces and be renamed, slugs are what
+	// github uses in urls
+	SlugOnly bool
+
+	// CaseSensitive turns off the case insensitive comparison of
+	// Organization and Team names. github treats them case insensitively
+	// in urls, so you probably don't want this
+	CaseSensitive bool
+
+	// DecodeUser is an optional hook to get more out of github user data,
+	// see DecodeUserFunc
+	DecodeUser DecodeUserFunc
+
+	// Roles optionally maps the teams of allowed users to application roles
+	Roles RoleMapper
+
+	// Authorizer, when set, replaces the team rule, see Authorizer
+	Authorizer Authorizer
+
+	// AllowUsers are github logins allowed even without the membership,
+	// like outside contractors. DenyUsers are always denied with
+	// DeniedByPolicy, winning over everything but Authorize
+	AllowUsers []string
+	DenyUsers  []string
+
+	// Authorize is an optional final step of the decision, see AuthorizeFunc
+	Authorize AuthorizeFunc
+
+	// Snapshots, when set, remembers decisions so VerifyToken() can fall
+	// back to them during github outages instead of locking every user out.
+	// Only decisions confirmed within MaxStaleness are reused
+	Snapshots    SnapshotStore
+	MaxStaleness time.Duration
+
+	// DirectMembership asks github about the membership in each of Team
+	// and AllowedTeams, which must then be slugs, instead of listing every
+	// team of the user. It's a single request for users in many teams and
+	// tells pending invitations apart. It's ignored when globs, TeamIDs or
+	// TeamRegexps need the listing. AuthorizeFunc and RoleMapper get no
+	// teams in this mode
+	DirectMembership bool
+
+	// GraphQL gets the user details, the Organization membership and the
+	// members of Team and AllowedTeams, which must then be slugs, with a
+	// single GraphQL query instead of paginating the REST api. It's
+	// ignored when globs, TeamIDs, TeamRegexps or DecodeUser need REST.
+	// User.Email is the public profile email in this mode, and RoleMapper
+	// and AuthorizeFunc only get the matched team
+	GraphQL bool
+
+	// IdPGroups fetches the identity provider groups linked to the matched
+	// team through team synchronization, see Team.IdPGroups. github only
+	// shows them to organization owners and team maintainers
+	IdPGroups bool
+
+	// HTTPClient, when set, makes the github api calls of VerifyToken(),
+	// e.g. to go through a proxy or log requests
+	HTTPClient *http.Client
+
+	// Timeout bounds each github api request, none if zero, see
+	// Config.Timeout
+	Timeout time.Duration
+
+	// Retries of github api GETs, see Config.Retries
+	Retries int
+
+	// RateLimits, when set, tracks the github rate limits seen by v, and
+	// RateLimitFloor works like Config.RateLimitFloor
+	RateLimits     *RateLimits
+	RateLimitFloor int
+
+	// Logger records github api calls, see Config.Logger
+	Logger *slog.Logger
+
+	// Metrics instruments github api calls, see Config.Metrics
+	Metrics Metrics
+
+	// appToken marks GitHub App user-to-server tokens, which carry no
+	// scopes since the app permissions apply instead
+	appToken bool
+
+	// slugs caches the teams named by Team and AllowedTeams, see
+	// candidateTeams()
+	slugs *teamSlugs
+}
+
+// AuthorizeFunc can override or augment the built-in decision, e.g. by
+// consulting an internal HR system. It receives every team the user belongs
+// to, or nil without read:org, and the Decision made so far. It isn't called
+// when the Reason is TokenInvalid
+type AuthorizeFunc func(ctx context.Context, user *User, teams []Team, decision Decision) (Decision, error)
+
+// orgMembership is the response of /user/memberships/orgs/{org}
+type orgMembership struct {
+	State string `json:"state"` // active or pending
+	Role  string `json:"role"`  // admin or member
+}
+
+// verifier returns a Verifier with the Organization/Team settings of c
+func (c *Config) verifier() *Verifier {
+	return &Verifier{
+		Organization: c.Organization,
+		Team:         c.Team,
+		AllowedTeams: c.AllowedTeams,
+		RequireAll:   c.RequireAll,
+		TeamIDs:      c.TeamIDs,
+		DecodeUser:   c.DecodeUser,
+		Roles:        c.Roles,
+		Authorize:    c.Authorize,
+		Authorizer:   c.Authorizer,
+		AllowUsers:   c.AllowUsers,
+		DenyUsers:    c.DenyUsers,
+		Snapshots:    c.Snapshots,
+		MaxStaleness: c.MaxStaleness,
+		IdPGroups:    c.IdPGroups,
+		HTTPClient:   c.HTTPClient,
+		Retries:      c.Retries,
+		RateLimits:   &c.limits,
+		Timeout:      c.timeout(),
+		Logger:       c.Logger,
+		Metrics:      c.Metrics,
+
+		DirectMembership:        c.DirectMembership,
+		GraphQL:                 c.GraphQL,
+		RequirePublicMembership: c.RequirePublicMembership,
+		RateLimitFloor:          c.RateLimitFloor,
+		RequireMaintainer:       c.RequireMaintainer,
+		AllowOrgAdmins:          c.AllowOrgAdmins,
+		IncludeChildTeams:       c.IncludeChildTeams,
+		Members:                 c.Members,
+		JIT:                     c.JIT,
+		AllowedEmailDomains:     c.AllowedEmailDomains,
+		Repository:              c.Repository,
+		MinPermission:           c.MinPermission,
+		CaseSensitive:           c.CaseSensitive,
+		SlugOnly:                c.SlugOnly,
+		TeamRegexps:             c.TeamRegexps,
+
+		slugs: &c.slugs,
+	}
+}
+
+// VerifyToken checks the membership of the user owning token
+func (v *Verifier) VerifyToken(ctx context.Context, token *oauth2.Token) (Decision, *User, error) {
+	return v.verifyWithFallback(ctx, oauth2.NewClient(withHTTPClient(ctx, v.httpClient()), oauth2.StaticTokenSource(token)), token)
+}
+
+// Verify fetches the user details and checks the Organization/Team membership
+// using client, which must already be authorized to make requests to github api
+// on behalf of the user
+//
+// user will be nil when the Reason is TokenInvalid. If an error happens and we
+// can't verify, err will be set
+func (v *Verifier) Verify(ctx context.Context, client *http.Client) (Decision, *User, error) {
+	decision, user, teams, err := v.decide(ctx, client)
+	if err != nil || user == nil {
+		return decision, user, err
+	}
+	if decision, teams, err = v.jit(ctx, client, user, teams, decision); err != nil {
+		return Decision{}, nil, err
+	}
+	decision, err = v.finish(ctx, client, user, teams, decision, true)
+	if err != nil {
+		return Decision{}, nil, err
+	}
+	return decision, user, nil
+}
+
+// finish applies the rules following the team check, made by decide() or
+// checkMembership(), and the hooks. userToken tells whether client belongs
+// to user, the rules needing their own token are skipped otherwise
+func (v *Verifier) finish(ctx context.Context, client *http.Client, user *User, teams []Team, decision Decision, userToken bool) (Decision, error) {
+	var err error
+	if userToken && v.AllowOrgAdmins && decision.Reason == NotInTeam {
+		if decision, err = v.orgAdmin(ctx, client, decision); err != nil {
+			return Decision{}, err
+		}
+	}
+	if decision, err = v.repoPermission(ctx, client, user.Login, decision); err != nil {
+		return Decision{}, err
+	}
+	if userToken {
+		if decision, err = v.emailDomain(ctx, client, user, decision); err != nil {
+			return Decision{}, err
+		}
+	}
+	decision.Teams = v.orgTeams(teams)
+	if decision, err = v.authorizer(ctx, user, decision); err != nil {
+		return Decision{}, err
+	}
+	decision = v.userLists(user, decision)
+	if err := v.mapRoles(ctx, user, teams, &decision); err != nil {
+		return Decision{}, err
+	}
+	if v.Authorize == nil {
+		return decision, nil
+	}
+	return v.Authorize(ctx, user, teams, decision)
+}
+
+// orgTeams returns the teams belonging to Organization
+func (v *Verifier) orgTeams(teams []Team) []Team {
+	var own []Team
+	for _, t := range teams {
+		if v.matchOrg(t.Organization) {
+			own = append(own, t)
+		}
+	}
+	return own
+}
+
+// decide is Verify() without roles and the Authorize hook, also returning the teams
+// the user belongs to
+func (v *Verifier) decide(ctx context.Context, client *http.Client) (Decision, *User, []Team, error) {
+	var user *User
+	var resp *http.Response
+	if v.Members != nil && v.DecodeUser == nil {
+		decision, u, r, ok, err := v.decideMembers(ctx, client)
+		if ok || err != nil {
+			return decision, u, decision.Teams, err
+		}
+		user, resp = u, r
+	}
+	if slugs, ok := v.plainSlugs(); ok && v.GraphQL && v.DecodeUser == nil {
+		return v.decideGraphQL(ctx, client, slugs)
+	}
+
+	// get user details, emails and teams at the same time. Teams need
+	// read:org, which we only learn about from the /user response, so they
+	// are listed anyway and dropped without it. In DirectMembership mode we
+	// ask about the configured teams later instead. A user decideMembers()
+	// didn't find was fetched already
+
+	direct := v.directSlugs()
+	var wg sync.WaitGroup
+	var emails json.RawMessage
+	var teams []Team
+	var userErr, emailsErr, teamsErr error
+	if user == nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user, resp, userErr = fetchUser(ctx, client)
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		emails, emailsErr = fetchEmails(ctx, client)
+	}()
+	if direct == nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			teams, teamsErr = listTeams(ctx, client)
+		}()
+	}
+	wg.Wait()
+
+	if userErr == ErrUnauthorized {
+		return Decision{Reason: TokenInvalid}, nil, nil, nil
+	}
+	if userErr != nil {
+		return Decision{}, nil, nil, userErr
+	}
+	if emailsErr != nil {
+		return Decision{}, nil, nil, emailsErr
+	}
+	user.Email = primaryEmail(emails)
+	user.emails = emails
+
+	orgScope := v.appToken || hasOrgScope(resp.Header.Get("X-OAuth-Scopes"))
+	if !orgScope {
+		teams = nil
+	} else if teamsErr != nil {
+		return Decision{}, nil, nil, teamsErr
+	}
+
+	if err := v.decodeUser(ctx, user, emails, teams); err != nil {
+		return Decision{}, nil, nil, err
+	}
+
+	// without read:org a missing team would be a lie
+
+	if !orgScope {
+		return Decision{Reason: MissingScope}, user, teams, nil
+	}
+	if direct != nil {
+		return v.decideDirect(ctx, client, user, direct)
+	}
+	if v.orgOnly() {
+		return v.decideOrg(ctx, client, user, teams)
+	}
+
+	// check if user belongs to team
+
+	if v.IncludeChildTeams {
+		var err error
+		if teams, err = v.withAncestors(ctx, client, teams); err != nil {
+			return Decision{}, nil, nil, err
+		}
+	}
+	orgTeams := v.orgTeams(teams)
+	candidates := orgTeams
+	if v.RequireMaintainer {
+		var err error
+		if candidates, err = v.maintained(ctx, client, user, orgTeams); err != nil {
+			return Decision{}, nil, nil, err
+		}
+	}
+	if t := v.matchTeams(candidates); t != nil {
+		return v.admit(ctx, client, user, t, teams)
+	}
+	if len(orgTeams) > 0 {
+		return Decision{Reason: NotInTeam}, user, teams, nil
+	}
+	return v.orgDecision(ctx, client, user, teams)
+}
+
+// maintained returns the teams among teams which may admit the user and
+// they maintain, with their Role filled in
+func (v *Verifier) maintained(ctx context.Context, client *http.Client, user *User, teams []Team) ([]Team, error) {
+	var own []Team
+	for _, t := range teams {
+		if !v.matchTeam(t) {
+			continue
+		}
+		role, err := teamRole(ctx, client, t, user.Login)
+		if err != nil {
+			return nil, err
+		}
+		if role == "maintainer" {
+			t.Role = role
+			own = append(own, t)
+		}
+	}
+	return own, nil
+}
+
+// admit finishes the decision for a user who is in team t, checking public
+// membership if required and filling in the team details
+func (v *Verifier) admit(ctx context.Context, client *http.Client, user *User, t *Team, teams []Team) (Decision, *User, []Team, error) {
+	if v.RequirePublicMembership {
+		reason, err := publicMembership(ctx, client, v.Organization, user.Login)
+		if err != nil {
+			return Decision{}, nil, nil, err
+		}
+		if reason != "" {
+			return Decision{Reason: reason}, user, teams, nil
+		}
+	}
+
+	var err error
+	if t.Role == "" {
+		t.Role, err = teamRole(ctx, client, *t, user.Login)
+		if err != nil {
+			return Decision{}, nil, nil, err
+		}
+	}
+	if v.IdPGroups {
+		if t.IdPGroups, err = idpGroups(ctx, client, *t); err != nil {
+			return Decision{}, nil, nil, err
+		}
+	}
+	return Decision{Allowed: true, Team: t}, user, teams, nil
+}
+
+// orgDecision denies a user who isn't in any acceptable team, asking github
+// whether they are a member of the organization at all
+func (v *Verifier) orgDecision(ctx context.Context, client *http.Client, user *User, teams []Team) (Decision, *User, []Team, error) {
+	var membership orgMembership
+	resp, err := get(ctx, client, "https://api.github.com/user/memberships/orgs/"+url.PathEscape(v.Organization), &membership)
+	if err != nil {
+		return Decision{}, nil, nil, err
+	}
+	switch {
+	case rateLimited(resp):
+		return Decision{}, nil, nil, statusError(resp)
+	case resp.StatusCode == http.StatusOK && membership.State == "pending":
+		return Decision{Reason: PendingInvite}, user, teams, nil
+	case resp.StatusCode == http.StatusOK:
+		return Decision{Reason: NotInTeam, OrgRole: membership.Role}, user, teams, nil
+	case resp.StatusCode == http.StatusNotFound, resp.StatusCode == http.StatusForbidden:
+		return Decision{Reason: NotInOrganization}, user, teams, nil
+	}
+
+	return Decision{}, nil, nil, statusError(resp)
+}
+
+// orgAdmin allows Organization owners denied with NotInTeam, asking github
+// for their role unless orgDecision() already did
+func (v *Verifier) orgAdmin(ctx context.Context, client *http.Client, decision Decision) (Decision, error) {
+	if decision.OrgRole == "" {
+		var membership orgMembership
+		resp, err := get(ctx, client, "https://api.github.com/user/memberships/orgs/"+url.PathEscape(v.Organization), &membership)
+		if err != nil {
+			return Decision{}, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return Decision{}, statusError(resp)
+		}
+		decision.OrgRole = membership.Role
+	}
+	if decision.OrgRole == "admin" {
+		return Decision{Allowed: true, OrgRole: decision.OrgRole}, nil
+	}
+	return decision, nil
+}
+
+// orgOnly reports whether no team is configured, so any member of
+// Organization is allowed
+func (v *Verifier) orgOnly() bool {
+	return len(v.specs()) == 0 && len(v.TeamIDs) == 0 && len(v.TeamRegexps) == 0
+}
+
+// decideOrg allows any active member of Organization, for tools open to
+// the whole organization. Team is nil in the Decision
+func (v *Verifier) decideOrg(ctx context.Context, client *http.Client, user *User, teams []Team) (Decision, *User, []Team, error) {
+	decision, user, teams, err := v.orgDecision(ctx, client, user, teams)
+	if err != nil || decision.Reason != NotInTeam {
+		return decision, user, teams, err
+	}
+
+	// orgDecision denies active members with NotInTeam
+
+	if v.RequirePublicMembership {
+		reason, err := publicMembership(ctx, client, v.Organization, user.Login)
+		if err != nil {
+			return Decision{}, nil, nil, err
+		}
+		if reason != "" {
+			return Decision{Reason: reason}, user, teams, nil
+		}
+	}
+	return Decision{Allowed: true}, user, teams, nil
+}
+
+// directSlugs returns the team slugs to check in DirectMembership mode, nil
+// when the mode is off, no team is configured or some team can only be
+// matched by listing them
+func (v *Verifier) directSlugs() []string {
+	if !v.DirectMembership {
+		return nil
+	}
+	slugs, ok := v.plainSlugs()
+	if !ok || len(slugs) == 0 {
+		return nil
+	}
+	return slugs
+}
+
+// plainSlugs returns the configured teams when they can all be looked up
+// by slug, ok is false when globs, TeamIDs or TeamRegexps need the listing
+func (v *Verifier) plainSlugs() (slugs []string, ok bool) {
+	if len(v.TeamIDs) > 0 || len(v.TeamRegexps) > 0 {
+		return nil, false
+	}
+	slugs = v.specs()
+	for _, spec := range slugs {
+		if isGlob(spec) {
+			return nil, false
+		}
+	}
+	return slugs, true
+}
+
+// decideDirect asks github about the membership of user in each of slugs
+// instead of listing all their teams. teams is always nil
+func (v *Verifier) decideDirect(ctx context.Context, client *http.Client, user *User, slugs []string) (Decision, *User, []Team, error) {
+	var admitted *Team
+	pending := false
+	for _, slug := range slugs {
+		t := Team{Name: slug, Slug: slug, Organization: v.Organization}
+		var membership teamMembership
+		u := "https://api.github.com/orgs/" + url.PathEscape(v.Organization) + "/teams/" + url.PathEscape(slug) + "/memberships/" + url.PathEscape(user.Login)
+		resp, err := get(ctx, client, u, &membership)
+		if err != nil {
+			return Decision{}, nil, nil, err
+		}
+
+		active := false
+		switch {
+		case resp.StatusCode == http.StatusOK && membership.State == "active":
+			active = !v.RequireMaintainer || membership.Role == "maintainer"
+			t.Role = membership.Role
+		case resp.StatusCode == http.StatusOK:
+			pending = true
+		case resp.StatusCode != http.StatusNotFound:
+			return Decision{}, nil, nil, statusError(resp)
+		}
+
+		if active && admitted == nil {
+			admitted = &t
+		}
+		if active && !v.RequireAll {
+			break
+		}
+		if !active && v.RequireAll {
+			admitted = nil
+			break
+		}
+	}
+
+	if admitted != nil {
+		return v.admit(ctx, client, user, admitted, nil)
+	}
+	if pending {
+		return Decision{Reason: PendingInvite}, user, nil, nil
+	}
+	return v.orgDecision(ctx, client, user, nil)
+}
+
+// publicMembership makes sure login is an active and public member of org,
+// returning the Reason to deny them otherwise
+func publicMembership(ctx context.Context, client *http.Client, org, login string) (Reason, error) {
+	var membership orgMembership
+	resp, err := get(ctx, client, "https://api.github.com/user/memberships/orgs/"+url.PathEscape(org), &membership)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", statusError(resp)
+	}
+	if membership.State != "active" {
+		return PendingInvite, nil
+	}
+	return publicMember(ctx, client, org, login)
+}
+
+// publicMember returns MembershipConcealed unless login is a public member
+// of org. It works with any token, unlike publicMembership()
+func publicMember(ctx context.Context, client *http.Client, org, login string) (Reason, error) {
+	// github answers 204 for public members and 404 otherwise
+
+	resp, err := get(ctx, client, "https://api.github.com/orgs/"+url.PathEscape(org)+"/public_members/"+url.PathEscape(login), nil)
+	if err != nil {
+		return "", err
+	}
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return "", nil
+	case http.StatusNotFound:
+		return MembershipConcealed, nil
+	}
+	return "", statusError(resp)
+}
+
+// hasOrgScope reports whether the X-OAuth-Scopes header value includes a
+// scope allowing us to read private org and team memberships
+func hasOrgScope(header string) bool {
+	for _, s := range strings.Split(header, ",") {
+		switch strings.TrimSpace(s) {
+		case "read:org", "write:org", "admin:org":
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// userRevoker is a SessionStore able to end every session of a user, like
+// ServerSessions
+type userRevoker interface {
+	RevokeUser(ctx context.Context, login string) (int, error)
+}
+
+// webhookPayload is the part of organization and membership events we need
+type webhookPayload struct {
+	Action       string `json:"action"`
+	Organization struct {
+		Login string `json:"login"`
+	} `json:"organization"`
+	Membership struct { // organization events
+		User struct {
+			Login string `json:"login"`
+		} `json:"user"`
+	} `json:"membership"`
+	Member struct { // membership events
+		Login string `json:"login"`
+	} `json:"member"`
+}
+
+// WebhookHandler consumes github organization and membership webhooks, signed
+// with secret, and invalidates the access of users removed from Organization
+// or from any of its teams:
+//
+//   - their cached membership is marked for checking again on the next
+//     request, see Config.Cache
+//   - their sessions are deleted when Sessions can do it, like ServerSessions
+//   - they are dropped from Members until its next refresh
+//
+// Unsigned or badly signed deliveries get a 401. Other events are ignored
+func (c *Config) WebhookHandler(secret []byte) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !validSignature(secret, body, r.Header.Get("X-Hub-Signature-256")) {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		var p webhookPayload
+		if err := json.Unmarshal(body, &p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var login string
+		switch event := r.Header.Get("X-GitHub-Event"); {
+		case event == "organization" && p.Action == "member_removed":
+			login = p.Membership.User.Login
+		case event == "membership" && p.Action == "removed":
+			login = p.Member.Login
+		}
+		if login == "" || !strings.EqualFold(p.Organization.Login, c.Organization) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if err := c.Invalidate(r.Context(), login); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// Invalidate makes login prove their membership again: their cached
+// membership is checked against github on the next request, they are
+// dropped from c.Members and their sessions are deleted, when c.Sessions
+// supports it
+func (c *Config) Invalidate(ctx context.Context, login string) error {
+	if c.Members != nil {
+		c.Members.Remove(login)
+	}
+	if c.Cache != nil {
+		m, ok, err := c.Cache.Get(ctx, strings.ToLower(login))
+		if err != nil {
+			return err
+		}
+		if ok {
+			m.Checked = time.Time{}
+			if err := c.Cache.Set(ctx, strings.ToLower(login), m, c.sessionTTL()); err != nil {
+				return err
+			}
+		}
+	}
+	if s, ok := c.sessions().(userRevoker); ok {
+		if _, err := s.RevokeUser(ctx, login); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validSignature checks the X-Hub-Signature-256 header of a delivery
+func validSignature(secret, body []byte, signature string) bool {
+	if len(secret) == 0 || !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestValidSignature(t *testing.T) {
+	secret := []byte("hook secret")
+	body := []byte(`{"action":"member_removed"}`)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	good := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name      string
+		secret    []byte
+		body      []byte
+		signature string
+		ok        bool
+	}{
+		{"valid", secret, body, good, true},
+		{"no secret", nil, body, good, false},
+		{"empty signature", secret, body, "", false},
+		{"sha1 header", secret, body, "sha1=" + strings.TrimPrefix(good, "sha256="), false},
+		{"other body", secret, []byte(`{"action":"member_added"}`), good, false},
+		{"other secret", []byte("other"), body, good, false},
+		{"uppercase hex", secret, body, strings.ToUpper(good), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validSignature(tt.secret, tt.body, tt.signature); got != tt.ok {
+				t.Errorf("validSignature() = %v, want %v", got, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// adminTokenEnv holds the bearer token sent to the admin APIs
+const adminTokenEnv = "GITHUB_ORG_AUTH_ADMIN_TOKEN"
+
+// admin manages sessions and allow/deny overrides of a running instance
+// through its admin APIs
+func admin(args []string) error {
+	flags := flag.NewFlagSet("admin", flag.ExitOnError)
+	sessionsURL := flags.String("sessions-url", "", "url where ServerSessions.AdminHandler is mounted")
+	policyURL := flags.String("policy-url", "", "url where RuntimePolicy.AdminHandler is mounted")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: github-org-auth admin [flags] sessions [revoke <login>]")
+		fmt.Fprintln(os.Stderr, "       github-org-auth admin [flags] overrides [allow|deny|clear <login>]")
+		fmt.Fprintf(os.Stderr, "the bearer token is taken from %s\n", adminTokenEnv)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	a := &adminClient{token: os.Getenv(adminTokenEnv)}
+	args = flags.Args()
+	switch {
+	case len(args) == 1 && args[0] == "sessions":
+		return a.listSessions(*sessionsURL)
+	case len(args) == 3 && args[0] == "sessions" && args[1] == "revoke":
+		return a.revokeSessions(*sessionsURL, args[2])
+	case len(args) == 1 && args[0] == "overrides":
+		return a.listOverrides(*policyURL)
+	case len(args) == 3 && args[0] == "overrides":
+		return a.setOverride(*policyURL, args[1], args[2])
+	}
+	flags.Usage()
+	os.Exit(2)
+	return nil
+}
+
+// adminClient talks to the admin APIs
+type adminClient struct {
+	token string
+}
+
+// do sends a request to base + path, decoding the JSON response into v
+func (a *adminClient) do(method, base, path string, body io.Reader, v interface{}) error {
+	if base == "" {
+		return errors.New("missing the admin API url")
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(base, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s: %s %s", method, req.URL, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (a *adminClient) listSessions(base string) error {
+	var sessions []struct {
+		ID      string    `json:"id"`
+		Login   string    `json:"login"`
+		Created time.Time `json:"created"`
+		Expires time.Time `json:"expires"`
+	}
+	if err := a.do("GET", base, "/", nil, &sessions); err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "LOGIN\tCREATED\tEXPIRES\tID")
+	for _, s := range sessions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Login, s.Created.Format(time.RFC3339), s.Expires.Format(time.RFC3339), s.ID)
+	}
+	return w.Flush()
+}
+
+func (a *adminClient) revokeSessions(base, login string) error {
+	var resp struct {
+		Revoked int `json:"revoked"`
+	}
+	if err := a.do("DELETE", base, "/users/"+url.PathEscape(login), nil, &resp); err != nil {
+		return err
+	}
+	fmt.Printf("revoked %d sessions of %s\n", resp.Revoked, login)
+	return nil
+}
+
+// policy is the part of the RuntimePolicy state the CLI shows
+type policy struct {
+	Overrides map[string]bool `json:"overrides"`
+}
+
+func (a *adminClient) listOverrides(base string) error {
+	var p policy
+	if err := a.do("GET", base, "/", nil, &p); err != nil {
+		return err
+	}
+	return printOverrides(p)
+}
+
+func (a *adminClient) setOverride(base, action, login string) error {
+	path := "/overrides/" + url.PathEscape(login)
+	var p policy
+	var err error
+	switch action {
+	case "allow":
+		err = a.do("PUT", base, path, strings.NewReader("true"), &p)
+	case "deny":
+		err = a.do("PUT", base, path, strings.NewReader("false"), &p)
+	case "clear":
+		err = a.do("DELETE", base, path, nil, &p)
+	default:
+		return fmt.Errorf("unknown override action %q, use allow, deny or clear", action)
+	}
+	if err != nil {
+		return err
+	}
+	return printOverrides(p)
+}
+
+func printOverrides(p policy) error {
+	logins := make([]string, 0, len(p.Overrides))
+	for login := range p.Overrides {
+		logins = append(logins, login)
+	}
+	sort.Strings(logins)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "LOGIN\tOVERRIDE")
+	for _, login := range logins {
+		override := "deny"
+		if p.Overrides[login] {
+			override = "allow"
+		}
+		fmt.Fprintf(w, "%s\t%s\n", login, override)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/RealGeeks/github-org-auth/auth"
+	"golang.org/x/oauth2"
+)
+
+// check sanity checks an organization/team configuration with the token of
+// the signed in user
+func check(args []string) error {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	org := flags.String("org", "", "github organization")
+	team := flags.String("team", "", "team inside the organization")
+	clientID := flags.String("client-id", "", "OAuth app client id, for the device flow")
+	login := flags.String("login", "", "user to check, the signed in user if empty")
+	members := flags.Bool("members", false, "list the team members")
+	flags.Parse(args)
+
+	if *org == "" {
+		return errors.New("-org is required")
+	}
+
+	ctx := context.Background()
+	cfg := &auth.Config{Organization: *org, Team: *team, ClientID: *clientID}
+	token, err := signIn(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if err := (&auth.Authenticator{Config: cfg}).Probe(ctx, token); err != nil {
+		return err
+	}
+	fmt.Printf("organization %s and team %q exist\n", *org, *team)
+	cfg.ServerToken = oauth2.StaticTokenSource(token)
+
+	if *members {
+		list := &auth.TeamMembers{Config: cfg}
+		if err := list.Sync(ctx); err != nil {
+			return err
+		}
+		for _, member := range list.Logins() {
+			fmt.Println(member)
+		}
+	}
+
+	var decision auth.Decision
+	who := *login
+	if who == "" {
+		var user *auth.User
+		decision, user, err = cfg.Verify(ctx, token)
+		if user != nil {
+			who = user.Login
+		}
+	} else {
+		decision, err = cfg.CheckMembership(ctx, who)
+	}
+	if err != nil && err != auth.ErrLinkRequired {
+		return err
+	}
+	if !decision.Allowed {
+		return fmt.Errorf("%s: access denied: %s", who, decision.Reason)
+	}
+	if decision.Team != nil {
+		fmt.Printf("%s: allowed by team %s\n", who, decision.Team.Slug)
+	} else {
+		fmt.Printf("%s: allowed\n", who)
+	}
+	return nil
+}
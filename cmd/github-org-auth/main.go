@@ -0,0 +1,45 @@
+// Command github-org-auth is a companion tool for the auth package
+//
+// Usage:
+//
+//	github-org-auth session -org acme -team eng -client-id ID -key-file key
+//	github-org-auth admin -sessions-url URL -policy-url URL sessions|overrides ...
+//	github-org-auth check -org acme -team eng [-members] [-login alice]
+//
+// session signs in with github, using the device flow or the GITHUB_TOKEN
+// environment variable, verifies the user belongs to the team and prints a
+// short-lived session token usable against protected services, for scripts
+// and cron jobs run by team members
+//
+// check validates a configuration before deploying it: it confirms the
+// organization and team exist, optionally lists the team members, and tells
+// whether -login, or the signed in user, would be allowed
+//
+// admin lists and revokes sessions and manages allow/deny overrides of a
+// running instance through its admin APIs, authenticating with the bearer
+// token in GITHUB_ORG_AUTH_ADMIN_TOKEN
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// commands available, by name
+var commands = map[string]func(args []string) error{
+	"session": session,
+	"admin":   admin,
+	"check":   check,
+}
+
+func main() {
+	if len(os.Args) < 2 || commands[os.Args[1]] == nil {
+		fmt.Fprintln(os.Stderr, "usage: github-org-auth <command> [flags]")
+		fmt.Fprintln(os.Stderr, "commands: session, admin, check")
+		os.Exit(2)
+	}
+	if err := commands[os.Args[1]](os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "github-org-auth:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/RealGeeks/github-org-auth/auth"
+	"golang.org/x/oauth2"
+)
+
+// session mints a short-lived session token for the signed in user
+func session(args []string) error {
+	flags := flag.NewFlagSet("session", flag.ExitOnError)
+	org := flags.String("org", "", "github organization")
+	team := flags.String("team", "", "team inside the organization")
+	clientID := flags.String("client-id", "", "OAuth app client id, for the device flow")
+	keyFile := flags.String("key-file", "", "file with the HMAC key tokens are signed with")
+	ttl := flags.Duration("ttl", time.Hour, "token lifetime")
+	issuer := flags.String("issuer", "", "optional iss claim")
+	flags.Parse(args)
+
+	if *org == "" || *keyFile == "" {
+		return errors.New("-org and -key-file are required")
+	}
+	key, err := os.ReadFile(*keyFile)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	cfg := &auth.Config{Organization: *org, Team: *team, ClientID: *clientID}
+	decision, user, err := verify(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if !decision.Allowed {
+		return fmt.Errorf("access denied: %s", decision.Reason)
+	}
+
+	issuerCfg := &auth.TokenIssuer{Keys: [][]byte{bytes.TrimSpace(key)}, TTL: *ttl, Issuer: *issuer}
+	signed, err := issuerCfg.Issue(user, decision)
+	if err != nil {
+		return err
+	}
+	fmt.Println(signed)
+	return nil
+}
+
+// verify checks the user of signIn()
+func verify(ctx context.Context, cfg *auth.Config) (auth.Decision, *auth.User, error) {
+	token, err := signIn(ctx, cfg)
+	if err != nil {
+		return auth.Decision{}, nil, err
+	}
+	return cfg.Verify(ctx, token)
+}
+
+// signIn returns GITHUB_TOKEN when set, otherwise it signs the user in with
+// the device flow, printing the instructions to stderr
+func signIn(ctx context.Context, cfg *auth.Config) (*oauth2.Token, error) {
+	if pat := os.Getenv("GITHUB_TOKEN"); pat != "" {
+		return &oauth2.Token{AccessToken: pat}, nil
+	}
+	if cfg.ClientID == "" {
+		return nil, errors.New("set GITHUB_TOKEN or -client-id for the device flow")
+	}
+	return cfg.DeviceToken(ctx, nil)
+}
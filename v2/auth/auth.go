@@ -0,0 +1,162 @@
+// Package auth is the v2 API of github-org-auth. It consolidates the many
+// additions to v1 into a smaller, testable surface:
+//
+//   - every method takes a context.Context
+//   - an Authenticator is built with functional options, see New()
+//   - the provider, verifier and session layers are interfaces, so each of
+//     them can be replaced, e.g. by fakes in tests
+//   - errors are typed, see Error
+//
+// The v1 package, github.com/RealGeeks/github-org-auth/auth, stays intact and
+// its types are reused here so both versions can live in the same program.
+package auth
+
+import (
+	"context"
+	"net/http"
+
+	v1 "github.com/RealGeeks/github-org-auth/auth"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+)
+
+// Types shared with v1
+type (
+	User     = v1.User
+	Team     = v1.Team
+	Decision = v1.Decision
+	Reason   = v1.Reason
+)
+
+// Provider is the OAuth2 layer: it sends users to github and trades the
+// authorization code for a token
+type Provider interface {
+	AuthCodeURL(ctx context.Context, state string) string
+	Exchange(ctx context.Context, code string) (*oauth2.Token, error)
+}
+
+// Verifier is the membership layer: it decides whether the user owning token
+// is allowed in. *v1.Verifier implements it
+type Verifier interface {
+	VerifyToken(ctx context.Context, token *oauth2.Token) (Decision, *User, error)
+}
+
+// Session is what a SessionStore remembers about an authenticated user
+type Session struct {
+	User     *User
+	Decision Decision
+	Token    *oauth2.Token
+}
+
+// SessionStore is the session layer. Load returns a nil Session, and no
+// error, when the request doesn't have one
+type SessionStore interface {
+	Load(r *http.Request) (*Session, error)
+	Save(w http.ResponseWriter, r *http.Request, s *Session) error
+	Delete(w http.ResponseWriter, r *http.Request) error
+}
+
+// Authenticator glues a Provider, a Verifier and optionally a SessionStore
+// together. It's safe for concurrent use
+type Authenticator struct {
+	provider Provider
+	verifier Verifier
+	sessions SessionStore
+}
+
+// New returns an Authenticator configured by opts. Unless WithProvider() and
+// WithVerifier() are used, WithClient() and WithOrganization() are required
+func New(opts ...Option) (*Authenticator, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	a := &Authenticator{
+		provider: o.provider,
+		verifier: o.verifier,
+		sessions: o.sessions,
+	}
+	if a.provider == nil {
+		if o.clientID == "" || o.clientSecret == "" {
+			return nil, &Error{Kind: KindConfig, Op: "new", Err: errMissing("client id and secret")}
+		}
+		a.provider = &oauthProvider{cfg: &oauth2.Config{
+			ClientID:     o.clientID,
+			ClientSecret: o.clientSecret,
+			Scopes:       o.scopes(),
+			Endpoint:     github.Endpoint,
+		}}
+	}
+	if a.verifier == nil {
+		if o.verifier1.Organization == "" {
+			return nil, &Error{Kind: KindConfig, Op: "new", Err: errMissing("organization")}
+		}
+		v := o.verifier1
+		a.verifier = &v
+	}
+	return a, nil
+}
+
+// AuthCodeURL returns the URL to redirect users to so they can sign in with
+// github
+func (a *Authenticator) AuthCodeURL(ctx context.Context, state string) string {
+	return a.provider.AuthCodeURL(ctx, state)
+}
+
+// Exchange trades the authorization code given to your callback url for a
+// token
+func (a *Authenticator) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
+	token, err := a.provider.Exchange(ctx, code)
+	if err != nil {
+		return nil, &Error{Kind: KindExchange, Op: "exchange", Err: err}
+	}
+	return token, nil
+}
+
+// Verify decides whether the user owning token is allowed in
+func (a *Authenticator) Verify(ctx context.Context, token *oauth2.Token) (Decision, *User, error) {
+	decision, user, err := a.verifier.VerifyToken(ctx, token)
+	if err != nil {
+		return Decision{}, nil, &Error{Kind: KindGitHub, Op: "verify", Err: err}
+	}
+	if decision.Reason == v1.TokenInvalid {
+		return decision, nil, &Error{Kind: KindTokenInvalid, Op: "verify"}
+	}
+	return decision, user, nil
+}
+
+// Authenticate runs Exchange() and Verify() for your callback url
+func (a *Authenticator) Authenticate(ctx context.Context, code string) (Decision, *User, *oauth2.Token, error) {
+	token, err := a.Exchange(ctx, code)
+	if err != nil {
+		return Decision{}, nil, nil, err
+	}
+	decision, user, err := a.Verify(ctx, token)
+	if err != nil {
+		return Decision{}, nil, nil, err
+	}
+	return decision, user, token, nil
+}
+
+// Sessions returns the configured SessionStore, or an error of KindConfig
+// if WithSessionStore() wasn't used
+func (a *Authenticator) Sessions() (SessionStore, error) {
+	if a.sessions == nil {
+		return nil, &Error{Kind: KindConfig, Op: "sessions", Err: errMissing("session store")}
+	}
+	return a.sessions, nil
+}
+
+// oauthProvider is the default Provider, an OAuth App on github.com
+type oauthProvider struct {
+	cfg *oauth2.Config
+}
+
+func (p *oauthProvider) AuthCodeURL(ctx context.Context, state string) string {
+	return p.cfg.AuthCodeURL(state, oauth2.AccessTypeOnline)
+}
+
+func (p *oauthProvider) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
+	return p.cfg.Exchange(ctx, code)
+}
@@ -0,0 +1,60 @@
+package auth
+
+import "errors"
+
+// Kind classifies an Error so callers can tell "token bad" from "github
+// failed" and so on without matching strings
+type Kind int
+
+// Kinds of Error
+const (
+	KindConfig       Kind = iota + 1 // the Authenticator is misconfigured
+	KindExchange                     // the authorization code couldn't be exchanged
+	KindTokenInvalid                 // github rejected the token
+	KindGitHub                       // talking to github failed
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindConfig:
+		return "config"
+	case KindExchange:
+		return "exchange"
+	case KindTokenInvalid:
+		return "token invalid"
+	case KindGitHub:
+		return "github"
+	}
+	return "unknown"
+}
+
+// Error is the type of every error returned by an Authenticator
+type Error struct {
+	Kind Kind   // what went wrong
+	Op   string // Authenticator method which failed
+	Err  error  // underlying error, may be nil
+}
+
+func (e *Error) Error() string {
+	msg := "auth: " + e.Op + ": " + e.Kind.String()
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// IsKind reports whether err is an *Error of Kind k
+func IsKind(err error, k Kind) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Kind == k
+}
+
+// errMissing reports a required setting nobody gave us
+func errMissing(what string) error {
+	return errors.New("missing " + what)
+}
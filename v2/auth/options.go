@@ -0,0 +1,88 @@
+package auth
+
+import v1 "github.com/RealGeeks/github-org-auth/auth"
+
+// Option configures an Authenticator, see New()
+type Option func(*options)
+
+// options collects everything Option can set before New() validates it
+type options struct {
+	clientID     string
+	clientSecret string
+	extraScopes  []string
+	verifier1    v1.Verifier
+	provider     Provider
+	verifier     Verifier
+	sessions     SessionStore
+}
+
+// scopes returns the OAuth2 scopes to request
+func (o *options) scopes() []string {
+	return append([]string{"user:email", "read:org"}, o.extraScopes...)
+}
+
+// WithClient sets the OAuth2 application client id and secret
+func WithClient(id, secret string) Option {
+	return func(o *options) {
+		o.clientID, o.clientSecret = id, secret
+	}
+}
+
+// WithScopes requests more OAuth2 scopes besides user:email and read:org
+func WithScopes(scopes ...string) Option {
+	return func(o *options) {
+		o.extraScopes = append(o.extraScopes, scopes...)
+	}
+}
+
+// WithOrganization sets the Organization users must belong to
+func WithOrganization(org string) Option {
+	return func(o *options) {
+		o.verifier1.Organization = org
+	}
+}
+
+// WithTeams sets the teams, or globs, users must belong to. Any of them is
+// enough unless WithRequireAll() is used
+func WithTeams(teams ...string) Option {
+	return func(o *options) {
+		o.verifier1.AllowedTeams = append(o.verifier1.AllowedTeams, teams...)
+	}
+}
+
+// WithRequireAll requires membership in all teams given to WithTeams()
+func WithRequireAll() Option {
+	return func(o *options) {
+		o.verifier1.RequireAll = true
+	}
+}
+
+// WithAuthorize adds a final step to the decision, see v1.AuthorizeFunc
+func WithAuthorize(f v1.AuthorizeFunc) Option {
+	return func(o *options) {
+		o.verifier1.Authorize = f
+	}
+}
+
+// WithProvider replaces the default OAuth App provider, making WithClient()
+// and WithScopes() irrelevant
+func WithProvider(p Provider) Option {
+	return func(o *options) {
+		o.provider = p
+	}
+}
+
+// WithVerifier replaces the default membership check, making
+// WithOrganization(), WithTeams() and friends irrelevant
+func WithVerifier(v Verifier) Option {
+	return func(o *options) {
+		o.verifier = v
+	}
+}
+
+// WithSessionStore sets where sessions are kept
+func WithSessionStore(s SessionStore) Option {
+	return func(o *options) {
+		o.sessions = s
+	}
+}